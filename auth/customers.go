@@ -4,6 +4,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -30,8 +31,9 @@ func buildCustomerURL() string {
 }
 
 // IsCustomer returns true if a customer is listed in the customers file.
-// The validation is controlled by the 'validate_customers' env-var
-func IsCustomer(ownerLogin string, c *http.Client) (bool, error) {
+// The validation is controlled by the 'validate_customers' env-var, the
+// lookup is abandoned when ctx is done.
+func IsCustomer(ctx context.Context, ownerLogin string, c *http.Client) (bool, error) {
 	validate := customerValidationEnabled()
 	if !validate {
 		return true, nil
@@ -42,7 +44,7 @@ func IsCustomer(ownerLogin string, c *http.Client) (bool, error) {
 
 	customersURL := buildCustomerURL()
 
-	request, _ := http.NewRequest(http.MethodGet, customersURL, nil)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, customersURL, nil)
 
 	res, doErr := c.Do(request)
 	if doErr != nil {
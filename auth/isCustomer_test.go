@@ -4,6 +4,7 @@
 package auth
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -25,7 +26,7 @@ richard
 	os.Setenv("customers_url", server.URL+"/CUSTOMERS")
 
 	owner := ""
-	isCustomer, err := IsCustomer(owner, server.Client())
+	isCustomer, err := IsCustomer(context.Background(), owner, server.Client())
 	if err != nil {
 		t.Errorf("want no error, but got one: %s", err)
 		t.Fail()
@@ -51,7 +52,7 @@ richard`)
 	os.Setenv("customers_url", server.URL+"/CUSTOMERS")
 
 	owner := "alex"
-	isCustomer, err := IsCustomer(owner, server.Client())
+	isCustomer, err := IsCustomer(context.Background(), owner, server.Client())
 	if err != nil {
 		t.Errorf("want no error, but got one: %s", err)
 		t.Fail()
@@ -76,7 +77,7 @@ func Test_isCustomer_No_EmptyFile(t *testing.T) {
 	os.Setenv("customers_url", server.URL+"/CUSTOMERS")
 
 	owner := "alex"
-	isCustomer, err := IsCustomer(owner, server.Client())
+	isCustomer, err := IsCustomer(context.Background(), owner, server.Client())
 	if err != nil {
 		t.Errorf("want no error, but got one: %s", err)
 		t.Fail()
@@ -102,7 +103,7 @@ richard`)
 	os.Setenv("customers_url", server.URL+"/CUSTOMERS")
 
 	owner := "johmmcabe"
-	isCustomer, err := IsCustomer(owner, server.Client())
+	isCustomer, err := IsCustomer(context.Background(), owner, server.Client())
 	if err != nil {
 		t.Errorf("want no error, but got one: %s", err)
 		t.Fail()
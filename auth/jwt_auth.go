@@ -4,12 +4,15 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/alexellis/derek/logging"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
@@ -19,21 +22,35 @@ type JWTAuth struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// MakeAccessTokenForInstallation makes an access token for an installation / private key
-func MakeAccessTokenForInstallation(appID string, installation int, privateKey string) (string, error) {
+// MakeAccessTokenForInstallation makes an access token for an installation / private key,
+// apiURL is the base URL of the GitHub API i.e. https://api.github.com/
+func MakeAccessTokenForInstallation(ctx context.Context, apiURL, appID string, installation int, privateKey string) (string, error) {
+	jwtAuth, err := MakeInstallationToken(ctx, apiURL, appID, installation, privateKey)
+	if err != nil {
+		return "", err
+	}
+	return jwtAuth.Token, nil
+}
+
+// MakeInstallationToken exchanges a signed JWT for an installation access token,
+// the expiry time given by GitHub is returned alongside the token. The exchange
+// is abandoned when ctx is done.
+func MakeInstallationToken(ctx context.Context, apiURL, appID string, installation int, privateKey string) (JWTAuth, error) {
+	jwtAuth := JWTAuth{}
+
 	signed, err := GetSignedJwtToken(appID, privateKey)
 
 	if err != nil {
 		msg := fmt.Sprintf("can't run GetSignedJwtToken for app_id: %s and installation_id: %d, error: %v", appID, installation, err)
 
-		fmt.Printf("Error %s\n", msg)
-		return "", err
+		logging.Logger.WithField(logging.InstallationField, installation).Error(msg)
+		return jwtAuth, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost,
-		fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installation), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimSuffix(apiURL, "/"), installation), nil)
 	if err != nil {
-		return "", err
+		return jwtAuth, err
 	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", signed))
@@ -43,23 +60,27 @@ func MakeAccessTokenForInstallation(appID string, installation int, privateKey s
 
 	if err != nil {
 		msg := fmt.Sprintf("can't get access_token for app_id: %s and installation_id: %d error: %v", appID, installation, err)
-		fmt.Printf("Error: %s\n", msg)
-		return "", fmt.Errorf("%s", msg)
+		logging.Logger.WithField(logging.InstallationField, installation).Error(msg)
+		return jwtAuth, fmt.Errorf("%s", msg)
 	}
 
 	defer res.Body.Close()
 
 	bytesOut, readErr := ioutil.ReadAll(res.Body)
 	if readErr != nil {
-		return "", readErr
+		return jwtAuth, readErr
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		return jwtAuth, fmt.Errorf("can't get access_token for app_id: %s and installation_id: %d, status code: %d, body: %s",
+			appID, installation, res.StatusCode, string(bytesOut))
 	}
 
-	jwtAuth := JWTAuth{}
 	jsonErr := json.Unmarshal(bytesOut, &jwtAuth)
 	if jsonErr != nil {
-		return "", jsonErr
+		return jwtAuth, jsonErr
 	}
-	return jwtAuth.Token, nil
+	return jwtAuth, nil
 }
 
 // GetSignedJwtToken get a tokens signed with private key
@@ -0,0 +1,51 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_MakeInstallationToken_UsesAPIURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": "v1.abc", "expires_at": "2030-01-01T00:00:00Z"}`))
+	}))
+	defer server.Close()
+
+	jwtAuth, err := MakeInstallationToken(context.Background(), server.URL+"/api/v3/", "1", 42, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/api/v3/app/installations/42/access_tokens"; gotPath != want {
+		t.Errorf("want path: %q, got: %q", want, gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "Bearer ") {
+		t.Errorf("want a bearer JWT, got: %q", gotAuth)
+	}
+	if jwtAuth.Token != "v1.abc" {
+		t.Errorf("want token: %q, got: %q", "v1.abc", jwtAuth.Token)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/logging"
+)
+
+// defaultRefreshWindow is how long before GitHub's expiry a token is
+// refreshed, so that a token is never handed out moments before it expires
+const defaultRefreshWindow = time.Minute * 5
+
+// TokenCache holds installation access tokens keyed by installation ID
+// until shortly before they expire. It is safe for concurrent use and
+// can optionally persist tokens to disk, for use across processes.
+type TokenCache struct {
+	path          string
+	refreshWindow time.Duration
+
+	mu     sync.Mutex
+	tokens map[int]JWTAuth
+
+	// minting holds a lock per installation so that only one
+	// caller exchanges a JWT at a time for each installation
+	minting map[int]*sync.Mutex
+
+	// mint exchanges a JWT for an installation token, it is
+	// replaced in tests to avoid calling the GitHub API
+	mint func(ctx context.Context, appID string, installation int, privateKey string) (JWTAuth, error)
+	now  func() time.Time
+}
+
+// NewTokenCache creates a TokenCache which mints tokens from the GitHub API
+// at apiURL, when path is non-empty tokens are read from and written back
+// to that file with 0600 permissions.
+func NewTokenCache(path, apiURL string) *TokenCache {
+	c := &TokenCache{
+		path:          path,
+		refreshWindow: defaultRefreshWindow,
+		tokens:        map[int]JWTAuth{},
+		minting:       map[int]*sync.Mutex{},
+		now:           time.Now,
+	}
+	c.mint = func(ctx context.Context, appID string, installation int, privateKey string) (JWTAuth, error) {
+		return MakeInstallationToken(ctx, apiURL, appID, installation, privateKey)
+	}
+
+	if len(path) > 0 {
+		if err := c.load(); err != nil {
+			logging.Logger.Warnf("Unable to load token cache from %s: %s", path, err)
+		}
+	}
+
+	return c
+}
+
+// Token returns a cached access token for the installation, or mints
+// a new one if there is none or it is due to expire. Minting is abandoned
+// when ctx is done.
+func (c *TokenCache) Token(ctx context.Context, appID string, installation int, privateKey string) (string, error) {
+	lock := c.mintingLock(installation)
+
+	// Callers waiting here pick up the token minted by the first
+	// caller rather than each making their own exchange.
+	lock.Lock()
+	defer lock.Unlock()
+
+	if jwtAuth, ok := c.cached(installation); ok {
+		return jwtAuth.Token, nil
+	}
+
+	jwtAuth, err := c.mint(ctx, appID, installation, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.tokens[installation] = jwtAuth
+	snapshot := c.snapshot()
+	c.mu.Unlock()
+
+	if len(c.path) > 0 {
+		if err := c.save(snapshot); err != nil {
+			logging.Logger.Warnf("Unable to save token cache to %s: %s", c.path, err)
+		}
+	}
+
+	return jwtAuth.Token, nil
+}
+
+// Invalidate removes any cached token for the installation, i.e.
+// when the GitHub API rejects it with a 401.
+func (c *TokenCache) Invalidate(installation int) {
+	c.mu.Lock()
+	delete(c.tokens, installation)
+	snapshot := c.snapshot()
+	c.mu.Unlock()
+
+	// Otherwise the rejected token would be read back from the file
+	// by the next process to use it.
+	if len(c.path) > 0 {
+		if err := c.save(snapshot); err != nil {
+			logging.Logger.Warnf("Unable to save token cache to %s: %s", c.path, err)
+		}
+	}
+}
+
+func (c *TokenCache) mintingLock(installation int) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lock, ok := c.minting[installation]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.minting[installation] = lock
+	}
+	return lock
+}
+
+func (c *TokenCache) cached(installation int) (JWTAuth, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jwtAuth, ok := c.tokens[installation]
+	return jwtAuth, ok && c.valid(jwtAuth)
+}
+
+func (c *TokenCache) valid(jwtAuth JWTAuth) bool {
+	return len(jwtAuth.Token) > 0 &&
+		c.now().Add(c.refreshWindow).Before(jwtAuth.ExpiresAt)
+}
+
+// snapshot must be called whilst holding mu
+func (c *TokenCache) snapshot() map[int]JWTAuth {
+	tokens := make(map[int]JWTAuth, len(c.tokens))
+	for installation, jwtAuth := range c.tokens {
+		if c.valid(jwtAuth) {
+			tokens[installation] = jwtAuth
+		}
+	}
+	return tokens
+}
+
+func (c *TokenCache) load() error {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tokens := map[int]JWTAuth{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for installation, jwtAuth := range tokens {
+		if c.valid(jwtAuth) {
+			c.tokens[installation] = jwtAuth
+		}
+	}
+	return nil
+}
+
+// save writes to a temporary file then renames it over the cache file,
+// so a concurrent reader never sees a partially written file.
+func (c *TokenCache) save(tokens map[int]JWTAuth) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMinter struct {
+	mu     sync.Mutex
+	calls  int
+	expiry time.Duration
+}
+
+func (f *fakeMinter) mint(ctx context.Context, appID string, installation int, privateKey string) (JWTAuth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	return JWTAuth{
+		Token:     fmt.Sprintf("token-%d-%d", installation, f.calls),
+		ExpiresAt: time.Now().Add(f.expiry),
+	}, nil
+}
+
+func Test_TokenCache_ReusesToken(t *testing.T) {
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache("", "")
+	cache.mint = minter.mint
+
+	first, err := cache.Token(context.Background(), "1", 100, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := cache.Token(context.Background(), "1", 100, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Errorf("want same token, got: %q and %q", first, second)
+	}
+	if minter.calls != 1 {
+		t.Errorf("want 1 token exchange, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_KeyedByInstallation(t *testing.T) {
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache("", "")
+	cache.mint = minter.mint
+
+	first, _ := cache.Token(context.Background(), "1", 100, "key")
+	second, _ := cache.Token(context.Background(), "1", 200, "key")
+
+	if first == second {
+		t.Errorf("want different tokens per installation, got: %q", first)
+	}
+	if minter.calls != 2 {
+		t.Errorf("want 2 token exchanges, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_RefreshesAheadOfExpiry(t *testing.T) {
+	// Expires within the refresh window, so is never reused
+	minter := &fakeMinter{expiry: defaultRefreshWindow - time.Minute}
+	cache := NewTokenCache("", "")
+	cache.mint = minter.mint
+
+	first, _ := cache.Token(context.Background(), "1", 100, "key")
+	second, _ := cache.Token(context.Background(), "1", 100, "key")
+
+	if first == second {
+		t.Errorf("want token to be refreshed, got: %q twice", first)
+	}
+	if minter.calls != 2 {
+		t.Errorf("want 2 token exchanges, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_Invalidate(t *testing.T) {
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache("", "")
+	cache.mint = minter.mint
+
+	cache.Token(context.Background(), "1", 100, "key")
+	cache.Invalidate(100)
+	cache.Token(context.Background(), "1", 100, "key")
+
+	if minter.calls != 2 {
+		t.Errorf("want 2 token exchanges, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_ConcurrentCallersShareExchange(t *testing.T) {
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache("", "")
+	cache.mint = minter.mint
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Token(context.Background(), "1", 100, "key")
+		}()
+	}
+	wg.Wait()
+
+	if minter.calls != 1 {
+		t.Errorf("want 1 token exchange, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_PersistsToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-token-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cachePath := path.Join(dir, "tokens.json")
+
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache(cachePath, "")
+	cache.mint = minter.mint
+
+	want, _ := cache.Token(context.Background(), "1", 100, "key")
+
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		t.Fatalf("want cache file to be written: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("want permissions 0600, got: %s", info.Mode().Perm())
+	}
+
+	reloaded := NewTokenCache(cachePath, "")
+	reloaded.mint = minter.mint
+
+	got, _ := reloaded.Token(context.Background(), "1", 100, "key")
+	if got != want {
+		t.Errorf("want persisted token %q, got: %q", want, got)
+	}
+	if minter.calls != 1 {
+		t.Errorf("want 1 token exchange, got: %d", minter.calls)
+	}
+}
+
+func Test_TokenCache_InvalidateRemovesFromDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-token-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cachePath := path.Join(dir, "tokens.json")
+
+	minter := &fakeMinter{expiry: time.Hour}
+	cache := NewTokenCache(cachePath, "")
+	cache.mint = minter.mint
+
+	rejected, _ := cache.Token(context.Background(), "1", 100, "key")
+	cache.Invalidate(100)
+
+	reloaded := NewTokenCache(cachePath, "")
+	reloaded.mint = minter.mint
+
+	got, _ := reloaded.Token(context.Background(), "1", 100, "key")
+	if got == rejected {
+		t.Errorf("want a new token after invalidating %q", rejected)
+	}
+	if minter.calls != 2 {
+		t.Errorf("want 2 token exchanges, got: %d", minter.calls)
+	}
+}
@@ -9,19 +9,83 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	derekSecretKeyFile = "derek-secret-key"
 	privateKeyFile     = "derek-private-key"
+
+	// defaultDeliveryTTL covers GitHub's retries and manual redeliveries
+	defaultDeliveryTTL = time.Hour * 24
+
+	// defaultEventTimeout leaves time to write the response within
+	// the 15s write_timeout given in derek.yml
+	defaultEventTimeout = time.Second * 12
+
+	// defaultRateLimitMaxWait covers most secondary rate limits, whilst
+	// staying within defaultEventTimeout. A wait is also cut short by the
+	// deadline of the call, so a shorter event_timeout still applies.
+	defaultRateLimitMaxWait = time.Second * 10
 )
 
 // Config to run Derek
 type Config struct {
+	// SecretKey is the first webhook secret, SecretKeys holds every
+	// secret which is accepted so that secrets can be rotated
 	SecretKey       string
+	SecretKeys      []string
 	PrivateKey      string
 	ApplicationID   string
 	DCOStatusChecks bool
+
+	// TokenCachePath is an optional file used to persist installation
+	// access tokens between invocations
+	TokenCachePath string
+
+	// DeliveryStorePath is an optional directory which records processed
+	// X-GitHub-Delivery IDs for DeliveryTTL, so duplicates are skipped
+	DeliveryStorePath string
+	DeliveryTTL       time.Duration
+
+	// MaxPayloadAge rejects payloads whose timestamps are older than
+	// the given age, zero disables the check
+	MaxPayloadAge time.Duration
+
+	// LegacySHA1Signatures accepts the X-Hub-Signature header signed with
+	// SHA-1 when a webhook does not carry X-Hub-Signature-256
+	LegacySHA1Signatures bool
+
+	// EventTimeout is the deadline for handling a webhook, including
+	// token minting, fetching .DEREK.yml and every call to GitHub.
+	// Zero leaves the deadline to the caller.
+	EventTimeout time.Duration
+
+	// RateLimitMaxWait is how long a call to GitHub may wait for a rate
+	// limit to pass before it fails, zero fails straight away
+	RateLimitMaxWait time.Duration
+
+	// RetryMaxAttempts is how many times a call to GitHub which failed
+	// with a transient error is made before it is written to the
+	// dead-letter log at DeadLetterPath, when given
+	RetryMaxAttempts int
+	DeadLetterPath   string
+
+	// DryRun records the changes Derek would make to GitHub for every
+	// repository instead of making them
+	DryRun bool
+
+	// APIBaseURL, UploadBaseURL, RawBaseURL and WebBaseURL point Derek
+	// at a GitHub Enterprise Server, github.com is used when empty
+	APIBaseURL    string
+	UploadBaseURL string
+	RawBaseURL    string
+	WebBaseURL    string
+
+	// Operator holds the defaults and feature switches read from the
+	// file at OperatorConfigPath, which apply to every repository
+	OperatorConfigPath string
+	Operator           OperatorConfig
 }
 
 // NewConfig populates configuration from known-locations and gives
@@ -29,6 +93,10 @@ type Config struct {
 func NewConfig() (Config, error) {
 	config := Config{}
 
+	if err := readGitHubURLs(&config); err != nil {
+		return config, err
+	}
+
 	keyPath, pathErr := getSecretPath()
 	if pathErr != nil {
 		return config, pathErr
@@ -42,8 +110,11 @@ func NewConfig() (Config, error) {
 		return config, msg
 	}
 
-	secretKeyBytes = getFirstLine(secretKeyBytes)
-	config.SecretKey = string(secretKeyBytes)
+	config.SecretKeys = getSecretLines(secretKeyBytes)
+	if len(config.SecretKeys) == 0 {
+		return config, fmt.Errorf("no GitHub symmetrical secret found in: %s", path.Join(keyPath, derekSecretKeyFile))
+	}
+	config.SecretKey = config.SecretKeys[0]
 
 	privateKeyPath := path.Join(keyPath, privateKeyFile)
 
@@ -67,12 +138,102 @@ func NewConfig() (Config, error) {
 		}
 	}
 
+	if val, ok := os.LookupEnv("token_cache_path"); ok && len(val) > 0 {
+		config.TokenCachePath = val
+	}
+
+	config.DeliveryTTL = defaultDeliveryTTL
+	if val, ok := os.LookupEnv("delivery_ttl"); ok && len(val) > 0 {
+		v, err := parseDuration(val)
+		if err != nil {
+			return config, fmt.Errorf("invalid value for delivery_ttl: %q", val)
+		}
+		config.DeliveryTTL = v
+	}
+
+	if val, ok := os.LookupEnv("delivery_store_path"); ok && len(val) > 0 {
+		config.DeliveryStorePath = val
+	}
+
+	if val, ok := os.LookupEnv("max_payload_age"); ok && len(val) > 0 {
+		v, err := parseDuration(val)
+		if err != nil {
+			return config, fmt.Errorf("invalid value for max_payload_age: %q", val)
+		}
+		config.MaxPayloadAge = v
+	}
+
+	if val, ok := os.LookupEnv("validate_hmac_sha1"); ok && len(val) > 0 {
+		v, err := strconv.ParseBool(val)
+		if err == nil {
+			config.LegacySHA1Signatures = v
+		}
+	}
+
+	config.EventTimeout = defaultEventTimeout
+	if val, ok := os.LookupEnv("event_timeout"); ok && len(val) > 0 {
+		v, err := parseDuration(val)
+		if err != nil {
+			return config, fmt.Errorf("invalid value for event_timeout: %q", val)
+		}
+		config.EventTimeout = v
+	}
+
+	config.RateLimitMaxWait = defaultRateLimitMaxWait
+	if val, ok := os.LookupEnv("rate_limit_max_wait"); ok && len(val) > 0 {
+		v, err := parseDuration(val)
+		if err != nil {
+			return config, fmt.Errorf("invalid value for rate_limit_max_wait: %q", val)
+		}
+		config.RateLimitMaxWait = v
+	}
+
+	if val, ok := os.LookupEnv("retry_max_attempts"); ok && len(val) > 0 {
+		v, err := strconv.Atoi(val)
+		if err != nil || v < 1 {
+			return config, fmt.Errorf("invalid value for retry_max_attempts: %q", val)
+		}
+		config.RetryMaxAttempts = v
+	}
+
+	if val, ok := os.LookupEnv("dead_letter_path"); ok && len(val) > 0 {
+		config.DeadLetterPath = val
+	}
+
+	if val, ok := os.LookupEnv("dry_run"); ok && len(val) > 0 {
+		v, err := strconv.ParseBool(val)
+		if err == nil {
+			config.DryRun = v
+		}
+	}
+
+	if err := readOperatorConfig(&config); err != nil {
+		return config, err
+	}
+
 	// debug, _ := json.Marshal(config)
 	// fmt.Printf("Config:\n%s\n", debug)
 
 	return config, nil
 }
 
+// NewValidationConfig reads the settings needed to check a .DEREK.yml
+// outside of Derek, which are the GitHub URLs and the operator config.
+// Secrets are not needed, so it can be used by the config command.
+func NewValidationConfig() (Config, error) {
+	config := Config{}
+
+	if err := readGitHubURLs(&config); err != nil {
+		return config, err
+	}
+
+	if err := readOperatorConfig(&config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
 func getSecretPath() (string, error) {
 	secretPath := os.Getenv("secret_path")
 
@@ -83,10 +244,34 @@ func getSecretPath() (string, error) {
 	return secretPath, nil
 }
 
-func getFirstLine(secret []byte) []byte {
-	stringSecret := string(secret)
-	if newLine := strings.Index(stringSecret, "\n"); newLine != -1 {
-		secret = secret[:newLine]
+// parseDuration accepts a bare number of seconds or a Go duration, i.e. 1h
+func parseDuration(val string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(val); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(val)
+}
+
+// WebhookSecrets gives every accepted webhook secret, the current secret first
+func (c Config) WebhookSecrets() []string {
+	if len(c.SecretKeys) > 0 {
+		return c.SecretKeys
+	}
+	if len(c.SecretKey) > 0 {
+		return []string{c.SecretKey}
+	}
+	return nil
+}
+
+// getSecretLines gives each non-empty line of a secret file, so that the
+// current and previous secrets can be listed one per line whilst rotating
+func getSecretLines(secret []byte) []string {
+	var secrets []string
+	for _, line := range strings.Split(string(secret), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(strings.TrimSpace(line)) > 0 {
+			secrets = append(secrets, line)
+		}
 	}
-	return secret
+	return secrets
 }
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewConfig_NoSecretPath(t *testing.T) {
@@ -61,42 +69,313 @@ func TestNewConfig_ValidSecretPath_WithApplicationID(t *testing.T) {
 		t.Errorf("want %q, got %q", appIDWant, cfg.ApplicationID)
 		t.Fail()
 	}
+
+	if cfg.RateLimitMaxWait >= cfg.EventTimeout {
+		t.Errorf("want default rate limit wait %s within the event timeout %s", cfg.RateLimitMaxWait, cfg.EventTimeout)
+	}
 }
 
-func Test_getFirstLine(t *testing.T) {
+func Test_getSecretLines(t *testing.T) {
 	var exampleSecrets = []struct {
-		secret       string
-		expectedByte string
+		secret   string
+		expected []string
 	}{
 		{
-			secret:       "New-line \n",
-			expectedByte: "New-line ",
+			secret:   "New-line \n",
+			expected: []string{"New-line "},
 		},
 		{
 			secret: `Newline and text 
 			`,
-			expectedByte: "Newline and text ",
+			expected: []string{"Newline and text "},
+		},
+		{
+			secret:   `Example secret2 `,
+			expected: []string{`Example secret2 `},
 		},
 		{
-			secret:       `Example secret2 `,
-			expectedByte: `Example secret2 `,
+			secret:   "current\r\nprevious\r\n",
+			expected: []string{"current", "previous"},
 		},
 		{
-			secret:       "\n",
-			expectedByte: "",
+			secret:   "current\n\nprevious\n",
+			expected: []string{"current", "previous"},
 		},
 		{
-			secret:       "",
-			expectedByte: "",
+			secret:   "\n",
+			expected: nil,
+		},
+		{
+			secret:   "",
+			expected: nil,
 		},
 	}
 	for _, test := range exampleSecrets {
 
 		t.Run(string(test.secret), func(t *testing.T) {
-			stringNoLines := getFirstLine([]byte(test.secret))
-			if test.expectedByte != string(stringNoLines) {
-				t.Errorf("String after removal - wanted: \"%s\", got \"%s\"", test.expectedByte, test.secret)
+			secrets := getSecretLines([]byte(test.secret))
+			if !reflect.DeepEqual(test.expected, secrets) {
+				t.Errorf("Secrets after split - wanted: %q, got %q", test.expected, secrets)
+			}
+		})
+	}
+}
+
+func Test_GitHubURLs(t *testing.T) {
+	tests := []struct {
+		title  string
+		config Config
+		api    string
+		upload string
+		raw    string
+		web    string
+	}{
+		{
+			title:  "github.com by default",
+			config: Config{},
+			api:    "https://api.github.com/",
+			upload: "https://uploads.github.com/",
+			raw:    "https://raw.githubusercontent.com/",
+			web:    "https://github.com/",
+		},
+		{
+			title: "GitHub Enterprise Server with only API and web URLs",
+			config: Config{
+				APIBaseURL: "https://github.example.com/api/v3",
+				WebBaseURL: "https://github.example.com",
+			},
+			api:    "https://github.example.com/api/v3/",
+			upload: "https://github.example.com/api/v3/",
+			raw:    "https://github.example.com/raw/",
+			web:    "https://github.example.com/",
+		},
+		{
+			title: "GitHub Enterprise Server with every URL",
+			config: Config{
+				APIBaseURL:    "https://github.example.com/api/v3/",
+				UploadBaseURL: "https://github.example.com/api/uploads/",
+				RawBaseURL:    "https://raw.github.example.com/",
+				WebBaseURL:    "https://github.example.com/",
+			},
+			api:    "https://github.example.com/api/v3/",
+			upload: "https://github.example.com/api/uploads/",
+			raw:    "https://raw.github.example.com/",
+			web:    "https://github.example.com/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got := []string{test.config.APIURL(), test.config.UploadURL(), test.config.RawURL(), test.config.WebURL()}
+			want := []string{test.api, test.upload, test.raw, test.web}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("want %q, got %q", want[i], got[i])
+				}
 			}
 		})
 	}
 }
+
+func TestNewConfig_InvalidGitHubURL(t *testing.T) {
+	os.Setenv("github_api_url", "github.example.com/api/v3")
+	defer os.Unsetenv("github_api_url")
+
+	_, err := NewConfig()
+
+	want := `github_api_url must be an absolute http(s) URL, got: "github.example.com/api/v3"`
+	if err == nil || err.Error() != want {
+		t.Errorf("want %q, got %v", want, err)
+	}
+}
+
+func Test_ReadOperatorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid := path.Join(dir, "operator.yml")
+	ioutil.WriteFile(valid, []byte(`defaults:
+  features:
+  - dco_check
+  curators:
+  - alexellis
+  contributing_url: https://example.com/CONTRIBUTING.md
+disabled_features:
+- hacktoberfest
+forced_features:
+- dco_check
+- Hacktoberfest
+`), 0600)
+
+	operator, err := ReadOperatorConfig(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"alexellis"}; !reflect.DeepEqual(operator.Defaults.Maintainers, want) {
+		t.Errorf("want curators as maintainers: %v, got: %v", want, operator.Defaults.Maintainers)
+	}
+	if !operator.FeatureDisabled("HACKTOBERFEST") {
+		t.Errorf("want hacktoberfest disabled")
+	}
+	if !operator.FeatureForced("dco_check") {
+		t.Errorf("want dco_check forced")
+	}
+	if operator.FeatureForced("hacktoberfest") {
+		t.Errorf("want a disabled feature not to be forced")
+	}
+
+	typo := path.Join(dir, "typo.yml")
+	ioutil.WriteFile(typo, []byte("disabled_feature:\n- hacktoberfest\n"), 0600)
+
+	if _, err := ReadOperatorConfig(typo); err == nil {
+		t.Errorf("want an error for an unknown field")
+	}
+}
+
+func TestNewConfig_OperatorConfigMissing(t *testing.T) {
+	tmpDir := os.TempDir()
+	ioutil.WriteFile(path.Join(tmpDir, "derek-private-key"), []byte("private"), 0600)
+	ioutil.WriteFile(path.Join(tmpDir, "derek-secret-key"), []byte("secret"), 0600)
+	defer os.RemoveAll(path.Join(tmpDir, "derek-private-key"))
+	defer os.RemoveAll(path.Join(tmpDir, "derek-secret-key"))
+
+	os.Setenv("secret_path", tmpDir)
+	os.Setenv("application_id", "321")
+	os.Setenv("operator_config_path", path.Join(tmpDir, "derek-missing-operator.yml"))
+	defer os.Unsetenv("operator_config_path")
+
+	if _, err := NewConfig(); err == nil {
+		t.Errorf("want an error for a missing operator config")
+	}
+}
+
+func TestNewValidationConfig_WithoutSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	operatorPath := path.Join(dir, "operator.yml")
+	ioutil.WriteFile(operatorPath, []byte("disabled_features:\n- hacktoberfest\n"), 0600)
+
+	os.Setenv("secret_path", "")
+	os.Setenv("operator_config_path", operatorPath)
+	defer os.Unsetenv("operator_config_path")
+
+	cfg, err := NewValidationConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Operator.FeatureDisabled("hacktoberfest") {
+		t.Errorf("want the operator config read without secrets")
+	}
+
+	ioutil.WriteFile(operatorPath, []byte("disabled_feature:\n- hacktoberfest\n"), 0600)
+	if _, err := NewValidationConfig(); err == nil {
+		t.Errorf("want an error for an invalid operator config")
+	}
+}
+
+func newPrivateKeyPEM(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func Test_Reloader_KeepsConfigWhenInvalid(t *testing.T) {
+	current := Config{SecretKey: "secret", PrivateKey: newPrivateKeyPEM(t)}
+	next := Config{SecretKey: "rotated", PrivateKey: "not a key"}
+	var loadErr error
+
+	reloader := NewReloader(current, func() (Config, error) {
+		return next, loadErr
+	})
+
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("want an error for an invalid private key")
+	}
+	if got := reloader.Config().SecretKey; got != "secret" {
+		t.Errorf("want the current config kept, got secret: %q", got)
+	}
+
+	loadErr = errors.New("unable to read private key")
+	if err := reloader.Reload(); err != loadErr {
+		t.Errorf("want: %v, got: %v", loadErr, err)
+	}
+
+	loadErr = nil
+	next.PrivateKey = newPrivateKeyPEM(t)
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloader.Config().SecretKey; got != "rotated" {
+		t.Errorf("want the new config, got secret: %q", got)
+	}
+}
+
+func Test_Reloader_WatchReloadsChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	privateKey := newPrivateKeyPEM(t)
+	ioutil.WriteFile(path.Join(dir, privateKeyFile), []byte(privateKey), 0600)
+	ioutil.WriteFile(path.Join(dir, derekSecretKeyFile), []byte("secret"), 0600)
+
+	os.Setenv("secret_path", dir)
+	os.Setenv("application_id", "321")
+
+	initial, err := NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloader := NewReloader(initial, NewConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloads := make(chan error, 2)
+	go reloader.Watch(ctx, time.Millisecond*10, func(err error) {
+		reloads <- err
+	})
+
+	ioutil.WriteFile(path.Join(dir, derekSecretKeyFile), []byte("rotated\nsecret"), 0600)
+
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("want the config reloaded after the secret changed")
+	}
+
+	if want := []string{"rotated", "secret"}; !reflect.DeepEqual(reloader.Config().WebhookSecrets(), want) {
+		t.Errorf("want secrets: %v, got: %v", want, reloader.Config().WebhookSecrets())
+	}
+
+	ioutil.WriteFile(path.Join(dir, privateKeyFile), []byte("truncated"), 0600)
+
+	select {
+	case err := <-reloads:
+		if err == nil {
+			t.Fatal("want an error for the truncated private key")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("want a reload after the private key changed")
+	}
+
+	if got := reloader.Config().PrivateKey; got != privateKey {
+		t.Errorf("want the previous private key kept")
+	}
+}
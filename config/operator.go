@@ -0,0 +1,94 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/alexellis/derek/types"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OperatorConfig is set by whoever runs Derek, and applies to every
+// repository of every installation
+type OperatorConfig struct {
+	// Defaults are merged beneath each repository's .DEREK.yml
+	Defaults types.DerekRepoConfig `yaml:"defaults"`
+
+	// DisabledFeatures are turned off for every repository whatever its
+	// .DEREK.yml says, i.e. to switch off hacktoberfest in an emergency
+	DisabledFeatures []string `yaml:"disabled_features"`
+
+	// ForcedFeatures are turned on for every repository, a feature which
+	// is also in DisabledFeatures stays off
+	ForcedFeatures []string `yaml:"forced_features"`
+}
+
+// FeatureDisabled whether the feature has been turned off for every repository
+func (o OperatorConfig) FeatureDisabled(feature string) bool {
+	return containsFold(o.DisabledFeatures, feature)
+}
+
+// FeatureForced whether the feature has been turned on for every repository
+func (o OperatorConfig) FeatureForced(feature string) bool {
+	return containsFold(o.ForcedFeatures, feature) && !o.FeatureDisabled(feature)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOperatorConfig parses the operator config file at path, unknown
+// fields are an error so that a typo cannot leave a feature switched on
+func ReadOperatorConfig(path string) (OperatorConfig, error) {
+	operator := OperatorConfig{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return operator, fmt.Errorf("unable to read operator config: %s, error: %s", path, err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &operator); err != nil {
+		return operator, fmt.Errorf("unable to parse operator config: %s, error: %s", path, err)
+	}
+
+	if len(operator.Defaults.Maintainers) == 0 && len(operator.Defaults.Curators) > 0 {
+		operator.Defaults.Maintainers = operator.Defaults.Curators
+	}
+
+	if len(operator.Defaults.Redirect) > 0 {
+		return operator, fmt.Errorf("redirect cannot be given in the defaults of operator config: %s", path)
+	}
+
+	if len(operator.Defaults.Extends) > 0 {
+		return operator, fmt.Errorf("extends cannot be given in the defaults of operator config: %s", path)
+	}
+
+	return operator, nil
+}
+
+// readOperatorConfig loads the file given by operator_config_path, if any
+func readOperatorConfig(config *Config) error {
+	val, ok := os.LookupEnv("operator_config_path")
+	if !ok || len(val) == 0 {
+		return nil
+	}
+
+	operator, err := ReadOperatorConfig(val)
+	if err != nil {
+		return err
+	}
+
+	config.OperatorConfigPath = val
+	config.Operator = operator
+	return nil
+}
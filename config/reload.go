@@ -0,0 +1,152 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// defaultReloadInterval is how often the files of a Reloader are checked
+const defaultReloadInterval = time.Second * 10
+
+// Reloader holds the Config of a long-running Derek, and replaces it when
+// the secrets or operator config it was read from change. A new Config is
+// only used once it is valid, until then the old one is kept.
+type Reloader struct {
+	mu          sync.RWMutex
+	config      Config
+	fingerprint string
+
+	// load reads a new Config, i.e. NewConfig
+	load func() (Config, error)
+}
+
+// NewReloader holds config, which was read by load
+func NewReloader(config Config, load func() (Config, error)) *Reloader {
+	return &Reloader{
+		config:      config,
+		fingerprint: fingerprint(config),
+		load:        load,
+	}
+}
+
+// Config gives the Config currently in use
+func (r *Reloader) Config() Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.config
+}
+
+// Reload reads and validates a new Config, and swaps it in. The current
+// Config is kept when the new one cannot be read or is invalid.
+func (r *Reloader) Reload() error {
+	// Files which change whilst loading are picked up by the next check,
+	// and invalid files are only reported once by Watch
+	files := fingerprint(r.Config())
+	defer func() {
+		r.mu.Lock()
+		r.fingerprint = files
+		r.mu.Unlock()
+	}()
+
+	config, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	if err := validateReload(config); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.config = config
+	return nil
+}
+
+// Watch checks the files the Config was read from every interval until
+// ctx is done, and reloads when any of them changes. onReload is given
+// the outcome of each reload.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		onReload(r.Reload())
+	}
+}
+
+func (r *Reloader) changed() bool {
+	files := fingerprint(r.Config())
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return files != r.fingerprint
+}
+
+// validateReload checks a new Config before it replaces one which works,
+// the private key is parsed as it would be when minting a token
+func validateReload(config Config) error {
+	if len(config.WebhookSecrets()) == 0 {
+		return fmt.Errorf("no webhook secret given")
+	}
+
+	if _, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(config.PrivateKey)); err != nil {
+		return fmt.Errorf("invalid private key: %s", err)
+	}
+
+	return nil
+}
+
+// fingerprint hashes the contents of the files a Config is read from,
+// reading them by path follows the symlinks which are swapped when a
+// Kubernetes secret is updated
+func fingerprint(config Config) string {
+	files := []string{config.OperatorConfigPath}
+	if secretPath, err := getSecretPath(); err == nil {
+		files = append(files, path.Join(secretPath, derekSecretKeyFile), path.Join(secretPath, privateKeyFile))
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		hash.Write([]byte(file))
+		if len(file) == 0 {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			hash.Write([]byte(err.Error()))
+			continue
+		}
+		hash.Write(data)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
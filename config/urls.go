@@ -0,0 +1,83 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	defaultAPIURL    = "https://api.github.com/"
+	defaultUploadURL = "https://uploads.github.com/"
+	defaultRawURL    = "https://raw.githubusercontent.com/"
+	defaultWebURL    = "https://github.com/"
+)
+
+// APIURL is the base URL of the REST API, i.e. https://github.example.com/api/v3/
+func (c Config) APIURL() string {
+	return withSlash(c.APIBaseURL, defaultAPIURL)
+}
+
+// UploadURL is the base URL for uploads, which falls back to the API
+// URL when only that has been set, as on most GitHub Enterprise Servers
+func (c Config) UploadURL() string {
+	if len(c.UploadBaseURL) == 0 && len(c.APIBaseURL) > 0 {
+		return c.APIURL()
+	}
+	return withSlash(c.UploadBaseURL, defaultUploadURL)
+}
+
+// RawURL is the base URL for raw file contents in the form
+// <RawURL><owner>/<repo>/<branch>/<path>, which falls back to
+// <WebURL>raw/ when only the web URL has been set
+func (c Config) RawURL() string {
+	if len(c.RawBaseURL) == 0 && len(c.WebBaseURL) > 0 {
+		return c.WebURL() + "raw/"
+	}
+	return withSlash(c.RawBaseURL, defaultRawURL)
+}
+
+// WebURL is the base URL of the web UI, used for links to repositories
+func (c Config) WebURL() string {
+	return withSlash(c.WebBaseURL, defaultWebURL)
+}
+
+func withSlash(value, fallback string) string {
+	if len(value) == 0 {
+		return fallback
+	}
+	return strings.TrimSuffix(value, "/") + "/"
+}
+
+// readGitHubURLs reads the base URLs of a GitHub Enterprise Server,
+// any which are not set are left empty so that github.com is used
+func readGitHubURLs(config *Config) error {
+	urls := []struct {
+		env   string
+		value *string
+	}{
+		{"github_api_url", &config.APIBaseURL},
+		{"github_upload_url", &config.UploadBaseURL},
+		{"github_raw_url", &config.RawBaseURL},
+		{"github_web_url", &config.WebBaseURL},
+	}
+
+	for _, u := range urls {
+		val, ok := os.LookupEnv(u.env)
+		if !ok || len(val) == 0 {
+			continue
+		}
+
+		parsed, err := url.Parse(val)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+			return fmt.Errorf("%s must be an absolute http(s) URL, got: %q", u.env, val)
+		}
+		*u.value = val
+	}
+
+	return nil
+}
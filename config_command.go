@@ -0,0 +1,99 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/handler"
+)
+
+const configValidateUsage = `Usage: derek config validate [file]
+
+Checks a .DEREK.yml, and the files it extends and redirects to, for unknown fields,
+unknown features and other errors, then prints the features and
+maintainers Derek would use. The file defaults to .DEREK.yml.
+
+The operator config given by operator_config_path is applied when set.
+`
+
+// configCommand runs the config subcommand given in args
+func configCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprint(out, configValidateUsage)
+		return fmt.Errorf("config needs a subcommand, i.e. validate")
+	}
+
+	return validateConfig(args[1:], out)
+}
+
+// validateConfig prints the problems found in the file given in args, and
+// returns an error when any of them is more than a warning
+func validateConfig(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, configValidateUsage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	path := ".DEREK.yml"
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		path = flags.Arg(0)
+	default:
+		flags.Usage()
+		return fmt.Errorf("config validate takes a single file")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.NewValidationConfig()
+	if err != nil {
+		return err
+	}
+
+	effective, problems := handler.ValidateRepoConfig(context.Background(), path, data, cfg)
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+
+	if handler.HasConfigErrors(problems) {
+		return fmt.Errorf("%s is not valid", path)
+	}
+
+	fmt.Fprintf(out, "%s is valid\n", path)
+	if len(effective.Redirect) > 0 {
+		fmt.Fprintf(out, "redirect: %s\n", effective.Redirect)
+	}
+	if len(effective.Sources) > 1 {
+		fmt.Fprintf(out, "merged from, lowest precedence first: %s\n", formatList(effective.Sources))
+	}
+	fmt.Fprintf(out, "features: %s\n", formatList(effective.Features))
+	fmt.Fprintf(out, "maintainers: %s\n", formatList(effective.Maintainers))
+	return nil
+}
+
+func formatList(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return strings.Join(values, ", ")
+}
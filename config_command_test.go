@@ -0,0 +1,72 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_validateConfig(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		"valid.yml":   "maintainers:\n- alexellis\nfeatures:\n- comments\n- dco_chek\n",
+		"invalid.yml": "maintainers:\n- alexellis\nfeature:\n- comments\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	if err := configCommand([]string{"validate", filepath.Join(dir, "valid.yml")}, &out); err != nil {
+		t.Fatalf("want warnings only, got: %s, output: %s", err, out.String())
+	}
+
+	for _, want := range []string{
+		"valid.yml:5: warning: unknown feature \"dco_chek\"",
+		"features: comments, dco_chek",
+		"maintainers: alexellis",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want output to contain %q, got: %s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := configCommand([]string{"validate", filepath.Join(dir, "invalid.yml")}, &out); err == nil {
+		t.Errorf("want an error for an unknown field")
+	}
+
+	if want := "invalid.yml:3: error: unknown field \"feature\""; !strings.Contains(out.String(), want) {
+		t.Errorf("want output to contain %q, got: %s", want, out.String())
+	}
+}
+
+func Test_validateConfig_OperatorConfig(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		".DEREK.yml":   "maintainers:\n- alexellis\nfeatures:\n- comments\n- hacktoberfest\n",
+		"operator.yml": "disabled_features:\n- hacktoberfest\n",
+		"invalid.yml":  "disabled_feature:\n- hacktoberfest\n",
+	})
+	defer os.RemoveAll(dir)
+
+	os.Setenv("secret_path", "")
+	os.Setenv("operator_config_path", filepath.Join(dir, "operator.yml"))
+	defer os.Unsetenv("operator_config_path")
+
+	var out bytes.Buffer
+	if err := configCommand([]string{"validate", filepath.Join(dir, ".DEREK.yml")}, &out); err != nil {
+		t.Fatalf("want no error, got: %s, output: %s", err, out.String())
+	}
+	if want := "features: comments\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("want the disabled feature left out, got: %s", out.String())
+	}
+
+	os.Setenv("operator_config_path", filepath.Join(dir, "invalid.yml"))
+
+	out.Reset()
+	if err := configCommand([]string{"validate", filepath.Join(dir, ".DEREK.yml")}, &out); err == nil {
+		t.Errorf("want an error for an invalid operator config")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package delivery
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// payloadTimes holds the timestamps which GitHub embeds in the events
+// which Derek subscribes to
+type payloadTimes struct {
+	Comment *struct {
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	} `json:"comment"`
+	Issue *struct {
+		UpdatedAt time.Time `json:"updated_at"`
+	} `json:"issue"`
+	PullRequest *struct {
+		UpdatedAt time.Time `json:"updated_at"`
+	} `json:"pull_request"`
+	Release *struct {
+		CreatedAt   time.Time `json:"created_at"`
+		PublishedAt time.Time `json:"published_at"`
+	} `json:"release"`
+	HeadCommit *struct {
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"head_commit"`
+}
+
+// PayloadTime gives the most recent timestamp embedded in a webhook
+// payload, false is returned when the payload has none.
+func PayloadTime(body []byte) (time.Time, bool) {
+	var times payloadTimes
+	if err := json.Unmarshal(body, &times); err != nil {
+		return time.Time{}, false
+	}
+
+	var candidates []time.Time
+	if c := times.Comment; c != nil {
+		candidates = append(candidates, c.CreatedAt, c.UpdatedAt)
+	}
+	if i := times.Issue; i != nil {
+		candidates = append(candidates, i.UpdatedAt)
+	}
+	if pr := times.PullRequest; pr != nil {
+		candidates = append(candidates, pr.UpdatedAt)
+	}
+	if r := times.Release; r != nil {
+		candidates = append(candidates, r.CreatedAt, r.PublishedAt)
+	}
+	if c := times.HeadCommit; c != nil {
+		candidates = append(candidates, c.Timestamp)
+	}
+
+	var latest time.Time
+	for _, t := range candidates {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
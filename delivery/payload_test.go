@@ -0,0 +1,55 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package delivery
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_PayloadTime(t *testing.T) {
+	tests := []struct {
+		title    string
+		payload  string
+		expected string
+	}{
+		{
+			title:    "Comment edited after it was created",
+			payload:  `{"comment": {"created_at": "2019-10-01T10:00:00Z", "updated_at": "2019-10-02T10:00:00Z"}, "issue": {"updated_at": "2019-10-01T09:00:00Z"}}`,
+			expected: "2019-10-02T10:00:00Z",
+		},
+		{
+			title:    "Pull request",
+			payload:  `{"pull_request": {"updated_at": "2019-10-03T10:00:00Z"}}`,
+			expected: "2019-10-03T10:00:00Z",
+		},
+		{
+			title:    "Draft release has no published_at",
+			payload:  `{"release": {"created_at": "2019-10-04T10:00:00Z", "published_at": null}}`,
+			expected: "2019-10-04T10:00:00Z",
+		},
+		{
+			title:    "No timestamps",
+			payload:  `{"action": "opened"}`,
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, ok := PayloadTime([]byte(test.payload))
+			if len(test.expected) == 0 {
+				if ok {
+					t.Errorf("want no time, got: %s", got)
+				}
+				return
+			}
+
+			want, _ := time.Parse(time.RFC3339, test.expected)
+			if !ok || !got.Equal(want) {
+				t.Errorf("want: %s, got: %s", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package delivery records the webhook deliveries which Derek has processed,
+// so that retried or replayed deliveries can be skipped
+package delivery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store records delivery IDs until they expire
+type Store interface {
+	// Record returns true when the ID has not been recorded within the
+	// expiry, or false when it is a duplicate.
+	Record(id string) (bool, error)
+
+	// Forget removes a recorded ID, i.e. when the delivery could not be
+	// processed and a redelivery should be allowed to run.
+	Forget(id string) error
+}
+
+// MemoryStore is a Store for a single long-running process
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	recorded   map[string]time.Time
+	lastPruned time.Time
+	now        func() time.Time
+}
+
+// NewMemoryStore creates a MemoryStore which keeps IDs for ttl
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttl,
+		recorded: map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Record implements Store
+func (s *MemoryStore) Record(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	if at, ok := s.recorded[id]; ok && now.Sub(at) < s.ttl {
+		return false, nil
+	}
+
+	s.recorded[id] = now
+	return true, nil
+}
+
+// Forget implements Store
+func (s *MemoryStore) Forget(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.recorded, id)
+	return nil
+}
+
+// prune must be called whilst holding mu, expired IDs are removed at
+// most once per ttl so that Record stays cheap
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.lastPruned) < s.ttl {
+		return
+	}
+	for id, at := range s.recorded {
+		if now.Sub(at) >= s.ttl {
+			delete(s.recorded, id)
+		}
+	}
+	s.lastPruned = now
+}
+
+// DirStore is a Store which keeps one file per ID in a directory, so it
+// can be shared by the processes forked by the OpenFaaS classic watchdog.
+// Files are created exclusively, so only one process records an ID.
+type DirStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewDirStore creates the directory if needed and keeps IDs for ttl
+func NewDirStore(dir string, ttl time.Duration) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DirStore{
+		dir: dir,
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+// Record implements Store
+func (s *DirStore) Record(id string) (bool, error) {
+	s.prune()
+
+	path := s.path(id)
+	now := s.now()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err == nil {
+		if err := f.Close(); err != nil {
+			return true, err
+		}
+		return true, os.Chtimes(path, now, now)
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if now.Sub(info.ModTime()) < s.ttl {
+		return false, nil
+	}
+
+	// The ID has expired, so it is recorded again from now
+	return true, os.Chtimes(path, now, now)
+}
+
+// Forget implements Store
+func (s *DirStore) Forget(id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path hashes the ID, since it comes from a request header
+func (s *DirStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// prune removes expired files, errors are ignored since another
+// process may be pruning at the same time
+func (s *DirStore) prune() {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"))
+	if err != nil {
+		return
+	}
+
+	now := s.now()
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err == nil && now.Sub(info.ModTime()) >= s.ttl {
+			os.Remove(file)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package delivery
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_MemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	testStore(t, store, func(d time.Duration) { now = now.Add(d) })
+}
+
+func Test_DirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-deliveries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewDirStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// File times come from the filesystem, so the store's clock is
+	// moved forward rather than the files being made older
+	offset := time.Duration(0)
+	store.now = func() time.Time { return time.Now().Add(offset) }
+
+	testStore(t, store, func(d time.Duration) { offset += d })
+
+	// A second process sharing the directory sees the same deliveries
+	other, _ := NewDirStore(dir, time.Hour)
+	other.now = store.now
+	if first, _ := other.Record("delivery-1"); first {
+		t.Errorf("want delivery recorded by another store to be a duplicate")
+	}
+}
+
+func testStore(t *testing.T, store Store, advance func(time.Duration)) {
+	record := func(id string, want bool) {
+		t.Helper()
+		first, err := store.Record(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != want {
+			t.Errorf("want first delivery of %s: %v, got: %v", id, want, first)
+		}
+	}
+
+	record("delivery-1", true)
+	record("delivery-1", false)
+	record("delivery-2", true)
+
+	if err := store.Forget("delivery-2"); err != nil {
+		t.Fatal(err)
+	}
+	record("delivery-2", true)
+
+	advance(time.Hour + time.Minute)
+	record("delivery-1", true)
+	record("delivery-1", false)
+}
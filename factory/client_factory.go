@@ -6,23 +6,75 @@ package factory
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 
 	"github.com/alexellis/derek/config"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
 
-// MakeClient makes a HTTP client with a signed access token
+// MakeClient makes a HTTP client with a signed access token, which talks
+// to the API URLs given in config
 func MakeClient(ctx context.Context, accessToken string, config config.Config) *github.Client {
-	if len(accessToken) == 0 {
-		return github.NewClient(nil)
+	baseClient := &http.Client{
+		Transport: makeTransport(ctx, config),
 	}
 
-	tokenSource := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: accessToken},
-	)
-	tokenClient := oauth2.NewClient(ctx, tokenSource)
+	httpClient := baseClient
+	if len(accessToken) > 0 {
+		tokenSource := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: accessToken},
+		)
+
+		// oauth2 wraps the transport of the client found in the context
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, baseClient)
+		httpClient = oauth2.NewClient(ctx, tokenSource)
+	}
+
+	return newClient(httpClient, config)
+}
+
+// MakeInstallationClient makes a HTTP client like MakeClient, which asks
+// tokens for the access token of each call. A token which GitHub rejects
+// with a 401 is invalidated and the call retried once with a new token.
+func MakeInstallationClient(ctx context.Context, tokens TokenSource, config config.Config) *github.Client {
+	httpClient := &http.Client{
+		Transport: &tokenTransport{
+			tokens: tokens,
+			next:   makeTransport(ctx, config),
+		},
+	}
+
+	return newClient(httpClient, config)
+}
+
+// newClient makes a client which talks to the API URLs given in config
+func newClient(httpClient *http.Client, config config.Config) *github.Client {
+	client := github.NewClient(httpClient)
+
+	// The URLs are validated when the config is read
+	if baseURL, err := url.Parse(config.APIURL()); err == nil {
+		client.BaseURL = baseURL
+	}
+	if uploadURL, err := url.Parse(config.UploadURL()); err == nil {
+		client.UploadURL = uploadURL
+	}
 
-	client := github.NewClient(tokenClient)
 	return client
 }
+
+// makeTransport gives the transport used beneath the access token, when the
+// context carries a Plan then mutating calls are recorded instead of sent.
+// Only calls which reach GitHub are counted in the metrics, including each
+// retry of a rate limited call.
+func makeTransport(ctx context.Context, config config.Config) http.RoundTripper {
+	var transport http.RoundTripper = &metricsTransport{next: http.DefaultTransport}
+	transport = newRateLimitTransport(transport, config.RateLimitMaxWait)
+
+	if plan := PlanFromContext(ctx); plan != nil {
+		transport = &dryRunTransport{plan: plan, next: transport}
+	}
+
+	return transport
+}
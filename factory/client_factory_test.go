@@ -0,0 +1,25 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+)
+
+func Test_MakeClient_UsesEnterpriseURLs(t *testing.T) {
+	client := MakeClient(context.Background(), "token", config.Config{
+		APIBaseURL:    "https://github.example.com/api/v3",
+		UploadBaseURL: "https://github.example.com/api/uploads",
+	})
+
+	if got := client.BaseURL.String(); got != "https://github.example.com/api/v3/" {
+		t.Errorf("want enterprise base URL, got: %q", got)
+	}
+	if got := client.UploadURL.String(); got != "https://github.example.com/api/uploads/" {
+		t.Errorf("want enterprise upload URL, got: %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// PlannedAction is a mutating GitHub API call which was recorded
+// instead of being sent, because Derek is running in dry-run mode.
+type PlannedAction struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+func (a PlannedAction) String() string {
+	if len(a.Body) == 0 {
+		return fmt.Sprintf("%s %s", a.Method, a.Path)
+	}
+	return fmt.Sprintf("%s %s %s", a.Method, a.Path, a.Body)
+}
+
+// Plan collects the actions Derek would have taken for an event,
+// it is safe for concurrent use.
+type Plan struct {
+	mu      sync.Mutex
+	actions []PlannedAction
+}
+
+// NewPlan creates an empty Plan
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// Actions returns a copy of the actions recorded so far
+func (p *Plan) Actions() []PlannedAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PlannedAction(nil), p.actions...)
+}
+
+func (p *Plan) record(action PlannedAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.actions = append(p.actions, action)
+}
+
+type planKey struct{}
+
+// WithPlan returns a context which causes clients made by MakeClient
+// to record mutating calls into the plan rather than sending them.
+func WithPlan(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// PlanFromContext returns the Plan added with WithPlan, or nil
+func PlanFromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planKey{}).(*Plan)
+	return plan
+}
+
+// dryRunTransport passes reads through to GitHub, including GraphQL
+// queries, and answers every other request itself with an empty
+// successful response.
+type dryRunTransport struct {
+	plan *Plan
+	next http.RoundTripper
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	action := PlannedAction{
+		Method: req.Method,
+		Path:   req.URL.Path,
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		action.Body = string(bytes.TrimSpace(body))
+	}
+
+	if isGraphQLQuery(req, body) {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return t.next.RoundTrip(req)
+	}
+
+	t.plan.record(action)
+
+	status := http.StatusOK
+	switch req.Method {
+	case http.MethodPost:
+		status = http.StatusCreated
+	case http.MethodDelete:
+		status = http.StatusNoContent
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(nil)),
+		ContentLength: 0,
+		Request:       req,
+	}, nil
+}
+
+// isGraphQLQuery whether the request is a read from the GraphQL API,
+// rather than a mutation
+func isGraphQLQuery(req *http.Request, body []byte) bool {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/graphql") {
+		return false
+	}
+
+	payload := struct {
+		Query string `json:"query"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+
+	query := strings.TrimSpace(payload.Query)
+	return len(query) > 0 && !strings.HasPrefix(query, "mutation")
+}
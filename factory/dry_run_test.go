@@ -0,0 +1,130 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+	"github.com/google/go-github/github"
+)
+
+func Test_MakeClient_DryRunRecordsMutations(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"number": 1, "title": "Add docs"}`))
+	}))
+	defer server.Close()
+
+	plan := NewPlan()
+	ctx := WithPlan(context.Background(), plan)
+
+	client := MakeClient(ctx, "token", config.Config{})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	issue, _, err := client.Issues.Get(ctx, "alexellis", "derek", 1)
+	if err != nil {
+		t.Fatalf("want GET to pass through, got: %s", err)
+	}
+	if issue.GetTitle() != "Add docs" {
+		t.Errorf("want title from server, got: %q", issue.GetTitle())
+	}
+
+	_, resp, err := client.Issues.CreateComment(ctx, "alexellis", "derek", 1, &github.IssueComment{Body: github.String("Thank you")})
+	if err != nil {
+		t.Fatalf("want recorded POST to succeed, got: %s", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("want status: %d, got: %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, err = client.Issues.RemoveLabelForIssue(ctx, "alexellis", "derek", 1, "bug")
+	if err != nil {
+		t.Fatalf("want recorded DELETE to succeed, got: %s", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("want status: %d, got: %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	if len(sent) != 1 || sent[0] != "GET /repos/alexellis/derek/issues/1" {
+		t.Errorf("want only the GET sent to GitHub, got: %v", sent)
+	}
+
+	actions := plan.Actions()
+	if len(actions) != 2 {
+		t.Fatalf("want 2 planned actions, got: %d", len(actions))
+	}
+
+	want := `POST /repos/alexellis/derek/issues/1/comments {"body":"Thank you"}`
+	if got := actions[0].String(); got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+
+	want = "DELETE /repos/alexellis/derek/issues/1/labels/bug"
+	if got := actions[1].String(); got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func Test_MakeClient_WithoutPlanSendsMutations(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := MakeClient(context.Background(), "token", config.Config{})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	_, _, err := client.Issues.CreateComment(context.Background(), "alexellis", "derek", 1, &github.IssueComment{Body: github.String("Thank you")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 || sent[0] != http.MethodPost {
+		t.Errorf("want POST sent to server, got: %v", sent)
+	}
+}
+
+func Test_MakeClient_DryRunSendsGraphQLQueries(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer server.Close()
+
+	plan := NewPlan()
+	ctx := WithPlan(context.Background(), plan)
+
+	client := MakeClient(ctx, "token", config.Config{})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	for _, query := range []string{"query { viewer { login } }", "mutation { addStar(input: {}) { clientMutationId } }"} {
+		req, err := client.NewRequest(http.MethodPost, "graphql", map[string]string{"query": query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Do(ctx, req, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sent) != 1 || sent[0] != "POST /graphql" {
+		t.Errorf("want only the query sent to GitHub, got: %v", sent)
+	}
+	if actions := plan.Actions(); len(actions) != 1 || !strings.HasPrefix(actions[0].Body, `{"query":"mutation`) {
+		t.Errorf("want the mutation planned, got: %v", actions)
+	}
+}
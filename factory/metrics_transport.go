@@ -0,0 +1,44 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexellis/derek/metrics"
+)
+
+// metricsTransport records the latency and status of each call to the
+// GitHub API, along with the rate limit headers of its response
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	metrics.GitHubRequestDuration.Observe(time.Since(start).Seconds(), req.Method)
+
+	if err != nil {
+		metrics.GitHubRequests.Inc(req.Method, "error")
+		return res, err
+	}
+
+	metrics.GitHubRequests.Inc(req.Method, strconv.Itoa(res.StatusCode))
+
+	resource := res.Header.Get("X-RateLimit-Resource")
+	if len(resource) == 0 {
+		resource = "core"
+	}
+	if remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining")); err == nil {
+		metrics.GitHubRateLimitRemaining.Set(float64(remaining), resource)
+	}
+	if limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit")); err == nil {
+		metrics.GitHubRateLimit.Set(float64(limit), resource)
+	}
+
+	return res, nil
+}
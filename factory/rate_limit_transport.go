@@ -0,0 +1,205 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexellis/derek/logging"
+	"github.com/google/go-github/github"
+)
+
+// maxRateLimitRetries bounds the retries of a single call, even when the
+// wait budget would allow more
+const maxRateLimitRetries = 5
+
+// RateLimitExceededError is given instead of a response when GitHub has
+// rate limited a call and waiting for the limit to pass would exceed the
+// budget for the call.
+type RateLimitExceededError struct {
+	Method string
+	URL    string
+
+	// Secondary is true for GitHub's secondary (abuse) rate limits
+	Secondary bool
+
+	// Wait is how long GitHub asked Derek to wait, Budget is how long
+	// was left before the deadline for the call
+	Wait   time.Duration
+	Budget time.Duration
+}
+
+func (e *RateLimitExceededError) Error() string {
+	kind := "rate limit"
+	if e.Secondary {
+		kind = "secondary rate limit"
+	}
+	return fmt.Sprintf("GitHub %s exceeded for %s %s: retry in %s is beyond the remaining budget of %s",
+		kind, e.Method, e.URL, e.Wait.Round(time.Second), e.Budget.Round(time.Second))
+}
+
+// rateLimitTransport retries calls which GitHub rate limited, for as long
+// as the limit passes within maxWait or the deadline of the request
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	maxWait time.Duration
+
+	now    func() time.Time
+	sleep  func(req *http.Request, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+func newRateLimitTransport(next http.RoundTripper, maxWait time.Duration) *rateLimitTransport {
+	return &rateLimitTransport{
+		next:    next,
+		maxWait: maxWait,
+		now:     time.Now,
+		sleep:   sleepForRequest,
+		jitter:  addJitter,
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := t.now().Add(t.maxWait)
+	if d, ok := req.Context().Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.next.RoundTrip(req)
+		if err != nil {
+			return res, err
+		}
+
+		wait, secondary, limited := rateLimitWait(res, attempt, t.now())
+		if !limited {
+			return res, nil
+		}
+		wait = t.jitter(wait)
+
+		// Without GetBody the request cannot be sent again, so the
+		// rate limited response is handed back to go-github
+		if req.Body != nil && req.GetBody == nil {
+			return res, nil
+		}
+
+		budget := deadline.Sub(t.now())
+		if attempt >= maxRateLimitRetries || wait > budget {
+			res.Body.Close()
+			if budget < 0 {
+				budget = 0
+			}
+			return nil, &RateLimitExceededError{
+				Method:    req.Method,
+				URL:       req.URL.Path,
+				Secondary: secondary,
+				Wait:      wait,
+				Budget:    budget,
+			}
+		}
+		res.Body.Close()
+
+		logging.FromContext(req.Context()).Warnf("GitHub rate limited %s %s (secondary: %t), retrying in %s",
+			req.Method, req.URL.Path, secondary, wait.Round(time.Millisecond))
+
+		if err := t.sleep(req, wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// rateLimitWait says whether a response was rate limited, and how long
+// to wait before retrying. The body is read to detect the limit, so it
+// is replaced for the caller.
+func rateLimitWait(res *http.Response, attempt int, now time.Time) (wait time.Duration, secondary bool, limited bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false, false
+	}
+
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	check := *res
+	check.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	switch e := github.CheckResponse(&check).(type) {
+	case *github.RateLimitError:
+		return untilReset(e.Rate.Reset.Time, now), false, true
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, true, true
+		}
+		return backoff(attempt), true, true
+	}
+
+	// Secondary limits are documented under a different URL than the
+	// one go-github matches, so they are detected by status and headers
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true, true
+	}
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return untilReset(time.Unix(reset, 0), now), false, true
+		}
+	}
+	if res.StatusCode == http.StatusTooManyRequests ||
+		strings.Contains(strings.ToLower(string(data)), "secondary rate limit") {
+		return backoff(attempt), true, true
+	}
+
+	return 0, false, false
+}
+
+// untilReset allows for clock skew between Derek and GitHub
+func untilReset(reset, now time.Time) time.Duration {
+	wait := reset.Sub(now) + time.Second
+	if wait < time.Second {
+		return time.Second
+	}
+	return wait
+}
+
+// backoff doubles from one second for each attempt
+func backoff(attempt int) time.Duration {
+	return time.Second << uint(attempt)
+}
+
+// addJitter adds up to a quarter of d, so that calls limited at the same
+// time do not all retry at once. The wait is never shortened, since GitHub
+// asks for at least that long.
+func addJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/4+1))
+}
+
+func sleepForRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
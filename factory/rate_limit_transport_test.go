@@ -0,0 +1,146 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/config"
+)
+
+func newTestRateLimitClient(maxWait time.Duration, slept *[]time.Duration) *http.Client {
+	transport := newRateLimitTransport(http.DefaultTransport, maxWait)
+	transport.jitter = func(d time.Duration) time.Duration { return d }
+	transport.sleep = func(req *http.Request, d time.Duration) error {
+		*slept = append(*slept, d)
+		return nil
+	}
+	return &http.Client{Transport: transport}
+}
+
+func Test_rateLimitTransport_RetriesSecondaryLimit(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"You have exceeded a secondary rate limit."}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	client := newTestRateLimitClient(time.Minute, &slept)
+
+	res, err := client.Get(server.URL + "/repos/alexellis/derek")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("want 2 calls, got: %d", calls)
+	}
+	if len(slept) != 1 || slept[0] != 3*time.Second {
+		t.Errorf("want one wait of 3s, got: %v", slept)
+	}
+}
+
+func Test_rateLimitTransport_BacksOffWithoutRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	client := newTestRateLimitClient(time.Minute, &slept)
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	want := []time.Duration{time.Second, 2 * time.Second}
+	if len(slept) != len(want) {
+		t.Fatalf("want waits: %v, got: %v", want, slept)
+	}
+	for i := range want {
+		if slept[i] != want[i] {
+			t.Errorf("want waits: %v, got: %v", want, slept)
+		}
+	}
+}
+
+func Test_rateLimitTransport_ExceedsBudget(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"API rate limit exceeded for installation ID 1."}`))
+	}))
+	defer server.Close()
+
+	client := MakeClient(context.Background(), "", config.Config{
+		APIBaseURL:       server.URL,
+		RateLimitMaxWait: 10 * time.Second,
+	})
+
+	_, _, err := client.Repositories.Get(context.Background(), "alexellis", "derek")
+
+	var rateErr *RateLimitExceededError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("want RateLimitExceededError, got: %v", err)
+	}
+	if rateErr.Secondary {
+		t.Errorf("want primary rate limit")
+	}
+	if rateErr.Wait < 59*time.Minute {
+		t.Errorf("want wait until reset, got: %s", rateErr.Wait)
+	}
+}
+
+func Test_rateLimitTransport_PassesOtherForbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	client := newTestRateLimitClient(time.Minute, &slept)
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("want status: %d, got: %d", http.StatusForbidden, res.StatusCode)
+	}
+	if len(slept) != 0 {
+		t.Errorf("want no retries, got: %v", slept)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// TokenSource gives the access token sent with each call to GitHub
+type TokenSource interface {
+	// Token returns the current access token, minting one if needed
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate discards the current access token, so that the next
+	// call to Token gives a new one
+	Invalidate()
+}
+
+// tokenTransport authenticates each call with the token from tokens, when
+// GitHub rejects the token with a 401 it is invalidated and the call is
+// retried once with a new token
+type tokenTransport struct {
+	tokens TokenSource
+	next   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.send(req, req.Body)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// The body has been read by the first attempt, so can only be
+	// sent again when the request can give a fresh copy of it.
+	body := req.Body
+	if body != nil {
+		if req.GetBody == nil {
+			return res, nil
+		}
+		if body, err = req.GetBody(); err != nil {
+			return res, nil
+		}
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	t.tokens.Invalidate()
+
+	return t.send(req, body)
+}
+
+// send makes the call with the current token on a copy of req, since
+// a RoundTripper must not modify the request it is given
+func (t *tokenTransport) send(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	token, err := t.tokens.Token(req.Context())
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, err
+	}
+
+	authorized := req.Clone(req.Context())
+	authorized.Body = body
+	authorized.Header.Set("Authorization", "Bearer "+token)
+
+	return t.next.RoundTrip(authorized)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+	"github.com/google/go-github/github"
+)
+
+type fakeTokenSource struct {
+	minted      int
+	invalidated int
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context) (string, error) {
+	if f.minted == f.invalidated {
+		f.minted++
+	}
+	return fmt.Sprintf("token-%d", f.minted), nil
+}
+
+func (f *fakeTokenSource) Invalidate() {
+	f.invalidated++
+}
+
+func Test_MakeInstallationClient_RetriesUnauthorizedWithNewToken(t *testing.T) {
+	var authorization []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		bodies = append(bodies, string(body))
+
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	tokens := &fakeTokenSource{}
+	client := MakeInstallationClient(context.Background(), tokens, config.Config{
+		APIBaseURL: server.URL,
+	})
+
+	body := "LGTM"
+	_, _, err := client.Issues.CreateComment(context.Background(), "alexellis", "derek", 1, &github.IssueComment{Body: &body})
+	if err != nil {
+		t.Fatalf("want retry with a new token to succeed, got: %s", err)
+	}
+
+	if tokens.invalidated != 1 {
+		t.Errorf("want rejected token to be invalidated once, got: %d", tokens.invalidated)
+	}
+	if len(authorization) != 2 || authorization[1] != "Bearer token-2" {
+		t.Fatalf("want retry with new token, got: %v", authorization)
+	}
+	if bodies[0] != bodies[1] || len(bodies[1]) == 0 {
+		t.Errorf("want body to be sent again, got: %q", bodies)
+	}
+}
+
+func Test_MakeInstallationClient_RetriesUnauthorizedOnce(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Bad credentials"}`))
+	}))
+	defer server.Close()
+
+	tokens := &fakeTokenSource{}
+	client := MakeInstallationClient(context.Background(), tokens, config.Config{
+		APIBaseURL: server.URL,
+	})
+
+	_, res, err := client.Repositories.Get(context.Background(), "alexellis", "derek")
+	if err == nil {
+		t.Fatalf("want an error when the new token is rejected too")
+	}
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want 401, got: %d", res.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("want 2 calls, got: %d", calls)
+	}
+}
@@ -0,0 +1,832 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package fakegithub is an in-memory fake of the parts of the GitHub API
+// which Derek uses, for running handlers without access to GitHub.
+package fakegithub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// Repo is the state of a fake repository, pull requests share their
+// number, labels and comments with the issue of the same number.
+type Repo struct {
+	Issues       map[int]*github.Issue
+	Comments     map[int][]*github.IssueComment
+	Milestones   []*github.Milestone
+	PullRequests map[int]*github.PullRequest
+	PRCommits    map[int][]*github.RepositoryCommit
+	PRFiles      map[int][]*github.CommitFile
+	Reviewers    map[int][]string
+	CheckRuns    []*github.CheckRun
+	Commits      []*github.RepositoryCommit
+	Releases     []*github.RepositoryRelease
+
+	// Files holds file contents by ref, then by path
+	Files map[string]map[string]string
+
+	// Annotations holds the annotations of each check run by its ID
+	Annotations map[int64][]types.CheckRunAnnotation
+}
+
+func newRepo() *Repo {
+	return &Repo{
+		Issues:       map[int]*github.Issue{},
+		Comments:     map[int][]*github.IssueComment{},
+		PullRequests: map[int]*github.PullRequest{},
+		PRCommits:    map[int][]*github.RepositoryCommit{},
+		PRFiles:      map[int][]*github.CommitFile{},
+		Reviewers:    map[int][]string{},
+		Files:        map[string]map[string]string{},
+		Annotations:  map[int64][]types.CheckRunAnnotation{},
+	}
+}
+
+// Call is a record of a call made to the fake
+type Call struct {
+	Method string
+	Owner  string
+	Repo   string
+	Number int
+	Args   string
+}
+
+func (c Call) String() string {
+	s := fmt.Sprintf("%s %s/%s", c.Method, c.Owner, c.Repo)
+	if c.Number > 0 {
+		s += fmt.Sprintf("#%d", c.Number)
+	}
+	if len(c.Args) > 0 {
+		s += " " + c.Args
+	}
+	return s
+}
+
+// Client holds the fake repositories and implements the Issues, PullRequests,
+// Checks and Repositories services against them. It is safe for concurrent use.
+type Client struct {
+	Issues       *IssuesService
+	PullRequests *PullRequestsService
+	Checks       *ChecksService
+	Repositories *RepositoriesService
+
+	mu     sync.Mutex
+	repos  map[string]*Repo
+	calls  []Call
+	nextID int64
+}
+
+// New creates a fake with no repositories
+func New() *Client {
+	c := &Client{
+		repos:  map[string]*Repo{},
+		nextID: 1000,
+	}
+	c.Issues = &IssuesService{c}
+	c.PullRequests = &PullRequestsService{c}
+	c.Checks = &ChecksService{c}
+	c.Repositories = &RepositoriesService{c}
+	return c
+}
+
+// Update gives fn the repository to change, creating it if needed
+func (c *Client) Update(owner, repo string, fn func(r *Repo)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fn(c.repo(owner, repo))
+}
+
+// AddIssue adds or replaces an issue
+func (c *Client) AddIssue(owner, repo string, issue *github.Issue) {
+	c.Update(owner, repo, func(r *Repo) {
+		r.Issues[issue.GetNumber()] = issue
+	})
+}
+
+// AddPullRequest adds or replaces a pull request along with its commits
+// and files, and an issue of the same number to hold labels and comments.
+func (c *Client) AddPullRequest(owner, repo string, pr *github.PullRequest, commits []*github.RepositoryCommit, files []*github.CommitFile) {
+	c.Update(owner, repo, func(r *Repo) {
+		number := pr.GetNumber()
+		r.PullRequests[number] = pr
+		r.PRCommits[number] = commits
+		r.PRFiles[number] = files
+		if _, ok := r.Issues[number]; !ok {
+			r.Issues[number] = &github.Issue{
+				Number: github.Int(number),
+				Title:  pr.Title,
+				Body:   pr.Body,
+				State:  pr.State,
+				User:   pr.User,
+			}
+		}
+	})
+}
+
+// AddFile adds or replaces the contents of a file at a ref
+func (c *Client) AddFile(owner, repo, ref, path, content string) {
+	c.Update(owner, repo, func(r *Repo) {
+		if r.Files[ref] == nil {
+			r.Files[ref] = map[string]string{}
+		}
+		r.Files[ref][path] = content
+	})
+}
+
+// CheckRunAnnotations returns the annotations given when a check run was created
+func (c *Client) CheckRunAnnotations(owner, repo string, checkRunID int64) []types.CheckRunAnnotation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]types.CheckRunAnnotation(nil), c.repo(owner, repo).Annotations[checkRunID]...)
+}
+
+// Issue returns a copy of an issue, or nil if it does not exist
+func (c *Client) Issue(owner, repo string, number int) *github.Issue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	issue, ok := c.repo(owner, repo).Issues[number]
+	if !ok {
+		return nil
+	}
+	copied := *issue
+	copied.Labels = append([]github.Label(nil), issue.Labels...)
+	copied.Assignees = append([]*github.User(nil), issue.Assignees...)
+	return &copied
+}
+
+// Labels returns the names of the labels on an issue or pull request
+func (c *Client) Labels(owner, repo string, number int) []string {
+	var names []string
+	if issue := c.Issue(owner, repo, number); issue != nil {
+		for _, l := range issue.Labels {
+			names = append(names, l.GetName())
+		}
+	}
+	return names
+}
+
+// Comments returns the bodies of the comments on an issue or pull request
+func (c *Client) Comments(owner, repo string, number int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var bodies []string
+	for _, comment := range c.repo(owner, repo).Comments[number] {
+		bodies = append(bodies, comment.GetBody())
+	}
+	return bodies
+}
+
+// Reviewers returns the reviewers requested on a pull request
+func (c *Client) Reviewers(owner, repo string, number int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.repo(owner, repo).Reviewers[number]...)
+}
+
+// CheckRuns returns copies of the check runs created in a repository
+func (c *Client) CheckRuns(owner, repo string) []github.CheckRun {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var runs []github.CheckRun
+	for _, run := range c.repo(owner, repo).CheckRuns {
+		runs = append(runs, *run)
+	}
+	return runs
+}
+
+// Release returns a copy of the release with the tag, or nil
+func (c *Client) Release(owner, repo, tag string) *github.RepositoryRelease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, release := range c.repo(owner, repo).Releases {
+		if release.GetTagName() == tag {
+			copied := *release
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Calls returns every call made so far, in order
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// Mutations returns the calls which would have changed GitHub
+func (c *Client) Mutations() []Call {
+	var mutations []Call
+	for _, call := range c.Calls() {
+		if !isRead(call.Method) {
+			mutations = append(mutations, call)
+		}
+	}
+	return mutations
+}
+
+func isRead(method string) bool {
+	name := method[strings.Index(method, ".")+1:]
+	return strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List")
+}
+
+// repo must be called with mu held
+func (c *Client) repo(owner, name string) *Repo {
+	key := strings.ToLower(owner + "/" + name)
+	r, ok := c.repos[key]
+	if !ok {
+		r = newRepo()
+		c.repos[key] = r
+	}
+	return r
+}
+
+// record must be called with mu held
+func (c *Client) record(method, owner, repo string, number int, args ...interface{}) {
+	var parts []string
+	for _, a := range args {
+		parts = append(parts, fmt.Sprint(a))
+	}
+	c.calls = append(c.calls, Call{
+		Method: method,
+		Owner:  owner,
+		Repo:   repo,
+		Number: number,
+		Args:   strings.Join(parts, " "),
+	})
+}
+
+// issue must be called with mu held
+func (c *Client) issue(owner, repo string, number int) (*github.Issue, error) {
+	issue, ok := c.repo(owner, repo).Issues[number]
+	if !ok {
+		return nil, notFound(fmt.Sprintf("repos/%s/%s/issues/%d", owner, repo, number))
+	}
+	return issue, nil
+}
+
+func (c *Client) id() int64 {
+	c.nextID++
+	return c.nextID
+}
+
+func newResponse(status int) *github.Response {
+	return &github.Response{
+		Response: &http.Response{
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		},
+		Rate: github.Rate{Limit: 5000, Remaining: 5000},
+	}
+}
+
+func notFound(path string) error {
+	resp := newResponse(http.StatusNotFound)
+	resp.Request, _ = http.NewRequest(http.MethodGet, "https://api.github.com/"+path, nil)
+	return &github.ErrorResponse{Response: resp.Response, Message: "Not Found"}
+}
+
+// IssuesService fakes the Issues API
+type IssuesService struct {
+	c *Client
+}
+
+// Get returns an issue or pull request
+func (s *IssuesService) Get(ctx context.Context, owner string, repo string, number int) (*github.Issue, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.Get", owner, repo, number)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+	copied := *issue
+	return &copied, newResponse(http.StatusOK), nil
+}
+
+// Edit changes the title, body, state or milestone of an issue
+func (s *IssuesService) Edit(ctx context.Context, owner string, repo string, number int, input *github.IssueRequest) (*github.Issue, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.Edit", owner, repo, number, describeIssueRequest(input))
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+
+	if input.Title != nil {
+		issue.Title = input.Title
+	}
+	if input.Body != nil {
+		issue.Body = input.Body
+	}
+	if input.State != nil {
+		// GitHub accepts "close" as well as "closed"
+		state := *input.State
+		if state == "close" {
+			state = "closed"
+		}
+		issue.State = &state
+	}
+	if input.Milestone != nil {
+		for _, m := range s.c.repo(owner, repo).Milestones {
+			if m.GetNumber() == *input.Milestone {
+				issue.Milestone = m
+			}
+		}
+	}
+
+	copied := *issue
+	return &copied, newResponse(http.StatusOK), nil
+}
+
+// RemoveMilestone clears the milestone of an issue
+func (s *IssuesService) RemoveMilestone(ctx context.Context, owner string, repo string, number int) (*github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.RemoveMilestone", owner, repo, number)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return newResponse(http.StatusNotFound), err
+	}
+	issue.Milestone = nil
+	return newResponse(http.StatusOK), nil
+}
+
+// AddLabelsToIssue adds any labels which are not already present
+func (s *IssuesService) AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.AddLabelsToIssue", owner, repo, number, labels)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+
+	for _, name := range labels {
+		found := false
+		for _, l := range issue.Labels {
+			if strings.EqualFold(l.GetName(), name) {
+				found = true
+			}
+		}
+		if !found {
+			issue.Labels = append(issue.Labels, github.Label{Name: github.String(name)})
+		}
+	}
+
+	var out []*github.Label
+	for i := range issue.Labels {
+		l := issue.Labels[i]
+		out = append(out, &l)
+	}
+	return out, newResponse(http.StatusOK), nil
+}
+
+// RemoveLabelForIssue removes a label, giving a 404 if it is not present
+func (s *IssuesService) RemoveLabelForIssue(ctx context.Context, owner string, repo string, number int, label string) (*github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.RemoveLabelForIssue", owner, repo, number, label)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return newResponse(http.StatusNotFound), err
+	}
+
+	for i, l := range issue.Labels {
+		if strings.EqualFold(l.GetName(), label) {
+			issue.Labels = append(issue.Labels[:i], issue.Labels[i+1:]...)
+			return newResponse(http.StatusOK), nil
+		}
+	}
+	return newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/issues/%d/labels/%s", owner, repo, number, label))
+}
+
+// AddAssignees adds users to the assignees of an issue
+func (s *IssuesService) AddAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.AddAssignees", owner, repo, number, assignees)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+
+	for _, login := range assignees {
+		found := false
+		for _, u := range issue.Assignees {
+			if u.GetLogin() == login {
+				found = true
+			}
+		}
+		if !found {
+			issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(login)})
+		}
+	}
+
+	copied := *issue
+	return &copied, newResponse(http.StatusCreated), nil
+}
+
+// RemoveAssignees removes users from the assignees of an issue
+func (s *IssuesService) RemoveAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.RemoveAssignees", owner, repo, number, assignees)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+
+	var kept []*github.User
+	for _, u := range issue.Assignees {
+		if !contains(assignees, u.GetLogin()) {
+			kept = append(kept, u)
+		}
+	}
+	issue.Assignees = kept
+
+	copied := *issue
+	return &copied, newResponse(http.StatusOK), nil
+}
+
+// Lock locks the conversation on an issue
+func (s *IssuesService) Lock(ctx context.Context, owner string, repo string, number int, opt *github.LockIssueOptions) (*github.Response, error) {
+	return s.setLocked("Issues.Lock", owner, repo, number, true)
+}
+
+// Unlock unlocks the conversation on an issue
+func (s *IssuesService) Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response, error) {
+	return s.setLocked("Issues.Unlock", owner, repo, number, false)
+}
+
+func (s *IssuesService) setLocked(method, owner, repo string, number int, locked bool) (*github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record(method, owner, repo, number)
+	issue, err := s.c.issue(owner, repo, number)
+	if err != nil {
+		return newResponse(http.StatusNotFound), err
+	}
+	issue.Locked = github.Bool(locked)
+	return newResponse(http.StatusNoContent), nil
+}
+
+// ListMilestones returns the milestones of a repository
+func (s *IssuesService) ListMilestones(ctx context.Context, owner string, repo string, opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.ListMilestones", owner, repo, 0)
+	return append([]*github.Milestone(nil), s.c.repo(owner, repo).Milestones...), newResponse(http.StatusOK), nil
+}
+
+// CreateComment adds a comment to an issue or pull request
+func (s *IssuesService) CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Issues.CreateComment", owner, repo, number, comment.GetBody())
+	if _, err := s.c.issue(owner, repo, number); err != nil {
+		return nil, newResponse(http.StatusNotFound), err
+	}
+
+	now := time.Now()
+	created := &github.IssueComment{
+		ID:        github.Int64(s.c.id()),
+		Body:      comment.Body,
+		CreatedAt: &now,
+	}
+	r := s.c.repo(owner, repo)
+	r.Comments[number] = append(r.Comments[number], created)
+	return created, newResponse(http.StatusCreated), nil
+}
+
+// PullRequestsService fakes the Pull Requests API
+type PullRequestsService struct {
+	c *Client
+}
+
+// List returns pull requests filtered by state and base, ordered by number
+func (s *PullRequestsService) List(ctx context.Context, owner string, repo string, opt *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("PullRequests.List", owner, repo, 0)
+
+	var prs []*github.PullRequest
+	for _, pr := range s.c.repo(owner, repo).PullRequests {
+		if opt != nil && len(opt.State) > 0 && opt.State != "all" && opt.State != pr.GetState() {
+			continue
+		}
+		if opt != nil && len(opt.Base) > 0 && pr.Base != nil && pr.Base.GetRef() != opt.Base {
+			continue
+		}
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].GetNumber() > prs[j].GetNumber()
+	})
+	return prs, newResponse(http.StatusOK), nil
+}
+
+// ListCommits returns the commits of a pull request
+func (s *PullRequestsService) ListCommits(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("PullRequests.ListCommits", owner, repo, number)
+	r := s.c.repo(owner, repo)
+	if _, ok := r.PullRequests[number]; !ok {
+		return nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/pulls/%d/commits", owner, repo, number))
+	}
+	return r.PRCommits[number], newResponse(http.StatusOK), nil
+}
+
+// ListFiles returns the files changed by a pull request
+func (s *PullRequestsService) ListFiles(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("PullRequests.ListFiles", owner, repo, number)
+	r := s.c.repo(owner, repo)
+	if _, ok := r.PullRequests[number]; !ok {
+		return nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/pulls/%d/files", owner, repo, number))
+	}
+	return r.PRFiles[number], newResponse(http.StatusOK), nil
+}
+
+// RequestReviewers adds requested reviewers to a pull request
+func (s *PullRequestsService) RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("PullRequests.RequestReviewers", owner, repo, number, reviewers.Reviewers)
+	r := s.c.repo(owner, repo)
+	pr, ok := r.PullRequests[number]
+	if !ok {
+		return nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, number))
+	}
+	for _, login := range reviewers.Reviewers {
+		if !contains(r.Reviewers[number], login) {
+			r.Reviewers[number] = append(r.Reviewers[number], login)
+		}
+	}
+	return pr, newResponse(http.StatusCreated), nil
+}
+
+// RemoveReviewers removes requested reviewers from a pull request
+func (s *PullRequestsService) RemoveReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("PullRequests.RemoveReviewers", owner, repo, number, reviewers.Reviewers)
+	r := s.c.repo(owner, repo)
+	if _, ok := r.PullRequests[number]; !ok {
+		return newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, number))
+	}
+	var kept []string
+	for _, login := range r.Reviewers[number] {
+		if !contains(reviewers.Reviewers, login) {
+			kept = append(kept, login)
+		}
+	}
+	r.Reviewers[number] = kept
+	return newResponse(http.StatusOK), nil
+}
+
+// ChecksService fakes the Checks API
+type ChecksService struct {
+	c *Client
+}
+
+// ListCheckRunsForRef returns the check runs for a commit, filtered by name
+func (s *ChecksService) ListCheckRunsForRef(ctx context.Context, owner, repo, ref string, opt *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Checks.ListCheckRunsForRef", owner, repo, 0, ref)
+
+	results := &github.ListCheckRunsResults{}
+	for _, run := range s.c.repo(owner, repo).CheckRuns {
+		if run.GetHeadSHA() != ref {
+			continue
+		}
+		if opt != nil && opt.CheckName != nil && run.GetName() != *opt.CheckName {
+			continue
+		}
+		copied := *run
+		results.CheckRuns = append(results.CheckRuns, &copied)
+	}
+	results.Total = github.Int(len(results.CheckRuns))
+	return results, newResponse(http.StatusOK), nil
+}
+
+// CreateCheckRun creates a check run
+func (s *ChecksService) CreateCheckRun(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Checks.CreateCheckRun", owner, repo, 0, opt.Name, opt.GetConclusion())
+	return s.createCheckRun(owner, repo, opt)
+}
+
+// CreateCheckRunWithAnnotations creates a check run, keeping its annotations
+func (s *ChecksService) CreateCheckRunWithAnnotations(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions, annotations []types.CheckRunAnnotation) (*github.CheckRun, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Checks.CreateCheckRunWithAnnotations", owner, repo, 0, opt.Name, opt.GetConclusion(), len(annotations))
+
+	run, res, err := s.createCheckRun(owner, repo, opt)
+	s.c.repo(owner, repo).Annotations[run.GetID()] = append([]types.CheckRunAnnotation(nil), annotations...)
+	return run, res, err
+}
+
+func (s *ChecksService) createCheckRun(owner, repo string, opt github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	run := &github.CheckRun{
+		ID:          github.Int64(s.c.id()),
+		Name:        github.String(opt.Name),
+		HeadSHA:     github.String(opt.HeadSHA),
+		Status:      opt.Status,
+		Conclusion:  opt.Conclusion,
+		StartedAt:   opt.StartedAt,
+		CompletedAt: opt.CompletedAt,
+		Output:      opt.Output,
+	}
+	r := s.c.repo(owner, repo)
+	r.CheckRuns = append(r.CheckRuns, run)
+
+	copied := *run
+	return &copied, newResponse(http.StatusCreated), nil
+}
+
+// UpdateCheckRun updates a check run
+func (s *ChecksService) UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opt github.UpdateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Checks.UpdateCheckRun", owner, repo, 0, checkRunID, opt.GetConclusion())
+
+	for _, run := range s.c.repo(owner, repo).CheckRuns {
+		if run.GetID() == checkRunID {
+			run.Name = github.String(opt.Name)
+			if opt.Status != nil {
+				run.Status = opt.Status
+			}
+			if opt.Conclusion != nil {
+				run.Conclusion = opt.Conclusion
+			}
+			if opt.CompletedAt != nil {
+				run.CompletedAt = opt.CompletedAt
+			}
+			if opt.Output != nil {
+				run.Output = opt.Output
+			}
+			copied := *run
+			return &copied, newResponse(http.StatusOK), nil
+		}
+	}
+	return nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/check-runs/%d", owner, repo, checkRunID))
+}
+
+// RepositoriesService fakes the Repositories API
+type RepositoriesService struct {
+	c *Client
+}
+
+// GetContents returns a file added with AddFile, directories are not supported
+func (s *RepositoriesService) GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	var ref string
+	if opt != nil {
+		ref = opt.Ref
+	}
+	s.c.record("Repositories.GetContents", owner, repo, 0, path, ref)
+
+	content, ok := s.c.repo(owner, repo).Files[ref][path]
+	if !ok {
+		return nil, nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/contents/%s", owner, repo, path))
+	}
+
+	file := &github.RepositoryContent{
+		Type:    github.String("file"),
+		Name:    github.String(path[strings.LastIndex(path, "/")+1:]),
+		Path:    github.String(path),
+		Size:    github.Int(len(content)),
+		Content: github.String(content),
+	}
+	return file, nil, newResponse(http.StatusOK), nil
+}
+
+// ListCommits returns the commits of the repository within Since and Until
+func (s *RepositoriesService) ListCommits(ctx context.Context, owner, repo string, opt *github.CommitsListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Repositories.ListCommits", owner, repo, 0)
+
+	var commits []*github.RepositoryCommit
+	for _, commit := range s.c.repo(owner, repo).Commits {
+		date := commit.GetCommit().GetCommitter().GetDate()
+		if opt != nil && !opt.Since.IsZero() && date.Before(opt.Since) {
+			continue
+		}
+		if opt != nil && !opt.Until.IsZero() && date.After(opt.Until) {
+			continue
+		}
+		commits = append(commits, commit)
+	}
+	return commits, newResponse(http.StatusOK), nil
+}
+
+// ListReleases returns the releases of a repository, newest first
+func (s *RepositoriesService) ListReleases(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Repositories.ListReleases", owner, repo, 0)
+
+	releases := append([]*github.RepositoryRelease(nil), s.c.repo(owner, repo).Releases...)
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].GetCreatedAt().After(releases[j].GetCreatedAt().Time)
+	})
+	return releases, newResponse(http.StatusOK), nil
+}
+
+// EditRelease updates the name and body of a release
+func (s *RepositoriesService) EditRelease(ctx context.Context, owner, repo string, id int64, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.record("Repositories.EditRelease", owner, repo, 0, id)
+
+	for _, r := range s.c.repo(owner, repo).Releases {
+		if r.GetID() == id {
+			if release.Name != nil {
+				r.Name = release.Name
+			}
+			if release.Body != nil {
+				r.Body = release.Body
+			}
+			copied := *r
+			return &copied, newResponse(http.StatusOK), nil
+		}
+	}
+	return nil, newResponse(http.StatusNotFound), notFound(fmt.Sprintf("repos/%s/%s/releases/%d", owner, repo, id))
+}
+
+func describeIssueRequest(input *github.IssueRequest) string {
+	var parts []string
+	if input.Title != nil {
+		parts = append(parts, "title="+*input.Title)
+	}
+	if input.State != nil {
+		parts = append(parts, "state="+*input.State)
+	}
+	if input.Milestone != nil {
+		parts = append(parts, fmt.Sprintf("milestone=%d", *input.Milestone))
+	}
+	return strings.Join(parts, " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
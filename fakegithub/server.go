@@ -0,0 +1,392 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package fakegithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// Server serves a Client over HTTP with the same paths as the GitHub
+// REST API, so a real go-github client can be pointed at it.
+type Server struct {
+	*httptest.Server
+
+	Fake *Client
+}
+
+// NewServer starts a Server for the fake, call Close when done
+func NewServer(fake *Client) *Server {
+	s := &Server{Fake: fake}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// GitHubClient returns a go-github client which talks to the server
+func (s *Server) GitHubClient() *github.Client {
+	client := github.NewClient(s.Server.Client())
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
+
+// ServeHTTP routes /repos/:owner/:repo/... requests to the fake
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "repos" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	route := &request{
+		ctx:   r.Context(),
+		r:     r,
+		w:     w,
+		owner: parts[1],
+		repo:  parts[2],
+		path:  parts[3:],
+	}
+
+	switch parts[3] {
+	case "issues":
+		s.issues(route)
+	case "milestones":
+		s.milestones(route)
+	case "pulls":
+		s.pulls(route)
+	case "check-runs", "commits":
+		s.commits(route)
+	case "releases":
+		s.releases(route)
+	case "contents":
+		s.contents(route)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+type request struct {
+	ctx   context.Context
+	r     *http.Request
+	w     http.ResponseWriter
+	owner string
+	repo  string
+	path  []string
+}
+
+// is returns true when the method matches and the path, after
+// :owner/:repo, matches the pattern where "*" matches any segment
+func (r *request) is(method string, pattern ...string) bool {
+	if r.r.Method != method || len(r.path) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != r.path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *request) number(i int) (int, bool) {
+	n, err := strconv.Atoi(r.path[i])
+	if err != nil {
+		writeError(r.w, http.StatusNotFound, "Not Found")
+		return 0, false
+	}
+	return n, true
+}
+
+func (r *request) decode(v interface{}) bool {
+	if err := json.NewDecoder(r.r.Body).Decode(v); err != nil {
+		writeError(r.w, http.StatusBadRequest, fmt.Sprintf("Problems parsing JSON: %s", err))
+		return false
+	}
+	return true
+}
+
+// reply writes v, or the status and message of err
+func (r *request) reply(status int, v interface{}, err error) {
+	if err != nil {
+		if errResp, ok := err.(*github.ErrorResponse); ok {
+			writeError(r.w, errResp.Response.StatusCode, errResp.Message)
+			return
+		}
+		writeError(r.w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	r.w.Header().Set("Content-Type", "application/json")
+	r.w.WriteHeader(status)
+	if v != nil {
+		json.NewEncoder(r.w).Encode(v)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (s *Server) issues(r *request) {
+	issues := s.Fake.Issues
+
+	if len(r.path) < 2 {
+		writeError(r.w, http.StatusNotFound, "Not Found")
+		return
+	}
+	number, ok := r.number(1)
+	if !ok {
+		return
+	}
+
+	switch {
+	case r.is(http.MethodGet, "issues", "*"):
+		issue, resp, err := issues.Get(r.ctx, r.owner, r.repo, number)
+		r.reply(resp.StatusCode, issue, err)
+
+	case r.is(http.MethodPatch, "issues", "*"):
+		// a null milestone is how GitHub removes the milestone
+		var fields map[string]json.RawMessage
+		if !r.decode(&fields) {
+			return
+		}
+		if m, ok := fields["milestone"]; ok && string(m) == "null" {
+			resp, err := issues.RemoveMilestone(r.ctx, r.owner, r.repo, number)
+			if err != nil || len(fields) == 1 {
+				issue, _, _ := issues.Get(r.ctx, r.owner, r.repo, number)
+				r.reply(resp.StatusCode, issue, err)
+				return
+			}
+			delete(fields, "milestone")
+		}
+
+		input := &github.IssueRequest{}
+		raw, _ := json.Marshal(fields)
+		json.Unmarshal(raw, input)
+
+		issue, resp, err := issues.Edit(r.ctx, r.owner, r.repo, number, input)
+		r.reply(resp.StatusCode, issue, err)
+
+	case r.is(http.MethodPost, "issues", "*", "labels"):
+		var labels []string
+		if !r.decode(&labels) {
+			return
+		}
+		out, resp, err := issues.AddLabelsToIssue(r.ctx, r.owner, r.repo, number, labels)
+		r.reply(resp.StatusCode, out, err)
+
+	case r.is(http.MethodDelete, "issues", "*", "labels", "*"):
+		resp, err := issues.RemoveLabelForIssue(r.ctx, r.owner, r.repo, number, r.path[3])
+		r.reply(resp.StatusCode, nil, err)
+
+	case r.is(http.MethodPost, "issues", "*", "assignees"), r.is(http.MethodDelete, "issues", "*", "assignees"):
+		var body struct {
+			Assignees []string `json:"assignees"`
+		}
+		if !r.decode(&body) {
+			return
+		}
+		add := issues.AddAssignees
+		if r.r.Method == http.MethodDelete {
+			add = issues.RemoveAssignees
+		}
+		issue, resp, err := add(r.ctx, r.owner, r.repo, number, body.Assignees)
+		r.reply(resp.StatusCode, issue, err)
+
+	case r.is(http.MethodPut, "issues", "*", "lock"):
+		resp, err := issues.Lock(r.ctx, r.owner, r.repo, number, nil)
+		r.reply(resp.StatusCode, nil, err)
+
+	case r.is(http.MethodDelete, "issues", "*", "lock"):
+		resp, err := issues.Unlock(r.ctx, r.owner, r.repo, number)
+		r.reply(resp.StatusCode, nil, err)
+
+	case r.is(http.MethodPost, "issues", "*", "comments"):
+		comment := &github.IssueComment{}
+		if !r.decode(comment) {
+			return
+		}
+		created, resp, err := issues.CreateComment(r.ctx, r.owner, r.repo, number, comment)
+		r.reply(resp.StatusCode, created, err)
+
+	default:
+		writeError(r.w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) milestones(r *request) {
+	if !r.is(http.MethodGet, "milestones") {
+		writeError(r.w, http.StatusNotFound, "Not Found")
+		return
+	}
+	milestones, resp, err := s.Fake.Issues.ListMilestones(r.ctx, r.owner, r.repo, nil)
+	r.reply(resp.StatusCode, milestones, err)
+}
+
+func (s *Server) pulls(r *request) {
+	pulls := s.Fake.PullRequests
+
+	if r.is(http.MethodGet, "pulls") {
+		query := r.r.URL.Query()
+		opts := &github.PullRequestListOptions{
+			State: query.Get("state"),
+			Base:  query.Get("base"),
+		}
+		prs, resp, err := pulls.List(r.ctx, r.owner, r.repo, opts)
+		r.reply(resp.StatusCode, prs, err)
+		return
+	}
+
+	if len(r.path) < 3 {
+		writeError(r.w, http.StatusNotFound, "Not Found")
+		return
+	}
+	number, ok := r.number(1)
+	if !ok {
+		return
+	}
+
+	switch {
+	case r.is(http.MethodGet, "pulls", "*", "commits"):
+		commits, resp, err := pulls.ListCommits(r.ctx, r.owner, r.repo, number, nil)
+		r.reply(resp.StatusCode, commits, err)
+
+	case r.is(http.MethodGet, "pulls", "*", "files"):
+		files, resp, err := pulls.ListFiles(r.ctx, r.owner, r.repo, number, nil)
+		r.reply(resp.StatusCode, files, err)
+
+	case r.is(http.MethodPost, "pulls", "*", "requested_reviewers"):
+		reviewers := github.ReviewersRequest{}
+		if !r.decode(&reviewers) {
+			return
+		}
+		pr, resp, err := pulls.RequestReviewers(r.ctx, r.owner, r.repo, number, reviewers)
+		r.reply(resp.StatusCode, pr, err)
+
+	case r.is(http.MethodDelete, "pulls", "*", "requested_reviewers"):
+		reviewers := github.ReviewersRequest{}
+		if !r.decode(&reviewers) {
+			return
+		}
+		resp, err := pulls.RemoveReviewers(r.ctx, r.owner, r.repo, number, reviewers)
+		r.reply(resp.StatusCode, nil, err)
+
+	default:
+		writeError(r.w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) commits(r *request) {
+	checks := s.Fake.Checks
+
+	switch {
+	case r.is(http.MethodGet, "commits"):
+		opts := &github.CommitsListOptions{}
+		query := r.r.URL.Query()
+		opts.Since, _ = time.Parse(time.RFC3339, query.Get("since"))
+		opts.Until, _ = time.Parse(time.RFC3339, query.Get("until"))
+
+		commits, resp, err := s.Fake.Repositories.ListCommits(r.ctx, r.owner, r.repo, opts)
+		r.reply(resp.StatusCode, commits, err)
+
+	case r.is(http.MethodGet, "commits", "*", "check-runs"):
+		opts := &github.ListCheckRunsOptions{}
+		if name := r.r.URL.Query().Get("check_name"); len(name) > 0 {
+			opts.CheckName = &name
+		}
+		results, resp, err := checks.ListCheckRunsForRef(r.ctx, r.owner, r.repo, r.path[1], opts)
+		r.reply(resp.StatusCode, results, err)
+
+	case r.is(http.MethodPost, "check-runs"):
+		body := struct {
+			github.CreateCheckRunOptions
+			Output *struct {
+				github.CheckRunOutput
+				Annotations []types.CheckRunAnnotation `json:"annotations"`
+			} `json:"output,omitempty"`
+		}{}
+		if !r.decode(&body) {
+			return
+		}
+		opts := body.CreateCheckRunOptions
+		if body.Output == nil {
+			run, resp, err := checks.CreateCheckRun(r.ctx, r.owner, r.repo, opts)
+			r.reply(resp.StatusCode, run, err)
+			return
+		}
+
+		output := body.Output.CheckRunOutput
+		opts.Output = &output
+		run, resp, err := checks.CreateCheckRunWithAnnotations(r.ctx, r.owner, r.repo, opts, body.Output.Annotations)
+		r.reply(resp.StatusCode, run, err)
+
+	case r.is(http.MethodPatch, "check-runs", "*"):
+		id, err := strconv.ParseInt(r.path[1], 10, 64)
+		if err != nil {
+			writeError(r.w, http.StatusNotFound, "Not Found")
+			return
+		}
+		opts := github.UpdateCheckRunOptions{}
+		if !r.decode(&opts) {
+			return
+		}
+		run, resp, err := checks.UpdateCheckRun(r.ctx, r.owner, r.repo, id, opts)
+		r.reply(resp.StatusCode, run, err)
+
+	default:
+		writeError(r.w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) contents(r *request) {
+	if r.r.Method != http.MethodGet || len(r.path) < 2 {
+		writeError(r.w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	path := strings.Join(r.path[1:], "/")
+	opts := &github.RepositoryContentGetOptions{Ref: r.r.URL.Query().Get("ref")}
+	file, _, resp, err := s.Fake.Repositories.GetContents(r.ctx, r.owner, r.repo, path, opts)
+	if err == nil && strings.HasSuffix(r.r.Header.Get("Accept"), ".raw") {
+		r.w.WriteHeader(resp.StatusCode)
+		r.w.Write([]byte(*file.Content))
+		return
+	}
+	r.reply(resp.StatusCode, file, err)
+}
+
+func (s *Server) releases(r *request) {
+	switch {
+	case r.is(http.MethodGet, "releases"):
+		releases, resp, err := s.Fake.Repositories.ListReleases(r.ctx, r.owner, r.repo, nil)
+		r.reply(resp.StatusCode, releases, err)
+
+	case r.is(http.MethodPatch, "releases", "*"):
+		id, err := strconv.ParseInt(r.path[1], 10, 64)
+		if err != nil {
+			writeError(r.w, http.StatusNotFound, "Not Found")
+			return
+		}
+		release := &github.RepositoryRelease{}
+		if !r.decode(release) {
+			return
+		}
+		updated, resp, err := s.Fake.Repositories.EditRelease(r.ctx, r.owner, r.repo, id, release)
+		r.reply(resp.StatusCode, updated, err)
+
+	default:
+		writeError(r.w, http.StatusNotFound, "Not Found")
+	}
+}
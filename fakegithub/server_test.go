@@ -0,0 +1,124 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package fakegithub
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_Server_Issues(t *testing.T) {
+	fake := New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{
+		Number: github.Int(1),
+		Title:  github.String("Add docs"),
+		State:  github.String("open"),
+		Labels: []github.Label{{Name: github.String("bug")}},
+	})
+
+	server := NewServer(fake)
+	defer server.Close()
+
+	client := server.GitHubClient()
+	ctx := context.Background()
+
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, "alexellis", "derek", 1, []string{"docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Issues.RemoveLabelForIssue(ctx, "alexellis", "derek", 1, "bug"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Issues.CreateComment(ctx, "alexellis", "derek", 1, &github.IssueComment{Body: github.String("Thanks")}); err != nil {
+		t.Fatal(err)
+	}
+	closed := "closed"
+	if _, _, err := client.Issues.Edit(ctx, "alexellis", "derek", 1, &github.IssueRequest{State: &closed}); err != nil {
+		t.Fatal(err)
+	}
+
+	issue, _, err := client.Issues.Get(ctx, "alexellis", "derek", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue.GetState() != "closed" {
+		t.Errorf("want state closed, got: %q", issue.GetState())
+	}
+	if want, got := []string{"docs"}, fake.Labels("alexellis", "derek", 1); !reflect.DeepEqual(want, got) {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+	if want, got := []string{"Thanks"}, fake.Comments("alexellis", "derek", 1); !reflect.DeepEqual(want, got) {
+		t.Errorf("want comments: %v, got: %v", want, got)
+	}
+	if got := len(fake.Mutations()); got != 4 {
+		t.Errorf("want 4 mutations, got: %d %v", got, fake.Mutations())
+	}
+}
+
+func Test_Server_NotFound(t *testing.T) {
+	server := NewServer(New())
+	defer server.Close()
+
+	_, resp, err := server.GitHubClient().Issues.Get(context.Background(), "alexellis", "derek", 404)
+	if err == nil {
+		t.Fatal("want an error for a missing issue")
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("want status: %d, got: %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func Test_Server_ChecksAndReleases(t *testing.T) {
+	fake := New()
+	created := github.Timestamp{Time: time.Now()}
+	fake.Update("alexellis", "derek", func(r *Repo) {
+		r.Releases = []*github.RepositoryRelease{
+			{ID: github.Int64(1), TagName: github.String("0.1.0"), CreatedAt: &created},
+		}
+	})
+
+	server := NewServer(fake)
+	defer server.Close()
+
+	client := server.GitHubClient()
+	ctx := context.Background()
+
+	conclusion := "success"
+	run, _, err := client.Checks.CreateCheckRun(ctx, "alexellis", "derek", github.CreateCheckRunOptions{
+		Name:       "DCO",
+		HeadSHA:    "abc123",
+		Conclusion: &conclusion,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "DCO"
+	results, _, err := client.Checks.ListCheckRunsForRef(ctx, "alexellis", "derek", "abc123", &github.ListCheckRunsOptions{CheckName: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.GetTotal() != 1 || results.CheckRuns[0].GetID() != run.GetID() {
+		t.Errorf("want the created check run, got: %v", results)
+	}
+
+	releases, _, err := client.Repositories.ListReleases(ctx, "alexellis", "derek", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("want 1 release, got: %d", len(releases))
+	}
+
+	if _, _, err := client.Repositories.EditRelease(ctx, "alexellis", "derek", releases[0].GetID(), &github.RepositoryRelease{Body: github.String("Changelog")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Release("alexellis", "derek", "0.1.0").GetBody(); got != "Changelog" {
+		t.Errorf("want release body updated, got: %q", got)
+	}
+}
@@ -4,19 +4,19 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
-	"github.com/alexellis/derek/auth"
 	"github.com/alexellis/derek/config"
 	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/metrics"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -42,52 +42,59 @@ const (
 	labelLimitEnvVar  string = "multilabel_limit"
 )
 
-func makeClient(installation int, config config.Config) (*github.Client, context.Context) {
-	ctx := context.Background()
-
-	token := os.Getenv("personal_access_token")
-	if len(token) == 0 {
+func makeClient(ctx context.Context, installation int, config config.Config) (*github.Client, error) {
+	if token := os.Getenv("personal_access_token"); len(token) > 0 {
+		return factory.MakeClient(ctx, token, config), nil
+	}
 
-		newToken, tokenErr := auth.MakeAccessTokenForInstallation(config.ApplicationID, installation, config.PrivateKey)
-		if tokenErr != nil {
-			log.Fatalln(tokenErr.Error())
-		}
+	tokens := &installationTokenSource{
+		cache:        installationTokens(config),
+		config:       config,
+		installation: installation,
+	}
 
-		token = newToken
+	// Mint the token up front so that a failure is reported here,
+	// rather than by the first call made with the client.
+	if _, tokenErr := tokens.Token(ctx); tokenErr != nil {
+		return nil, fmt.Errorf("error getting installation token: %s", tokenErr.Error())
 	}
 
-	client := factory.MakeClient(ctx, token, config)
+	client := factory.MakeInstallationClient(ctx, tokens, config)
 
-	return client, ctx
+	return client, nil
 }
 
 // HandleComment handles a comment
-func HandleComment(req types.IssueCommentOuter, config config.Config, derekConfig *types.DerekRepoConfig) {
+func HandleComment(ctx context.Context, client *GitHub, req types.IssueCommentOuter, derekConfig *types.DerekRepoConfig) *Result {
+	result := NewResult(commentsFeature)
+	feedback := &commentFeedback{log: logging.FromContext(ctx), result: result}
 
-	var feedback string
 	var err error
 
 	command := parse(req.Comment.Body, getCommandTriggers())
+	if len(command.Type) > 0 {
+		metrics.CommandsParsed.Inc(command.Type)
+	}
 
 	switch command.Type {
 
 	case addLabelConstant, removeLabelConstant:
-		feedback, err = manageLabel(req, command.Type, command.Value, config)
+		err = manageLabel(ctx, client, req, command.Type, command.Value, feedback)
 
 	case assignConstant, unassignConstant:
-		feedback, err = manageAssignment(req, command.Type, command.Value, config)
+		err = manageAssignment(ctx, client, req, command.Type, command.Value, feedback)
 
 	case closeConstant, reopenConstant:
-		feedback, err = manageState(req, command.Type, config)
+		err = manageState(ctx, client, req, command.Type, feedback)
 
 	case setTitleConstant:
-		feedback, err = manageTitle(req, command.Type, command.Value, config)
+		err = manageTitle(ctx, client, req, command.Type, command.Value, feedback)
 
 	case lockConstant, unlockConstant:
-		feedback, err = manageLocking(req, command.Type, config)
+		err = manageLocking(ctx, client, req, command.Type, feedback)
 
 	case setMilestoneConstant, removeMilestoneConstant:
-		feedback, err = updateMilestone(req, command.Type, command.Value, config)
+		err = updateMilestone(ctx, client, req, command.Type, command.Value, feedback)
 
 	case assignReviewerConstant, unassignReviewerConstant:
 		pr := types.PullRequest{
@@ -99,30 +106,48 @@ func HandleComment(req types.IssueCommentOuter, config config.Config, derekConfi
 			Action:              req.Action,
 			InstallationRequest: req.InstallationRequest,
 		}
-		feedback, err = editReviewers(prReq, command.Type, command.Value, config)
+		err = editReviewers(ctx, client, prReq, command.Type, command.Value, feedback)
 
 	case messageConstant:
-		feedback, err = createMessage(req, command.Type, command.Value, config, derekConfig)
+		err = createMessage(ctx, client, req, command.Type, command.Value, derekConfig, feedback)
 
 	default:
-		feedback = "No command found in comment\n"
-
 		if strings.HasPrefix(req.Comment.Body, "Derek ") || strings.HasPrefix(req.Comment.Body, "/") {
-			feedback = fmt.Sprintf("Unable to work with command: %q\n", req.Comment.Body)
+			result.Skip("Unable to work with command: %q", req.Comment.Body)
+		} else {
+			result.Skip("No command found in comment")
 		}
-
-		err = nil
+		return result
 	}
 
-	if !strings.HasSuffix(feedback, "\n") {
-		feedback += "\n"
-	}
+	result.Fail(err)
 
-	fmt.Print(feedback)
+	return result
+}
 
-	if err != nil {
-		fmt.Println(err)
-	}
+// commentFeedback logs each step of a command, and records it in the result
+// as an action only when it changed something on GitHub
+type commentFeedback struct {
+	log    *logrus.Entry
+	result *Result
+}
+
+// note logs a step which is neither an action nor a skip
+func (f *commentFeedback) note(format string, a ...interface{}) {
+	f.log.Infof(format, a...)
+}
+
+// acted logs and records a change made on GitHub
+func (f *commentFeedback) acted(format string, a ...interface{}) {
+	f.log.Infof(format, a...)
+	f.result.Action(format, a...)
+}
+
+// skipped logs and records a request which was unnecessary, invalid,
+// not allowed or queued for retry
+func (f *commentFeedback) skipped(format string, a ...interface{}) {
+	f.log.Infof(format, a...)
+	f.result.Skip(format, a...)
 }
 
 func findLabel(currentLabels []types.IssueLabel, cmdLabel string) bool {
@@ -157,40 +182,43 @@ func classifyLabels(currentLabels []types.IssueLabel, labelAction string, labelV
 	return actionableLabels, unactionableLabels
 }
 
-func manageLabel(req types.IssueCommentOuter, cmdType string, labelValue string, config config.Config) (string, error) {
+func manageLabel(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, labelValue string, feedback *commentFeedback) error {
 
-	var buffer bytes.Buffer
 	labelAction := strings.Replace(strings.ToLower(cmdType), "label", "", 1)
-	buffer.WriteString(fmt.Sprintf("%s wants to %s label(s) of '%s' on issue #%d.\n", req.Comment.User.Login, labelAction, labelValue, req.Issue.Number))
+	feedback.note("%s wants to %s label(s) of '%s' on issue #%d.", req.Comment.User.Login, labelAction, labelValue, req.Issue.Number)
 
 	actionableLabels, unactionableLabels := classifyLabels(req.Issue.Labels, cmdType, labelValue)
 
 	if len(unactionableLabels) > 0 {
-		buffer.WriteString(fmt.Sprintf("Request to %s label(s) of '%s' on issue #%d was unnecessary.\n", labelAction, strings.Join(unactionableLabels, ", "), req.Issue.Number))
+		feedback.skipped("Request to %s label(s) of '%s' on issue #%d was unnecessary.", labelAction, strings.Join(unactionableLabels, ", "), req.Issue.Number)
 
 		if len(actionableLabels) == 0 {
-			buffer.WriteString(fmt.Sprintf("No further valid labels found - no action taken on issue #%d.\n", req.Issue.Number))
-			return buffer.String(), nil
+			feedback.note("No further valid labels found - no action taken on issue #%d.", req.Issue.Number)
+			return nil
 		}
 	}
 
-	client, ctx := makeClient(req.Installation.ID, config)
-
-	var err error
-
 	maxActionableLabels := getMultiLabelLimit()
 
 	if len(actionableLabels) > maxActionableLabels {
-		buffer.WriteString(fmt.Sprintf("Label(s) '%s' on issue #%d were ignored as they fall outside of the configured limit of %d.\n", strings.Join(actionableLabels[maxActionableLabels:], ", "), req.Issue.Number, maxActionableLabels))
+		feedback.skipped("Label(s) '%s' on issue #%d were ignored as they fall outside of the configured limit of %d.", strings.Join(actionableLabels[maxActionableLabels:], ", "), req.Issue.Number, maxActionableLabels)
 		actionableLabels = actionableLabels[:maxActionableLabels]
 	}
 
 	if cmdType == addLabelConstant {
 
-		_, _, err = client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, actionableLabels)
+		queued, err := RunOrQueue(ctx, "add labels", func(ctx context.Context) error {
+			_, _, err := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, actionableLabels)
+			return err
+		})
 
 		if err != nil {
-			return buffer.String(), err
+			return err
+		}
+
+		if queued {
+			feedback.skipped("Request to %s label(s) of '%s' on issue #%d was queued for retry.", labelAction, strings.Join(actionableLabels, ", "), req.Issue.Number)
+			return nil
 		}
 
 	} else {
@@ -201,14 +229,23 @@ func manageLabel(req types.IssueCommentOuter, cmdType string, labelValue string,
 
 			if isDcoLabel(actionableLabel) {
 
-				buffer.WriteString(fmt.Sprintf("The request to remove `%s` by %s was not allowed - label can be removed by owner or by signing off the commit.\n", actionableLabel, req.Repository.Owner.Login))
+				feedback.skipped("The request to remove `%s` by %s was not allowed - label can be removed by owner or by signing off the commit.", actionableLabel, req.Repository.Owner.Login)
 
 			} else {
 
-				_, err = client.Issues.RemoveLabelForIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, actionableLabel)
+				label := actionableLabel
+				queued, err := RunOrQueue(ctx, "remove label", func(ctx context.Context) error {
+					_, err := client.Issues.RemoveLabelForIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, label)
+					return err
+				})
 
 				if err != nil {
-					return buffer.String(), err
+					return err
+				}
+
+				if queued {
+					feedback.skipped("Request to remove label '%s' on issue #%d was queued for retry.", label, req.Issue.Number)
+					continue
 				}
 
 				actionedLabels = append(actionedLabels, actionableLabel)
@@ -217,49 +254,43 @@ func manageLabel(req types.IssueCommentOuter, cmdType string, labelValue string,
 		actionableLabels = actionedLabels
 	}
 
-	buffer.WriteString(fmt.Sprintf("Request to %s label(s) of '%s' on issue #%d was successfully completed.\n", labelAction, strings.Join(actionableLabels, ", "), req.Issue.Number))
-	return buffer.String(), nil
+	if len(actionableLabels) > 0 {
+		feedback.acted("Request to %s label(s) of '%s' on issue #%d was successfully completed.", labelAction, strings.Join(actionableLabels, ", "), req.Issue.Number)
+	}
+	return nil
 }
 
-func manageTitle(req types.IssueCommentOuter, cmdType string, cmdValue string, config config.Config) (string, error) {
+func manageTitle(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, cmdValue string, feedback *commentFeedback) error {
 
-	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("%s wants to set the title of issue #%d\n", req.Comment.User.Login, req.Issue.Number))
+	feedback.note("%s wants to set the title of issue #%d", req.Comment.User.Login, req.Issue.Number)
 
 	newTitle := cmdValue
 
 	if newTitle == req.Issue.Title || len(newTitle) == 0 {
-		buffer.WriteString(fmt.Sprintf("Setting the title of #%d by %s was unsuccessful as the new title was empty or unchanged.\n", req.Issue.Number, req.Comment.User.Login))
-		return buffer.String(), nil
+		feedback.skipped("Setting the title of #%d by %s was unsuccessful as the new title was empty or unchanged.", req.Issue.Number, req.Comment.User.Login)
+		return nil
 	}
 
-	client, ctx := makeClient(req.Installation.ID, config)
-
 	input := &github.IssueRequest{Title: &newTitle}
 
 	_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, input)
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
 
-	buffer.WriteString(fmt.Sprintf("Request to set the title of issue #%d by %s was successful.\n", req.Issue.Number, req.Comment.User.Login))
-	return buffer.String(), nil
+	feedback.acted("Request to set the title of issue #%d by %s was successful.", req.Issue.Number, req.Comment.User.Login)
+	return nil
 }
 
-func manageAssignment(req types.IssueCommentOuter, cmdType string, cmdValue string, config config.Config) (string, error) {
-
-	var buffer bytes.Buffer
-
-	buffer.WriteString(fmt.Sprintf("%s wants to %s user '%s' from issue #%d\n", req.Comment.User.Login, strings.ToLower(cmdType), cmdValue, req.Issue.Number))
+func manageAssignment(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, cmdValue string, feedback *commentFeedback) error {
 
-	client, ctx := makeClient(req.Installation.ID, config)
+	feedback.note("%s wants to %s user '%s' from issue #%d", req.Comment.User.Login, strings.ToLower(cmdType), cmdValue, req.Issue.Number)
 
+	var err error
 	if cmdValue == "me" {
 		cmdValue = req.Comment.User.Login
 	}
 
-	var err error
-
 	if cmdType == unassignConstant {
 		_, _, err = client.Issues.RemoveAssignees(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, []string{cmdValue})
 	} else {
@@ -267,22 +298,18 @@ func manageAssignment(req types.IssueCommentOuter, cmdType string, cmdValue stri
 	}
 
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
 
-	buffer.WriteString(fmt.Sprintf("%s %sed successfully or already %sed.\n", cmdValue, strings.ToLower(cmdType), strings.ToLower(cmdType)))
-	return buffer.String(), nil
+	feedback.acted("%s %sed successfully or already %sed.", cmdValue, strings.ToLower(cmdType), strings.ToLower(cmdType))
+	return nil
 }
 
-func editReviewers(req types.PullRequestOuter, cmdType string, cmdValue string, config config.Config) (string, error) {
-	var buffer bytes.Buffer
-
-	client, ctx := makeClient(req.Installation.ID, config)
+func editReviewers(ctx context.Context, client *GitHub, req types.PullRequestOuter, cmdType string, cmdValue string, feedback *commentFeedback) error {
 
 	reviewer := github.ReviewersRequest{Reviewers: []string{cmdValue}}
 
 	var err error
-
 	if cmdType == unassignReviewerConstant {
 		_, err = client.PullRequests.RemoveReviewers(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, reviewer)
 	} else {
@@ -290,55 +317,48 @@ func editReviewers(req types.PullRequestOuter, cmdType string, cmdValue string,
 	}
 
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
 
-	return buffer.String(), nil
+	feedback.acted("Request to %s '%s' on pull request #%d was successful.", strings.ToLower(cmdType), cmdValue, req.PullRequest.Number)
+	return nil
 }
 
-func manageState(req types.IssueCommentOuter, cmdType string, config config.Config) (string, error) {
-
-	var buffer bytes.Buffer
+func manageState(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, feedback *commentFeedback) error {
 
-	buffer.WriteString(fmt.Sprintf("%s wants to %s issue #%d\n", req.Comment.User.Login, cmdType, req.Issue.Number))
+	feedback.note("%s wants to %s issue #%d", req.Comment.User.Login, cmdType, req.Issue.Number)
 
 	newState, validTransition := checkTransition(cmdType, req.Issue.State)
 
 	if !validTransition {
-		buffer.WriteString(fmt.Sprintf("Request to %s issue #%d by %s was invalid.\n", cmdType, req.Issue.Number, req.Comment.User.Login))
-		return buffer.String(), nil
+		feedback.skipped("Request to %s issue #%d by %s was invalid.", cmdType, req.Issue.Number, req.Comment.User.Login)
+		return nil
 	}
 
-	client, ctx := makeClient(req.Installation.ID, config)
 	input := &github.IssueRequest{State: &newState}
 
 	_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, input)
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
 
-	buffer.WriteString(fmt.Sprintf("Request to %s issue #%d by %s was successful.\n", cmdType, req.Issue.Number, req.Comment.User.Login))
-	return buffer.String(), nil
+	feedback.acted("Request to %s issue #%d by %s was successful.", cmdType, req.Issue.Number, req.Comment.User.Login)
+	return nil
 
 }
 
-func manageLocking(req types.IssueCommentOuter, cmdType string, config config.Config) (string, error) {
+func manageLocking(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, feedback *commentFeedback) error {
 
-	var buffer bytes.Buffer
-
-	buffer.WriteString(fmt.Sprintf("%s wants to %s issue #%d\n", req.Comment.User.Login, strings.ToLower(cmdType), req.Issue.Number))
+	feedback.note("%s wants to %s issue #%d", req.Comment.User.Login, strings.ToLower(cmdType), req.Issue.Number)
 
 	if !validAction(req.Issue.Locked, cmdType, lockConstant, unlockConstant) {
 
-		buffer.WriteString(fmt.Sprintf("Issue #%d is already %sed\n", req.Issue.Number, strings.ToLower(cmdType)))
+		feedback.skipped("Issue #%d is already %sed", req.Issue.Number, strings.ToLower(cmdType))
 
-		return buffer.String(), nil
+		return nil
 	}
 
-	client, ctx := makeClient(req.Installation.ID, config)
-
 	var err error
-
 	if cmdType == lockConstant {
 		_, err = client.Issues.Lock(ctx, req.Repository.Owner.Login, req.Repository.Name,
 			req.Issue.Number, &github.LockIssueOptions{})
@@ -347,35 +367,33 @@ func manageLocking(req types.IssueCommentOuter, cmdType string, config config.Co
 	}
 
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
 
-	buffer.WriteString(fmt.Sprintf("Request to %s issue #%d by %s was successful.\n", strings.ToLower(cmdType), req.Issue.Number, req.Comment.User.Login))
-	return buffer.String(), nil
+	feedback.acted("Request to %s issue #%d by %s was successful.", strings.ToLower(cmdType), req.Issue.Number, req.Comment.User.Login)
+	return nil
 }
 
-func updateMilestone(req types.IssueCommentOuter, cmdType string, cmdValue string, config config.Config) (string, error) {
+func updateMilestone(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType string, cmdValue string, feedback *commentFeedback) error {
 
 	milestoneValue := cmdValue
-	var buffer bytes.Buffer
 	milestoneAction := strings.Replace(strings.ToLower(cmdType), "milestone", "", 1)
-	buffer.WriteString(fmt.Sprintf("%s wants to %s milestone of '%s' on issue #%d \n", req.Comment.User.Login, milestoneAction, milestoneValue, req.Issue.Number))
+	feedback.note("%s wants to %s milestone of '%s' on issue #%d", req.Comment.User.Login, milestoneAction, milestoneValue, req.Issue.Number)
 
 	allMilestones := &github.MilestoneListOptions{}
 	var milestoneNumber *int
 	var err error
 
-	client, ctx := makeClient(req.Installation.ID, config)
 	theMilestones, _, milErr := client.Issues.ListMilestones(ctx, req.Repository.Owner.Login, req.Repository.Name, allMilestones)
 	if milErr != nil {
-		return buffer.String(), milErr
+		return milErr
 	}
 
 	switch cmdType {
 	case setMilestoneConstant:
 		if req.Issue.Milestone.Title == cmdValue {
-			buffer.WriteString(fmt.Sprintf("Setting the milestone of #%d by %s was unnecessary.\n", req.Issue.Number, req.Comment.User.Login))
-			return buffer.String(), nil
+			feedback.skipped("Setting the milestone of #%d by %s was unnecessary.", req.Issue.Number, req.Comment.User.Login)
+			return nil
 		}
 		for _, mil := range theMilestones {
 			if mil != nil && *mil.Title == milestoneValue {
@@ -388,19 +406,19 @@ func updateMilestone(req types.IssueCommentOuter, cmdType string, cmdValue strin
 		}
 		_, _, err = client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, input)
 		if err != nil {
-			return buffer.String(), err
+			return err
 		}
 	case removeMilestoneConstant:
-		if err = removeMilestone(client, ctx, req.Issue.URL); err != nil {
-			return buffer.String(), err
+		if _, err = client.Issues.RemoveMilestone(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number); err != nil {
+			return err
 		}
 	default:
-		buffer.WriteString(fmt.Sprintf("Unknown milestone action %q on issue #%d.", milestoneAction, req.Issue.Number))
-		return buffer.String(), nil
+		feedback.skipped("Unknown milestone action %q on issue #%d.", milestoneAction, req.Issue.Number)
+		return nil
 	}
 
-	buffer.WriteString(fmt.Sprintf("Request to %s milestone of '%s' on issue #%d was successfully completed.", milestoneAction, milestoneValue, req.Issue.Number))
-	return buffer.String(), nil
+	feedback.acted("Request to %s milestone of '%s' on issue #%d was successfully completed.", milestoneAction, milestoneValue, req.Issue.Number)
+	return nil
 }
 
 func parse(body string, commandTriggers []string) *types.CommentAction {
@@ -471,21 +489,6 @@ func checkTransition(requestedAction string, currentState string) (string, bool)
 	return "", false
 }
 
-// removeMilestone sets milestones field to interface{} aka. null since library does not support that
-// reference to issue - https://github.com/google/go-github/issues/236
-func removeMilestone(client *github.Client, ctx context.Context, URL string) error {
-	req, err := client.NewRequest("PATCH", URL, &struct {
-		Milestone interface{} `json:"milestone"`
-	}{})
-	if err != nil {
-		return err
-	}
-	if _, err = client.Do(ctx, req, nil); err != nil {
-		return err
-	}
-	return nil
-}
-
 func isDcoLabel(labelValue string) bool {
 	return strings.ToLower(labelValue) == noDCO
 }
@@ -507,31 +510,26 @@ func getMultiLabelLimit() int {
 	return labelLimitDefault
 }
 
-func createMessage(req types.IssueCommentOuter, cmdType, cmdValue string, config config.Config, derekConfig *types.DerekRepoConfig) (string, error) {
-	var err error
-
-	var buffer bytes.Buffer
+func createMessage(ctx context.Context, client *GitHub, req types.IssueCommentOuter, cmdType, cmdValue string, derekConfig *types.DerekRepoConfig, feedback *commentFeedback) error {
 
-	buffer.WriteString(fmt.Sprintf("%s wants to add message of type '%s' on issue #%d \n", req.Comment.User.Login, cmdValue, req.Issue.Number))
+	feedback.note("%s wants to add message of type '%s' on issue #%d", req.Comment.User.Login, cmdValue, req.Issue.Number)
 
 	messageValue, err := createIssueComment(derekConfig.Messages, cmdValue)
 	if err != nil {
-		return buffer.String(), fmt.Errorf("Error while filtering message: %s", err.Error())
+		return fmt.Errorf("Error while filtering message: %s", err.Error())
 	}
 
-	buffer.WriteString(fmt.Sprintf("Message '%s' found.\n", cmdValue))
-
-	client, ctx := makeClient(req.Installation.ID, config)
+	feedback.note("Message '%s' found.", cmdValue)
 
 	_, resp, err := client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, messageValue)
 	if err != nil {
-		return buffer.String(), err
+		return err
 	}
-	buffer.WriteString(fmt.Sprintf("Successfully applied message: `%s` status code: %d\n",
+	feedback.acted("Successfully applied message: `%s` status code: %d",
 		cmdValue,
-		resp.StatusCode))
+		resp.StatusCode)
 
-	return buffer.String(), nil
+	return nil
 }
 
 func createIssueComment(messages []types.Message, wantedMessage string) (*github.IssueComment, error) {
@@ -4,10 +4,13 @@
 package handler
 
 import (
+	"context"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/alexellis/derek/fakegithub"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
 )
@@ -859,3 +862,141 @@ func Test_createIssueComment(t *testing.T) {
 		})
 	}
 }
+
+func newCommentRequest(body string, issue types.Issue) types.IssueCommentOuter {
+	req := types.IssueCommentOuter{
+		Repository: types.Repository{Owner: types.Owner{Login: "alexellis"}, Name: "derek"},
+		Action:     "created",
+		Issue:      issue,
+	}
+	req.Comment.Body = body
+	req.Comment.User.Login = "alexellis"
+	return req
+}
+
+func Test_HandleComment_Labels(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{
+		Number: github.Int(1),
+		Labels: []github.Label{{Name: github.String("bug")}, {Name: github.String("no-dco")}},
+	})
+	client := newFakeGitHub(fake)
+
+	current := []types.IssueLabel{{Name: "bug"}, {Name: "no-dco"}}
+
+	result := HandleComment(context.Background(), client, newCommentRequest("Derek add label: help wanted, bug", types.Issue{Number: 1, Labels: current}), &types.DerekRepoConfig{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	result = HandleComment(context.Background(), client, newCommentRequest("/remove labels: bug, no-dco", types.Issue{Number: 1, Labels: current}), &types.DerekRepoConfig{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	want := []string{"no-dco", "help wanted"}
+	if got := fake.Labels("alexellis", "derek", 1); !reflect.DeepEqual(want, got) {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+}
+
+func Test_HandleComment_StateAndTitle(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{
+		Number: github.Int(2),
+		Title:  github.String("Typo"),
+		State:  github.String("open"),
+	})
+	client := newFakeGitHub(fake)
+	issue := types.Issue{Number: 2, Title: "Typo", State: "open"}
+
+	HandleComment(context.Background(), client, newCommentRequest("Derek set title: Fix typo in README", issue), &types.DerekRepoConfig{})
+	HandleComment(context.Background(), client, newCommentRequest("Derek close", issue), &types.DerekRepoConfig{})
+	HandleComment(context.Background(), client, newCommentRequest("Derek lock", issue), &types.DerekRepoConfig{})
+
+	got := fake.Issue("alexellis", "derek", 2)
+	if got.GetTitle() != "Fix typo in README" {
+		t.Errorf("want title updated, got: %q", got.GetTitle())
+	}
+	if got.GetState() != ClosedConstant {
+		t.Errorf("want state: %s, got: %q", ClosedConstant, got.GetState())
+	}
+	if !got.GetLocked() {
+		t.Errorf("want issue locked")
+	}
+}
+
+func Test_HandleComment_Message(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{Number: github.Int(3)})
+
+	derekConfig := &types.DerekRepoConfig{
+		Messages: []types.Message{{Name: "docs", Value: "Please see the docs"}},
+	}
+
+	result := HandleComment(context.Background(), newFakeGitHub(fake), newCommentRequest("/msg: docs", types.Issue{Number: 3}), derekConfig)
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	if want, got := []string{"Please see the docs"}, fake.Comments("alexellis", "derek", 3); !reflect.DeepEqual(want, got) {
+		t.Errorf("want comments: %v, got: %v", want, got)
+	}
+}
+
+func Test_HandleComment_NoCommandMakesNoCalls(t *testing.T) {
+	fake := fakegithub.New()
+
+	result := HandleComment(context.Background(), newFakeGitHub(fake), newCommentRequest("LGTM", types.Issue{Number: 4}), &types.DerekRepoConfig{})
+
+	if len(result.Skipped) != 1 {
+		t.Errorf("want the comment skipped, got: %v", result.Skipped)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("want no calls to GitHub, got: %v", calls)
+	}
+}
+
+func Test_HandleComment_RecordsNoOpsAsSkipped(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{
+		Number: github.Int(5),
+		State:  github.String("closed"),
+		Labels: []github.Label{{Name: github.String("no-dco")}},
+	})
+	client := newFakeGitHub(fake)
+	issue := types.Issue{Number: 5, State: "closed", Labels: []types.IssueLabel{{Name: "no-dco"}}}
+
+	for _, body := range []string{"Derek close", "Derek remove label: no-dco", "Derek add label: no-dco"} {
+		result := HandleComment(context.Background(), client, newCommentRequest(body, issue), &types.DerekRepoConfig{})
+
+		if result.Failed() {
+			t.Fatalf("%s: want no errors, got: %v", body, result.Errors)
+		}
+		if len(result.Actions) != 0 {
+			t.Errorf("%s: want no actions, got: %v", body, result.Actions)
+		}
+		if len(result.Skipped) != 1 {
+			t.Errorf("%s: want the request skipped, got: %v", body, result.Skipped)
+		}
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("want no calls to GitHub, got: %v", calls)
+	}
+}
+
+func Test_HandleComment_RecordsChangesAsActions(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{Number: github.Int(6), State: github.String("open")})
+
+	result := HandleComment(context.Background(), newFakeGitHub(fake), newCommentRequest("Derek close", types.Issue{Number: 6, State: "open"}), &types.DerekRepoConfig{})
+
+	want := []string{"Request to close issue #6 by alexellis was successful."}
+	if !reflect.DeepEqual(want, result.Actions) {
+		t.Errorf("want actions: %v, got: %v", want, result.Actions)
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("want nothing skipped, got: %v", result.Skipped)
+	}
+}
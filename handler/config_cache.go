@@ -0,0 +1,147 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/types"
+)
+
+const (
+	configCacheTTLEnvVar  = "config_cache_ttl"
+	configCacheTTLDefault = time.Minute
+)
+
+// cachedConfig is a parsed config document along with the ETag it was
+// served with, so that it can be revalidated with If-None-Match.
+type cachedConfig struct {
+	config    types.DerekRepoConfig
+	etag      string
+	fetchedAt time.Time
+
+	// missing is the error given when the file did not exist
+	missing error
+}
+
+// configCache holds .DEREK.yml files keyed by owner/repo/branch, and the
+// files they redirect to or extend keyed by URL. Entries younger than the TTL are
+// used as-is, older entries are revalidated with GitHub before use.
+type configCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	repos   map[string]cachedConfig
+	sources map[string]cachedConfig
+	now     func() time.Time
+}
+
+var repoConfigs = newConfigCache(getConfigCacheTTL())
+
+func newConfigCache(ttl time.Duration) *configCache {
+	return &configCache{
+		ttl:     ttl,
+		repos:   map[string]cachedConfig{},
+		sources: map[string]cachedConfig{},
+		now:     time.Now,
+	}
+}
+
+func repoConfigKey(owner, repository, branch string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s/%s", owner, repository, branch))
+}
+
+// InvalidateRepoConfig drops the cached .DEREK.yml for a repository's
+// branch, i.e. when a push changes the file on the default branch.
+func InvalidateRepoConfig(owner, repository, branch string) {
+	repoConfigs.invalidate(repoConfigKey(owner, repository, branch))
+}
+
+// HandlePush invalidates the cached config when a push to the
+// default branch touches `.DEREK.yml`, returning true if it did.
+func HandlePush(req types.PushOuter) bool {
+	if req.Ref != "refs/heads/"+req.Repository.DefaultBranch || !req.Touches(configFile) {
+		return false
+	}
+
+	InvalidateRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch)
+	if strings.EqualFold(req.Repository.Name, orgConfigRepo) {
+		repoConfigs.invalidate(orgConfigKey(req.Repository.Owner.Login))
+	}
+	return true
+}
+
+func (c *configCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.repos, key)
+}
+
+// repo returns the cached entry for the key, and whether it is still
+// within its TTL and so can be used without revalidation.
+func (c *configCache) repo(key string) (cachedConfig, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.repos[key]
+	return entry, ok, ok && c.fresh(entry)
+}
+
+func (c *configCache) source(url string) (cachedConfig, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.sources[url]
+	return entry, ok, ok && c.fresh(entry)
+}
+
+func (c *configCache) storeRepo(key string, entry cachedConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.fetchedAt = c.now()
+	c.repos[key] = entry
+}
+
+func (c *configCache) storeSource(url string, entry cachedConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.fetchedAt = c.now()
+	c.sources[url] = entry
+}
+
+func (c *configCache) fresh(entry cachedConfig) bool {
+	return c.now().Sub(entry.fetchedAt) < c.ttl
+}
+
+// copyConfig gives callers their own slices so they cannot modify
+// the values held in the cache.
+func copyConfig(config types.DerekRepoConfig) types.DerekRepoConfig {
+	config.Extends = append([]string(nil), config.Extends...)
+	config.Sources = append([]string(nil), config.Sources...)
+	config.Features = append([]string(nil), config.Features...)
+	config.Maintainers = append([]string(nil), config.Maintainers...)
+	config.Curators = append([]string(nil), config.Curators...)
+	config.Messages = append([]types.Message(nil), config.Messages...)
+	config.RequiredInIssues = append([]string(nil), config.RequiredInIssues...)
+	return config
+}
+
+func getConfigCacheTTL() time.Duration {
+	val, ok := os.LookupEnv(configCacheTTLEnvVar)
+	if !ok || len(val) == 0 {
+		return configCacheTTLDefault
+	}
+
+	ttl, err := time.ParseDuration(val)
+	if err != nil {
+		return configCacheTTLDefault
+	}
+	return ttl
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/types"
+)
+
+// newETagServer serves a config file with a fixed ETag and answers
+// If-None-Match with a 304, counting full and conditional responses.
+func newETagServer(body string, full, notModified *int32) *httptest.Server {
+	etag := `"v1"`
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(full, 1)
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+}
+
+func Test_readConfigFromURL_RevalidatesWithETag(t *testing.T) {
+	var full, notModified int32
+	srv := newETagServer("features:\n - comments\n", &full, &notModified)
+	defer srv.Close()
+
+	body, etag, wasNotModified, err := readConfigFromURL(context.Background(), http.Client{}, srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wasNotModified || len(body) == 0 || etag != `"v1"` {
+		t.Fatalf("want full response with ETag, got body: %q, etag: %q, notModified: %v", body, etag, wasNotModified)
+	}
+
+	_, _, wasNotModified, err = readConfigFromURL(context.Background(), http.Client{}, srv.URL, etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wasNotModified {
+		t.Errorf("want notModified for matching ETag")
+	}
+}
+
+func Test_readSourceConfig_UsesCacheWithinTTL(t *testing.T) {
+	var full, notModified int32
+	srv := newETagServer("maintainers:\n - alexellis\n", &full, &notModified)
+	defer srv.Close()
+
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+
+	now := time.Now()
+	repoConfigs = newConfigCache(time.Minute)
+	repoConfigs.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		config, err := readSourceConfig(context.Background(), http.Client{}, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.Maintainers) != 1 || config.Maintainers[0] != "alexellis" {
+			t.Fatalf("want maintainers from redirect, got: %v", config.Maintainers)
+		}
+	}
+
+	if full != 1 || notModified != 0 {
+		t.Errorf("want 1 download within TTL, got full: %d, not modified: %d", full, notModified)
+	}
+
+	now = now.Add(time.Minute * 2)
+
+	config, err := readSourceConfig(context.Background(), http.Client{}, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Maintainers) != 1 {
+		t.Errorf("want cached maintainers after revalidation, got: %v", config.Maintainers)
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("want revalidation after TTL, got full: %d, not modified: %d", full, notModified)
+	}
+}
+
+func Test_configCache_CallersCannotModifyEntries(t *testing.T) {
+	cache := newConfigCache(time.Minute)
+	cache.storeRepo("a/b/master", cachedConfig{config: types.DerekRepoConfig{Features: []string{"comments"}}})
+
+	entry, _, _ := cache.repo("a/b/master")
+	config := copyConfig(entry.config)
+	config.Features[0] = "dco_check"
+
+	entry, _, _ = cache.repo("a/b/master")
+	if entry.config.Features[0] != "comments" {
+		t.Errorf("want cached features to be unchanged, got: %v", entry.config.Features)
+	}
+}
+
+func Test_HandlePush_InvalidatesConfig(t *testing.T) {
+	tests := []struct {
+		title       string
+		ref         string
+		modified    []string
+		invalidated bool
+	}{
+		{
+			title:       "Push to default branch touching config",
+			ref:         "refs/heads/master",
+			modified:    []string{"README.md", ".DEREK.yml"},
+			invalidated: true,
+		},
+		{
+			title:       "Push to default branch not touching config",
+			ref:         "refs/heads/master",
+			modified:    []string{"README.md"},
+			invalidated: false,
+		},
+		{
+			title:       "Push to another branch touching config",
+			ref:         "refs/heads/feature",
+			modified:    []string{".DEREK.yml"},
+			invalidated: false,
+		},
+	}
+
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			repoConfigs = newConfigCache(time.Minute)
+			repoConfigs.storeRepo(repoConfigKey("alexellis", "derek", "master"), cachedConfig{})
+
+			req := types.PushOuter{
+				Ref: test.ref,
+				Repository: types.Repository{
+					Owner:         types.Owner{Login: "alexellis"},
+					Name:          "derek",
+					DefaultBranch: "master",
+				},
+				Commits: []types.PushCommit{{Modified: test.modified}},
+			}
+
+			got := HandlePush(req)
+			_, found, _ := repoConfigs.repo(repoConfigKey("alexellis", "derek", "master"))
+
+			if got != test.invalidated || found == test.invalidated {
+				t.Errorf("want invalidated: %v, got: %v, still cached: %v", test.invalidated, got, found)
+			}
+		})
+	}
+}
+
+func Test_HandlePush_InvalidatesOrgConfig(t *testing.T) {
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+
+	repoConfigs = newConfigCache(time.Minute)
+	repoConfigs.storeRepo(orgConfigKey("openfaas"), cachedConfig{})
+
+	HandlePush(types.PushOuter{
+		Ref: "refs/heads/main",
+		Repository: types.Repository{
+			Owner:         types.Owner{Login: "openfaas"},
+			Name:          ".github",
+			DefaultBranch: "main",
+		},
+		Commits: []types.PushCommit{{Modified: []string{".DEREK.yml"}}},
+	})
+
+	if _, found, _ := repoConfigs.repo(orgConfigKey("openfaas")); found {
+		t.Errorf("want the organisation's config invalidated")
+	}
+}
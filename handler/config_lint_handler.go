@@ -0,0 +1,287 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+const (
+	configLintFeature = "config_lint"
+
+	// configLintCheck is the name of the check run posted on the PR
+	configLintCheck = "Derek config"
+
+	// GitHub accepts at most 50 annotations in each request
+	maxCheckRunAnnotations = 50
+)
+
+// HandleConfigLint validates the .DEREK.yml of a PR which changes it, and
+// posts a check run which annotates its problems and shows how the
+// features and maintainers differ from those of the default branch.
+func HandleConfigLint(ctx context.Context, client *GitHub, req types.PullRequestOuter, derekConfig *types.DerekRepoConfig, config config.Config) *Result {
+	result := NewResult(configLintFeature)
+
+	// Only the changed files are listed, rather than fetching the whole
+	// snapshot, since most PRs do not change the file. Not being able to
+	// tell is logged rather than failing every PR event.
+	files, err := fetchPullRequestFileList(ctx, req, client)
+	if err != nil {
+		logging.FromContext(ctx).Warnf("Unable to tell whether PR %d changes %s: %s", req.PullRequest.Number, configFile, err)
+		result.Skip("unable to tell whether %s is changed", configFile)
+		return result
+	}
+
+	var configChange *github.CommitFile
+	for _, file := range files {
+		if file.GetFilename() == configFile {
+			configChange = file
+			break
+		}
+	}
+	if configChange == nil {
+		result.Skip("%s is not changed", configFile)
+		return result
+	}
+
+	var check github.CreateCheckRunOptions
+	var annotations []types.CheckRunAnnotation
+
+	if configChange.GetStatus() == "removed" {
+		check = createConfigLintCheck(req, neutralConclusion,
+			fmt.Sprintf("%s is removed", configFile),
+			fmt.Sprintf("Derek will not run any features once %s is removed.", configFile), "")
+	} else {
+		data, err := fetchHeadConfig(ctx, client, req)
+		if err != nil {
+			result.Fail(err)
+			return result
+		}
+
+		org, err := loadOrgConfig(ctx, client, req.Repository, config)
+		if err != nil {
+			result.Fail(err)
+			return result
+		}
+
+		effective, problems := validateRepoConfig(ctx, configFile, data, org, config)
+		check, annotations = configLintResult(req, derekConfig, effective, problems)
+	}
+
+	queued, err := RunOrQueue(ctx, "create config check run", func(ctx context.Context) error {
+		_, resp, err := client.Checks.CreateCheckRunWithAnnotations(ctx, req.Repository.Owner.Login, req.Repository.Name, check, annotations)
+		logRateLimits(ctx, "CreateCheckRunWithAnnotations", resp)
+		return err
+	})
+	if forbidden(err) {
+		logging.FromContext(ctx).Warnf("Unable to create %s check, the app needs the Checks write permission: %s", configLintCheck, err)
+		result.Skip("%s check needs the Checks write permission", configLintCheck)
+		return result
+	}
+	if err != nil {
+		result.Fail(fmt.Errorf("error while creating %s check: %s", configLintCheck, err))
+		return result
+	}
+
+	if queued {
+		result.Skip("queued %s check for retry", configLintCheck)
+		return result
+	}
+
+	result.Action("created %s check with conclusion %s", configLintCheck, check.GetConclusion())
+	return result
+}
+
+// forbidden whether GitHub refused a call because the installation lacks
+// a permission, rate limits are answered with a 403 too but have errors
+// of their own
+func forbidden(err error) bool {
+	var resErr *github.ErrorResponse
+	return errors.As(err, &resErr) && resErr.Response != nil &&
+		resErr.Response.StatusCode == http.StatusForbidden
+}
+
+// fetchHeadConfig reads the .DEREK.yml of the PR's head commit
+func fetchHeadConfig(ctx context.Context, client *GitHub, req types.PullRequestOuter) ([]byte, error) {
+	file, _, resp, err := client.Repositories.GetContents(ctx, req.Repository.Owner.Login, req.Repository.Name, configFile,
+		&github.RepositoryContentGetOptions{Ref: req.PullRequest.Head.SHA})
+	logRateLimits(ctx, "GetContents", resp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s of PR %d: %s", configFile, req.PullRequest.Number, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s of PR %d is not a file", configFile, req.PullRequest.Number)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s of PR %d: %s", configFile, req.PullRequest.Number, err)
+	}
+	return []byte(content), nil
+}
+
+// loadOrgConfig gives the organisation's file which is merged beneath the
+// repository's, or nil when there is none. It is shared with the cache
+// used when handling events, and read through the API when not cached.
+func loadOrgConfig(ctx context.Context, client *GitHub, repository types.Repository, config config.Config) (*sourceConfig, error) {
+	owner := repository.Owner.Login
+	if strings.EqualFold(repository.Name, orgConfigRepo) {
+		return nil, nil
+	}
+
+	orgFile, err := loadRepoConfig(ctx, orgConfigKey(owner), func(etag string) ([]byte, string, bool, error) {
+		file, _, resp, err := client.Repositories.GetContents(ctx, owner, orgConfigRepo, configFile, nil)
+		logRateLimits(ctx, "GetContents", resp)
+		if err != nil {
+			err = fmt.Errorf("unable to read %s of %s/%s: %s", configFile, owner, orgConfigRepo, err)
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				err = &configNotFoundError{err: err}
+			}
+			return nil, "", false, err
+		}
+		if file == nil {
+			return nil, "", false, fmt.Errorf("%s of %s/%s is not a file", configFile, owner, orgConfigRepo)
+		}
+
+		content, err := file.GetContent()
+		return []byte(content), "", false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if orgFile.missing != nil {
+		return nil, nil
+	}
+
+	return &sourceConfig{
+		source: repoConfigURL(owner, orgConfigRepo, "HEAD", config),
+		config: copyConfig(orgFile.config),
+	}, nil
+}
+
+// configLintResult gives the check run for the validated config, with an
+// annotation for each problem in the PR's own file. Problems in the file
+// it redirects to cannot be annotated, so are listed in the text.
+func configLintResult(req types.PullRequestOuter, current, effective *types.DerekRepoConfig, problems []ConfigProblem) (github.CreateCheckRunOptions, []types.CheckRunAnnotation) {
+	var annotations []types.CheckRunAnnotation
+	var unannotated []ConfigProblem
+
+	for _, problem := range problems {
+		if problem.Source != configFile || len(annotations) == maxCheckRunAnnotations {
+			unannotated = append(unannotated, problem)
+			continue
+		}
+
+		level, title := "failure", "Error"
+		if problem.Warning {
+			level, title = "warning", "Warning"
+		}
+		line := problem.Line
+		if line == 0 {
+			line = 1
+		}
+		annotations = append(annotations, types.CheckRunAnnotation{
+			Path:            configFile,
+			StartLine:       line,
+			EndLine:         line,
+			AnnotationLevel: level,
+			Message:         problem.Message,
+			Title:           title,
+		})
+	}
+
+	var text strings.Builder
+	if len(unannotated) > 0 {
+		text.WriteString("Problems which could not be annotated:\n\n")
+		for _, problem := range unannotated {
+			fmt.Fprintf(&text, "* `%s`\n", problem)
+		}
+	}
+
+	if effective == nil {
+		summary := fmt.Sprintf("Derek cannot use this %s, so would stop running for the repository once it is merged.", configFile)
+		return createConfigLintCheck(req, failureConclusion, fmt.Sprintf("%s is not valid", configFile), summary, text.String()), annotations
+	}
+
+	if current == nil {
+		current = &types.DerekRepoConfig{}
+	}
+
+	summary := configChangeSummary("Features", current.Features, effective.Features) +
+		configChangeSummary("Maintainers", current.Maintainers, effective.Maintainers)
+
+	title := fmt.Sprintf("%s is valid", configFile)
+	if len(problems) > 0 {
+		title = fmt.Sprintf("%s is valid with %d warning(s)", configFile, len(problems))
+	}
+	return createConfigLintCheck(req, successConclusion, title, summary, text.String()), annotations
+}
+
+// configChangeSummary lists the values added and removed compared with
+// the default branch, ignoring case as Derek does
+func configChangeSummary(heading string, current, proposed []string) string {
+	var added, removed []string
+	for _, value := range proposed {
+		if !containsFold(current, value) && !containsFold(added, value) {
+			added = append(added, value)
+		}
+	}
+	for _, value := range current {
+		if !containsFold(proposed, value) && !containsFold(removed, value) {
+			removed = append(removed, value)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**: %s\n", heading, formatConfigValues(proposed))
+	if len(added) == 0 && len(removed) == 0 {
+		b.WriteString("* no change from the default branch\n")
+	}
+	for _, value := range added {
+		fmt.Fprintf(&b, "* added `%s`\n", value)
+	}
+	for _, value := range removed {
+		fmt.Fprintf(&b, "* removed `%s`\n", value)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func formatConfigValues(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return "`" + strings.Join(values, "`, `") + "`"
+}
+
+func createConfigLintCheck(req types.PullRequestOuter, conclusion, title, summary, text string) github.CreateCheckRunOptions {
+	now := github.Timestamp{Time: time.Now()}
+	status := "completed"
+	check := github.CreateCheckRunOptions{
+		Name:        configLintCheck,
+		HeadSHA:     req.PullRequest.Head.SHA,
+		Status:      &status,
+		Conclusion:  &conclusion,
+		StartedAt:   &now,
+		CompletedAt: &now,
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &summary,
+		},
+	}
+	if len(text) > 0 {
+		check.Output.Text = &text
+	}
+	return check
+}
@@ -0,0 +1,203 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// newConfigPullRequest adds a PR which changes .DEREK.yml to the content given
+func newConfigPullRequest(fake *fakegithub.Client, number int, content string) types.PullRequestOuter {
+	fake.AddPullRequest("alexellis", "derek", &github.PullRequest{
+		Number: github.Int(number),
+		State:  github.String("open"),
+	}, []*github.RepositoryCommit{{Commit: &github.Commit{Message: github.String("Update config")}}},
+		[]*github.CommitFile{{Filename: github.String(configFile), Status: github.String("modified")}})
+	fake.AddFile("alexellis", "derek", "abc123", configFile, content)
+
+	return types.PullRequestOuter{
+		Repository:  types.Repository{Owner: types.Owner{Login: "alexellis"}, Name: "derek"},
+		PullRequest: types.PullRequest{Number: number, State: "open", Head: types.Head{SHA: "abc123"}},
+		Action:      "synchronize",
+	}
+}
+
+func Test_HandleConfigLint_Invalid(t *testing.T) {
+	fake := fakegithub.New()
+	req := newConfigPullRequest(fake, 1, "maintainers:\n- alexellis\nfeature:\n- dco_check\n")
+
+	current := &types.DerekRepoConfig{Maintainers: []string{"alexellis"}, Features: []string{dcoCheckFeature}}
+	result := HandleConfigLint(context.Background(), newFakeGitHub(fake), req, current, config.Config{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	runs := fake.CheckRuns("alexellis", "derek")
+	if len(runs) != 1 {
+		t.Fatalf("want a check run, got: %d", len(runs))
+	}
+	if runs[0].GetName() != configLintCheck || runs[0].GetConclusion() != failureConclusion {
+		t.Errorf("want a failed %s check, got: %s %s", configLintCheck, runs[0].GetName(), runs[0].GetConclusion())
+	}
+
+	annotations := fake.CheckRunAnnotations("alexellis", "derek", runs[0].GetID())
+	if len(annotations) != 1 {
+		t.Fatalf("want an annotation, got: %v", annotations)
+	}
+	if a := annotations[0]; a.Path != configFile || a.StartLine != 3 || a.AnnotationLevel != "failure" || a.Message != `unknown field "feature"` {
+		t.Errorf("want an error for feature on line 3, got: %+v", a)
+	}
+}
+
+func Test_HandleConfigLint_SummarisesChanges(t *testing.T) {
+	fake := fakegithub.New()
+	req := newConfigPullRequest(fake, 2, "maintainers:\n- alexellis\n- rgee0\nfeatures:\n- dco_check\n- hacktoberfst\n")
+
+	current := &types.DerekRepoConfig{Maintainers: []string{"AlexEllis"}, Features: []string{dcoCheckFeature, commentsFeature}}
+	result := HandleConfigLint(context.Background(), newFakeGitHub(fake), req, current, config.Config{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	runs := fake.CheckRuns("alexellis", "derek")
+	if len(runs) != 1 || runs[0].GetConclusion() != successConclusion {
+		t.Fatalf("want a successful check run, got: %v", runs)
+	}
+
+	annotations := fake.CheckRunAnnotations("alexellis", "derek", runs[0].GetID())
+	if len(annotations) != 1 || annotations[0].AnnotationLevel != "warning" || annotations[0].StartLine != 6 {
+		t.Errorf("want a warning for hacktoberfst on line 6, got: %v", annotations)
+	}
+
+	summary := runs[0].GetOutput().GetSummary()
+	for _, want := range []string{"* added `hacktoberfst`", "* removed `comments`", "* added `rgee0`"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("want %q in the summary, got: %s", want, summary)
+		}
+	}
+	if strings.Contains(summary, "removed `AlexEllis`") {
+		t.Errorf("want maintainers compared ignoring case, got: %s", summary)
+	}
+}
+
+func Test_HandleConfigLint_OrgConfig(t *testing.T) {
+	tests := []struct {
+		title       string
+		content     string
+		wantSummary []string
+	}{
+		{
+			title:       "Organisation's file is merged beneath the PR's",
+			content:     "maintainers:\n- rgee0\nfeatures:\n- comments\n",
+			wantSummary: []string{"**Features**: `dco_check`, `comments`\n* no change", "**Maintainers**: `alexellis`, `rgee0`\n* no change"},
+		},
+		{
+			title:       "PR ignores the organisation's file",
+			content:     "ignore_org_config: true\nmaintainers:\n- rgee0\nfeatures:\n- comments\n",
+			wantSummary: []string{"* removed `dco_check`", "* removed `alexellis`"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			previous := repoConfigs
+			defer func() { repoConfigs = previous }()
+			repoConfigs = newConfigCache(time.Minute)
+
+			fake := fakegithub.New()
+			fake.AddFile("alexellis", orgConfigRepo, "", configFile, "maintainers:\n- alexellis\nfeatures:\n- dco_check\n")
+			req := newConfigPullRequest(fake, 4, test.content)
+
+			current := &types.DerekRepoConfig{Maintainers: []string{"alexellis", "rgee0"}, Features: []string{dcoCheckFeature, commentsFeature}}
+			result := HandleConfigLint(context.Background(), newFakeGitHub(fake), req, current, config.Config{})
+			if result.Failed() {
+				t.Fatalf("want no errors, got: %v", result.Errors)
+			}
+
+			runs := fake.CheckRuns("alexellis", "derek")
+			if len(runs) != 1 {
+				t.Fatalf("want a check run, got: %d", len(runs))
+			}
+
+			summary := runs[0].GetOutput().GetSummary()
+			for _, want := range test.wantSummary {
+				if !strings.Contains(summary, want) {
+					t.Errorf("want %q in the summary, got: %s", want, summary)
+				}
+			}
+		})
+	}
+}
+
+func Test_HandleConfigLint_Unchanged(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 3, "Fix typo")
+
+	result := HandleConfigLint(context.Background(), newFakeGitHub(fake), req, &types.DerekRepoConfig{}, config.Config{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	if got := countCalls(fake, "Repositories.GetContents"); got != 0 {
+		t.Errorf("want the config not read, got: %d calls", got)
+	}
+	if runs := fake.CheckRuns("alexellis", "derek"); len(runs) != 0 {
+		t.Errorf("want no check runs, got: %v", runs)
+	}
+	if got := countCalls(fake, "PullRequests.ListCommits"); got != 0 {
+		t.Errorf("want only the files listed, got: %d calls to list commits", got)
+	}
+}
+
+// forbiddenChecks refuses to create check runs, as GitHub does for an
+// installation without the Checks write permission
+type forbiddenChecks struct {
+	ChecksService
+}
+
+func (f *forbiddenChecks) CreateCheckRunWithAnnotations(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions, annotations []types.CheckRunAnnotation) (*github.CheckRun, *github.Response, error) {
+	return nil, nil, newErrorResponse(http.StatusForbidden)
+}
+
+func Test_HandleConfigLint_SkipsWithoutChecksPermission(t *testing.T) {
+	fake := fakegithub.New()
+	req := newConfigPullRequest(fake, 5, "maintainers:\n- alexellis\nfeatures:\n- dco_check\n")
+
+	client := newFakeGitHub(fake)
+	client.Checks = &forbiddenChecks{ChecksService: fake.Checks}
+
+	result := HandleConfigLint(context.Background(), client, req, &types.DerekRepoConfig{}, config.Config{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+	if len(result.Skipped) != 1 {
+		t.Errorf("want the check skipped, got: %v", result.Skipped)
+	}
+}
+
+func Test_configLintResult_RedirectProblems(t *testing.T) {
+	problems := []ConfigProblem{
+		{Source: "https://github.com/org/config/blob/master/.DEREK.yml", Line: 4, Message: "unknown field \"maintainer\""},
+	}
+
+	check, annotations := configLintResult(types.PullRequestOuter{}, nil, nil, problems)
+	if len(annotations) != 0 {
+		t.Errorf("want no annotations for the redirect, got: %v", annotations)
+	}
+	if check.GetConclusion() != failureConclusion {
+		t.Errorf("want a failure, got: %s", check.GetConclusion())
+	}
+	if text := check.Output.GetText(); !strings.Contains(text, problems[0].String()) {
+		t.Errorf("want the redirect's problem in the text, got: %s", text)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/types"
+)
+
+// maxConfigDepth limits how many files deep redirects and extends can go
+const maxConfigDepth = 5
+
+// configSourceShorthand matches owner/repo:path@ref, the path and ref are optional
+var configSourceShorthand = regexp.MustCompile(`^([\w.-]+)/([\w.-]+)(?::([^@]+))?(?:@(.+))?$`)
+
+// configSourceURL gives the URL to download an entry of extends from. An
+// entry is either a URL on GitHub, or owner/repo:path@ref where the path
+// defaults to .DEREK.yml and the ref to the repository's default branch.
+func configSourceURL(source string, config config.Config) (string, error) {
+	if !strings.Contains(source, "://") {
+		match := configSourceShorthand.FindStringSubmatch(source)
+		if match == nil {
+			return "", fmt.Errorf("give a GitHub URL or owner/repo:path@ref")
+		}
+
+		path, ref := strings.TrimPrefix(match[3], "/"), match[4]
+		if len(path) == 0 {
+			path = configFile
+		}
+		if len(ref) == 0 {
+			ref = "HEAD"
+		}
+		return fmt.Sprintf("%s%s/%s/%s/%s", config.RawURL(), match[1], match[2], ref, path), nil
+	}
+
+	if err := validateRedirectURL(source, config); err != nil {
+		return "", fmt.Errorf("the URL doesn't seem to be GitHub based")
+	}
+
+	// A link to a file in the web UI gives a HTML page, so is swapped for
+	// its raw contents
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", err
+	}
+	web, err := url.Parse(config.WebURL())
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 5)
+	if strings.TrimPrefix(u.Host, "www.") == web.Host && len(parts) == 5 && parts[2] == "blob" {
+		return fmt.Sprintf("%s%s/%s/%s/%s", config.RawURL(), parts[0], parts[1], parts[3], parts[4]), nil
+	}
+
+	return source, nil
+}
+
+// repoConfigURL is where the .DEREK.yml of a repository's branch is found
+func repoConfigURL(owner, repository, branch string, config config.Config) string {
+	return fmt.Sprintf("%s%s/%s/%s/%s", config.RawURL(), owner, repository, branch, configFile)
+}
+
+// sourceConfig is a parsed config along with where it was read from
+type sourceConfig struct {
+	source string
+	config types.DerekRepoConfig
+}
+
+// configNotFoundError is returned when a config file does not exist
+type configNotFoundError struct {
+	err error
+}
+
+func (e *configNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+// configParseError is returned when a config file was read but could not
+// be parsed
+type configParseError struct {
+	err error
+}
+
+func (e *configParseError) Error() string {
+	return e.err.Error()
+}
+
+// configSourceError is an error with an entry of extends, or a redirect,
+// given along with the file and value so it can be shown on its line
+type configSourceError struct {
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func (e *configSourceError) Error() string {
+	return fmt.Sprintf("%s: %s %q: %s", e.Source, e.Key, e.Value, e.Err)
+}
+
+func (e *configSourceError) Unwrap() error {
+	return e.Err
+}
+
+// configResolver merges a .DEREK.yml with the files it extends and
+// redirects to, following them recursively.
+type configResolver struct {
+	config config.Config
+
+	// read downloads and parses the file at a URL, it is expected to cache
+	// files since many repositories can share the same ones
+	read func(sourceURL string) (types.DerekRepoConfig, error)
+}
+
+// resolve merges file, read from source, with the files it refers to. From
+// the lowest to the highest precedence these are: each entry of extends in
+// the order listed, the file itself, then the file it redirects to. Each
+// takes precedence over those before it for single values such as
+// contributing_url, whilst lists are combined. The file's own lists can
+// also remove or replace the entries of every file it refers to. The order
+// is recorded in the Sources of the result.
+func (r *configResolver) resolve(source string, file types.DerekRepoConfig, chain []string) (types.DerekRepoConfig, error) {
+	chain = append(chain[:len(chain):len(chain)], source)
+
+	var layers []types.DerekRepoConfig
+	for _, entry := range file.Extends {
+		sourceURL, err := configSourceURL(entry, r.config)
+		if err != nil {
+			return types.DerekRepoConfig{}, &configSourceError{Source: source, Key: "extends", Value: entry, Err: err}
+		}
+
+		extended, err := r.include(sourceURL, chain)
+		if err != nil {
+			return types.DerekRepoConfig{}, sourceError(source, "extends", entry, err)
+		}
+		layers = append(layers, extended)
+	}
+
+	own := file
+	own.Redirect = ""
+	own.Extends = nil
+	own.Sources = []string{source}
+
+	if len(file.Redirect) > 0 {
+		if err := validateRedirectURL(file.Redirect, r.config); err != nil {
+			return types.DerekRepoConfig{}, &configSourceError{Source: source, Key: "redirect", Value: file.Redirect, Err: err}
+		}
+
+		redirected, err := r.include(file.Redirect, chain)
+		if err != nil {
+			return types.DerekRepoConfig{}, sourceError(source, "redirect", file.Redirect, err)
+		}
+
+		// The file it redirects to keeps its single values, whilst the
+		// file's own lists are applied over its lists
+		if own, err = types.MergeDerekRepoConfigs(own, redirected); err != nil {
+			return types.DerekRepoConfig{}, err
+		}
+	}
+	layers = append(layers, own)
+
+	merged, err := mergeLayers(layers)
+	if err != nil {
+		return types.DerekRepoConfig{}, err
+	}
+
+	merged.Redirect = file.Redirect
+	merged.Extends = file.Extends
+	return merged, nil
+}
+
+// mergeLayers merges configs which have been resolved, each overrides
+// those before it and their Sources are kept in order
+func mergeLayers(layers []types.DerekRepoConfig) (types.DerekRepoConfig, error) {
+	var merged types.DerekRepoConfig
+	for i, layer := range layers {
+		var err error
+		if merged, err = types.OverrideDerekRepoConfig(merged, layer); err != nil {
+			return types.DerekRepoConfig{}, err
+		}
+
+		// The last layer's own redirect and extends are those of the result
+		if i == len(layers)-1 {
+			merged.Redirect = layer.Redirect
+			merged.Extends = layer.Extends
+		}
+	}
+	return merged, nil
+}
+
+// include reads and resolves the file at sourceURL, unless it is already being
+// resolved further up the chain or the chain is too long
+func (r *configResolver) include(sourceURL string, chain []string) (types.DerekRepoConfig, error) {
+	for _, source := range chain {
+		if source == sourceURL {
+			return types.DerekRepoConfig{}, fmt.Errorf("cycle found: %s -> %s", strings.Join(chain, " -> "), sourceURL)
+		}
+	}
+	if len(chain) > maxConfigDepth {
+		return types.DerekRepoConfig{}, fmt.Errorf("configs can only be nested %d deep", maxConfigDepth)
+	}
+
+	file, err := r.read(sourceURL)
+	if err != nil {
+		return types.DerekRepoConfig{}, err
+	}
+	return r.resolve(sourceURL, file, chain)
+}
+
+// sourceError ties err to the entry which led to it, unless a file further
+// along the chain has already been blamed
+func sourceError(source, key, value string, err error) error {
+	var existing *configSourceError
+	if errors.As(err, &existing) {
+		return err
+	}
+	return &configSourceError{Source: source, Key: key, Value: value, Err: err}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/types"
+)
+
+func Test_configSourceURL(t *testing.T) {
+	ghes := config.Config{WebBaseURL: "https://github.example.com"}
+
+	tests := []struct {
+		title  string
+		source string
+		config config.Config
+		want   string
+		err    bool
+	}{
+		{
+			title:  "Shorthand with path and ref",
+			source: "openfaas/config:teams/core.yml@v1",
+			want:   "https://raw.githubusercontent.com/openfaas/config/v1/teams/core.yml",
+		},
+		{
+			title:  "Shorthand for the repo's .DEREK.yml",
+			source: "openfaas/faas",
+			want:   "https://raw.githubusercontent.com/openfaas/faas/HEAD/.DEREK.yml",
+		},
+		{
+			title:  "Link to a file in the web UI",
+			source: "https://github.com/openfaas/faas/blob/master/.DEREK.yml",
+			want:   "https://raw.githubusercontent.com/openfaas/faas/master/.DEREK.yml",
+		},
+		{
+			title:  "Raw URL",
+			source: "https://raw.githubusercontent.com/openfaas/faas/master/.DEREK.yml",
+			want:   "https://raw.githubusercontent.com/openfaas/faas/master/.DEREK.yml",
+		},
+		{
+			title:  "Shorthand on GitHub Enterprise Server",
+			source: "org/config:base.yml@main",
+			config: ghes,
+			want:   "https://github.example.com/raw/org/config/main/base.yml",
+		},
+		{
+			title:  "URL which is not on GitHub",
+			source: "https://example.com/.DEREK.yml",
+			err:    true,
+		},
+		{
+			title:  "Not a source",
+			source: "openfaas",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, err := configSourceURL(test.source, test.config)
+			if (err != nil) != test.err {
+				t.Fatalf("want error: %v, got: %v", test.err, err)
+			}
+			if got != test.want {
+				t.Errorf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+// newTestResolver reads files from a map of raw URL to config
+func newTestResolver(files map[string]types.DerekRepoConfig) *configResolver {
+	return &configResolver{
+		read: func(sourceURL string) (types.DerekRepoConfig, error) {
+			file, ok := files[sourceURL]
+			if !ok {
+				return types.DerekRepoConfig{}, fmt.Errorf("HTTP Status code: 404 while fetching config (%s)", sourceURL)
+			}
+			return file, nil
+		},
+	}
+}
+
+const rawBase = "https://raw.githubusercontent.com/"
+
+func Test_configResolver_Precedence(t *testing.T) {
+	files := map[string]types.DerekRepoConfig{
+		rawBase + "org/config/HEAD/base.yml": {
+			Features:        []string{dcoCheckFeature},
+			Maintainers:     []string{"alexellis"},
+			ContributingURL: "https://example.com/org",
+		},
+		rawBase + "org/config/HEAD/team.yml": {
+			Extends:         []string{"org/config:base.yml"},
+			Maintainers:     []string{"rgee0"},
+			ContributingURL: "https://example.com/team",
+		},
+		rawBase + "org/config/HEAD/docs.yml": {
+			Maintainers: []string{"Waterdrips"},
+		},
+	}
+	resolver := newTestResolver(files)
+
+	local := types.DerekRepoConfig{
+		Extends:  []string{"org/config:team.yml", "org/config:docs.yml"},
+		Features: []string{commentsFeature},
+	}
+
+	merged, err := resolver.resolve(".DEREK.yml", local, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSources := []string{
+		rawBase + "org/config/HEAD/base.yml",
+		rawBase + "org/config/HEAD/team.yml",
+		rawBase + "org/config/HEAD/docs.yml",
+		".DEREK.yml",
+	}
+	if !reflect.DeepEqual(wantSources, merged.Sources) {
+		t.Errorf("want sources: %v, got: %v", wantSources, merged.Sources)
+	}
+
+	if merged.ContributingURL != "https://example.com/team" {
+		t.Errorf("want the contributing URL of the later source, got: %s", merged.ContributingURL)
+	}
+	if !EnabledFeature(dcoCheckFeature, &merged) || !EnabledFeature(commentsFeature, &merged) {
+		t.Errorf("want features from every source, got: %v", merged.Features)
+	}
+	for _, maintainer := range []string{"alexellis", "rgee0", "Waterdrips"} {
+		if !PermittedUserFeature(commentsFeature, &merged, maintainer) {
+			t.Errorf("want %s as a maintainer, got: %v", maintainer, merged.Maintainers)
+		}
+	}
+	if !reflect.DeepEqual(local.Extends, merged.Extends) {
+		t.Errorf("want the file's own extends kept, got: %v", merged.Extends)
+	}
+}
+
+func Test_configResolver_Cycle(t *testing.T) {
+	files := map[string]types.DerekRepoConfig{
+		rawBase + "org/a/HEAD/.DEREK.yml": {Extends: []string{"org/b"}},
+		rawBase + "org/b/HEAD/.DEREK.yml": {Extends: []string{"org/a"}},
+	}
+	resolver := newTestResolver(files)
+
+	_, err := resolver.resolve(rawBase+"org/a/HEAD/.DEREK.yml", files[rawBase+"org/a/HEAD/.DEREK.yml"], nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle found") {
+		t.Fatalf("want a cycle, got: %v", err)
+	}
+
+	sourceErr, ok := err.(*configSourceError)
+	if !ok || sourceErr.Source != rawBase+"org/b/HEAD/.DEREK.yml" || sourceErr.Value != "org/a" {
+		t.Errorf("want the cycle blamed on org/b's extends, got: %v", err)
+	}
+}
+
+func Test_configResolver_DepthLimit(t *testing.T) {
+	files := map[string]types.DerekRepoConfig{}
+	for i := 0; i < maxConfigDepth+2; i++ {
+		files[fmt.Sprintf("%sorg/config/HEAD/%d.yml", rawBase, i)] = types.DerekRepoConfig{
+			Extends: []string{fmt.Sprintf("org/config:%d.yml", i+1)},
+		}
+	}
+	resolver := newTestResolver(files)
+
+	_, err := resolver.resolve(".DEREK.yml", types.DerekRepoConfig{Extends: []string{"org/config:0.yml"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("want an error for the depth, got: %v", err)
+	}
+}
+
+func Test_ValidateRepoConfig_ExtendsMissingFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/org/config/HEAD/base.yml" {
+			w.Write([]byte("maintainers:\n- alexellis\nextends:\n- org/config:missing.yml\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	cfg := config.Config{RawBaseURL: server.URL}
+	data := []byte("features:\n- dco_check\nextends:\n- org/config:base.yml\n")
+
+	effective, problems := ValidateRepoConfig(context.Background(), ".DEREK.yml", data, cfg)
+	if effective != nil {
+		t.Errorf("want no config when a file is missing")
+	}
+
+	if len(problems) != 1 {
+		t.Fatalf("want one problem, got: %v", problems)
+	}
+	if p := problems[0]; p.Source != server.URL+"/org/config/HEAD/base.yml" || p.Line != 4 || p.Warning {
+		t.Errorf("want an error on line 4 of base.yml, got: %s", p)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/types"
+)
+
+// ConfigProblem is an error or a warning found in a .DEREK.yml
+type ConfigProblem struct {
+	// Source is the path or URL of the file
+	Source string
+
+	// Line is 0 when the problem is not tied to a line
+	Line    int
+	Message string
+
+	// Warning is set for problems which do not stop the file being used
+	Warning bool
+}
+
+func (p ConfigProblem) String() string {
+	severity := "error"
+	if p.Warning {
+		severity = "warning"
+	}
+
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", p.Source, p.Line, severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Source, severity, p.Message)
+}
+
+// HasConfigErrors returns true if any of the problems is not a warning
+func HasConfigErrors(problems []ConfigProblem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	yamlLine         = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownField = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// ParseRepoConfig decodes a .DEREK.yml strictly, so that unknown fields
+// such as a misspelt "feature:" are errors, and warns about features
+// which Derek does not have.
+func ParseRepoConfig(source string, data []byte) (types.DerekRepoConfig, []ConfigProblem) {
+	var repoConfig types.DerekRepoConfig
+
+	if err := yaml.UnmarshalStrict(data, &repoConfig); err != nil {
+		return repoConfig, yamlProblems(source, err)
+	}
+
+	return repoConfig, checkRepoConfig(source, data, &repoConfig)
+}
+
+// parseRepoConfigLenient decodes a .DEREK.yml for the events Derek handles,
+// where unknown fields are ignored as they were before decoding was strict.
+// Only YAML which cannot be decoded is an error, the problems which
+// ParseRepoConfig would give are all returned as warnings.
+func parseRepoConfigLenient(source string, data []byte) (types.DerekRepoConfig, []ConfigProblem, error) {
+	var repoConfig types.DerekRepoConfig
+	if err := yaml.Unmarshal(data, &repoConfig); err != nil {
+		return repoConfig, nil, errors.New(yamlProblems(source, err)[0].String())
+	}
+
+	var problems []ConfigProblem
+	if err := yaml.UnmarshalStrict(data, &types.DerekRepoConfig{}); err != nil {
+		problems = yamlProblems(source, err)
+	}
+	problems = append(problems, checkRepoConfig(source, data, &repoConfig)...)
+
+	for i := range problems {
+		problems[i].Warning = true
+	}
+	return repoConfig, problems, nil
+}
+
+// checkRepoConfig fills in maintainers from curators, and gives the
+// problems with a decoded config
+func checkRepoConfig(source string, data []byte, repoConfig *types.DerekRepoConfig) []ConfigProblem {
+	var problems []ConfigProblem
+
+	if len(repoConfig.Maintainers) == 0 && len(repoConfig.Curators) > 0 {
+		repoConfig.Maintainers = repoConfig.Curators
+	}
+
+	known := DefaultRegistry.ListedNames()
+	for _, feature := range repoConfig.Features {
+		if !containsFold(known, strings.TrimPrefix(feature, types.RemovePrefix)) {
+			problems = append(problems, ConfigProblem{
+				Source:  source,
+				Line:    findValueLine(data, "features", feature),
+				Message: fmt.Sprintf("unknown feature %q, features are: %s", feature, strings.Join(known, ", ")),
+				Warning: true,
+			})
+		}
+	}
+
+	for i, message := range repoConfig.Messages {
+		// A removal, i.e. "!docs", needs no value
+		if strings.HasPrefix(message.Name, types.RemovePrefix) && len(message.Name) > len(types.RemovePrefix) {
+			continue
+		}
+		if len(message.Name) == 0 || len(message.Value) == 0 {
+			problems = append(problems, ConfigProblem{
+				Source:  source,
+				Line:    findKeyLine(data, "custom_messages"),
+				Message: fmt.Sprintf("custom_messages entry %d needs a name and a value", i+1),
+			})
+		}
+	}
+
+	var fields []string
+	for field := range repoConfig.Merge {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		strategy := repoConfig.Merge[field]
+		line := findNestedKeyLine(data, "merge", field)
+		if !containsFold(types.MergeableFields, field) {
+			problems = append(problems, ConfigProblem{
+				Source:  source,
+				Line:    line,
+				Message: fmt.Sprintf("unknown merge field %q, fields are: %s", field, strings.Join(types.MergeableFields, ", ")),
+			})
+			continue
+		}
+		if !strings.EqualFold(strategy, types.AppendStrategy) && !strings.EqualFold(strategy, types.ReplaceStrategy) {
+			problems = append(problems, ConfigProblem{
+				Source:  source,
+				Line:    line,
+				Message: fmt.Sprintf("unknown merge strategy %q for %s, use %s or %s", strategy, field, types.AppendStrategy, types.ReplaceStrategy),
+			})
+		}
+	}
+
+	return problems
+}
+
+// errConfigProblems is returned when reading a file which has errors,
+// they have already been recorded as problems with their lines
+var errConfigProblems = errors.New("the file has errors")
+
+// ValidateRepoConfig parses a .DEREK.yml and the files it extends and
+// redirects to, and gives the config which would be used for the
+// repository. The config is nil when there are errors.
+func ValidateRepoConfig(ctx context.Context, source string, data []byte, config config.Config) (*types.DerekRepoConfig, []ConfigProblem) {
+	return validateRepoConfig(ctx, source, data, nil, config)
+}
+
+// validateRepoConfig validates a .DEREK.yml in the same way as
+// ValidateRepoConfig, with the organisation's file merged beneath it
+// when org is given, unless the file sets ignore_org_config
+func validateRepoConfig(ctx context.Context, source string, data []byte, org *sourceConfig, config config.Config) (*types.DerekRepoConfig, []ConfigProblem) {
+	localConfig, problems := ParseRepoConfig(source, data)
+	if HasConfigErrors(problems) {
+		return nil, problems
+	}
+
+	type readResult struct {
+		config types.DerekRepoConfig
+		err    error
+	}
+
+	// Files are kept to find the lines of errors, and read only once when
+	// more than one file extends them
+	files := map[string][]byte{source: data}
+	results := map[string]readResult{}
+
+	resolver := &configResolver{
+		config: config,
+		read: func(sourceURL string) (types.DerekRepoConfig, error) {
+			if result, ok := results[sourceURL]; ok {
+				return result.config, result.err
+			}
+
+			var result readResult
+			bytesConfig, _, _, err := readConfigFromURL(ctx, configHTTPClient, sourceURL, "")
+			if err != nil {
+				result.err = fmt.Errorf("unable to read config: %s", err)
+			} else {
+				var sourceProblems []ConfigProblem
+				result.config, sourceProblems = ParseRepoConfig(sourceURL, bytesConfig)
+				problems = append(problems, sourceProblems...)
+				files[sourceURL] = bytesConfig
+				if HasConfigErrors(sourceProblems) {
+					result.err = errConfigProblems
+				}
+			}
+
+			results[sourceURL] = result
+			return result.config, result.err
+		},
+	}
+
+	layers := []sourceConfig{{source: source, config: localConfig}}
+	if org != nil && !localConfig.IgnoresOrgConfig() {
+		layers = append([]sourceConfig{*org}, layers...)
+	}
+
+	var resolved []types.DerekRepoConfig
+	for _, layer := range layers {
+		layerConfig, err := resolver.resolve(layer.source, layer.config, nil)
+		if err != nil {
+			if errors.Is(err, errConfigProblems) {
+				return nil, problems
+			}
+
+			problem := ConfigProblem{Source: layer.source, Message: err.Error()}
+			var sourceErr *configSourceError
+			if errors.As(err, &sourceErr) {
+				problem.Source = sourceErr.Source
+				problem.Line = findValueLine(files[sourceErr.Source], sourceErr.Key, sourceErr.Value)
+				problem.Message = fmt.Sprintf("%s %q: %s", sourceErr.Key, sourceErr.Value, sourceErr.Err)
+			}
+			return nil, append(problems, problem)
+		}
+		resolved = append(resolved, layerConfig)
+	}
+
+	mergedConfig, err := mergeLayers(resolved)
+	if err != nil {
+		return nil, append(problems, ConfigProblem{Source: source, Message: err.Error()})
+	}
+
+	effective, err := applyOperatorConfig(mergedConfig, config.Operator)
+	if err != nil {
+		return nil, append(problems, ConfigProblem{Source: source, Message: err.Error()})
+	}
+
+	return effective, problems
+}
+
+// yamlProblems gives a problem for each line of a yaml.v2 error
+func yamlProblems(source string, err error) []ConfigProblem {
+	messages := []string{err.Error()}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	var problems []ConfigProblem
+	for _, message := range messages {
+		problem := ConfigProblem{Source: source, Message: message}
+
+		if match := yamlLine.FindStringSubmatch(message); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+			problem.Message = match[2]
+		}
+		if match := yamlUnknownField.FindStringSubmatch(problem.Message); match != nil {
+			problem.Message = fmt.Sprintf("unknown field %q", match[1])
+		}
+
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// findKeyLine gives the line of a top-level key, or 0 when it is not found
+func findKeyLine(data []byte, key string) int {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if strings.HasPrefix(scanner.Text(), key+":") {
+			return line
+		}
+	}
+	return 0
+}
+
+// findValueLine gives the line of value within the list under a top-level
+// key, or the line of the key itself when the value cannot be found
+func findValueLine(data []byte, key, value string) int {
+	keyLine := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		if strings.HasPrefix(text, key+":") {
+			keyLine = line
+			if strings.Contains(text, value) {
+				return line
+			}
+			continue
+		}
+
+		if keyLine == 0 {
+			continue
+		}
+
+		// Another top-level key ends the list
+		if len(text) > 0 && text[0] != ' ' && text[0] != '\t' && text[0] != '-' && text[0] != '#' {
+			break
+		}
+
+		item := strings.TrimSpace(text)
+		if !strings.HasPrefix(item, "-") {
+			continue
+		}
+		item = strings.TrimSpace(strings.TrimPrefix(item, "-"))
+		if i := strings.Index(item, " #"); i >= 0 {
+			item = strings.TrimSpace(item[:i])
+		}
+		if strings.Trim(item, `"'`) == value {
+			return line
+		}
+	}
+
+	return keyLine
+}
+
+// findNestedKeyLine gives the line of a key within a top-level map, or the
+// line of the map itself when the key cannot be found
+func findNestedKeyLine(data []byte, key, nested string) int {
+	keyLine := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		if strings.HasPrefix(text, key+":") {
+			keyLine = line
+			continue
+		}
+		if keyLine == 0 {
+			continue
+		}
+
+		// Another top-level key ends the map
+		if len(text) > 0 && text[0] != ' ' && text[0] != '\t' && text[0] != '#' {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), nested+":") {
+			return line
+		}
+	}
+
+	return keyLine
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
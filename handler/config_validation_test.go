@@ -0,0 +1,247 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/types"
+)
+
+func Test_ParseRepoConfig_UnknownFields(t *testing.T) {
+	data := []byte(`maintainers:
+- alexellis
+feature:
+- dco_check
+maintainer:
+- rgee0
+`)
+
+	_, problems := ParseRepoConfig(".DEREK.yml", data)
+
+	want := []ConfigProblem{
+		{Source: ".DEREK.yml", Line: 3, Message: `unknown field "feature"`},
+		{Source: ".DEREK.yml", Line: 5, Message: `unknown field "maintainer"`},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("want: %v, got: %v", want, problems)
+	}
+}
+
+func Test_ParseRepoConfig_SyntaxError(t *testing.T) {
+	_, problems := ParseRepoConfig(".DEREK.yml", []byte("features:\n- dco_check\n  - comments: [\n"))
+
+	if len(problems) != 1 || problems[0].Line == 0 || problems[0].Warning {
+		t.Errorf("want one error with a line number, got: %v", problems)
+	}
+}
+
+func Test_ParseRepoConfig_UnknownFeatures(t *testing.T) {
+	data := []byte(`features:
+  - dco_check
+  - "hacktoberfst" # typo
+  - Comments
+custom_messages:
+  - name: docs
+`)
+
+	repoConfig, problems := ParseRepoConfig(".DEREK.yml", data)
+
+	if len(repoConfig.Features) != 3 {
+		t.Errorf("want every feature kept, got: %v", repoConfig.Features)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("want 2 problems, got: %v", problems)
+	}
+
+	if !problems[0].Warning || problems[0].Line != 3 || !strings.Contains(problems[0].Message, `"hacktoberfst"`) {
+		t.Errorf("want a warning for hacktoberfst on line 3, got: %s", problems[0])
+	}
+	if problems[1].Warning || problems[1].Line != 5 {
+		t.Errorf("want an error for custom_messages on line 5, got: %s", problems[1])
+	}
+}
+
+// Unknown fields are only errors when validating, the events Derek handles
+// still use the file
+func Test_parseConfig_Lenient(t *testing.T) {
+	repoConfig := types.DerekRepoConfig{}
+	if err := parseConfig(context.Background(), configFile, []byte("featurs:\n- dco_check\nmaintainers:\n- alexellis\n"), &repoConfig); err != nil {
+		t.Errorf("want unknown fields to be allowed, got: %s", err)
+	}
+	if want := []string{"alexellis"}; !reflect.DeepEqual(want, repoConfig.Maintainers) {
+		t.Errorf("want maintainers: %v, got: %v", want, repoConfig.Maintainers)
+	}
+
+	if err := parseConfig(context.Background(), configFile, []byte("features:\n- not_a_feature\n"), &repoConfig); err != nil {
+		t.Errorf("want unknown features to be allowed, got: %s", err)
+	}
+
+	err := parseConfig(context.Background(), configFile, []byte("features:\n- dco_check\n  - comments: [\n"), &repoConfig)
+	if err == nil || !strings.HasPrefix(err.Error(), ".DEREK.yml:") {
+		t.Errorf("want an error for invalid YAML, got: %v", err)
+	}
+}
+
+func Test_parseRepoConfigLenient_Warnings(t *testing.T) {
+	_, problems, err := parseRepoConfigLenient(".DEREK.yml", []byte("featurs:\n- dco_check\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `.DEREK.yml:1: warning: unknown field "featurs"`
+	if len(problems) != 1 || problems[0].String() != want {
+		t.Errorf("want: %q, got: %v", want, problems)
+	}
+}
+
+func Test_ValidateRepoConfig_Redirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("maintainers:\n- alexellis\nfeatures:\n- comments\n- no_newbie\n"))
+	}))
+	defer server.Close()
+
+	cfg := config.Config{RawBaseURL: server.URL}
+	data := []byte("redirect: " + server.URL + "/org/config/master/.DEREK.yml\nfeatures:\n- dco_check\n")
+
+	effective, problems := ValidateRepoConfig(context.Background(), ".DEREK.yml", data, cfg)
+	if effective == nil {
+		t.Fatalf("want a config, got problems: %v", problems)
+	}
+
+	if len(problems) != 1 || problems[0].Source != server.URL+"/org/config/master/.DEREK.yml" || problems[0].Line != 5 {
+		t.Errorf("want a warning for no_newbie in the redirect, got: %v", problems)
+	}
+	if want := []string{"comments", "no_newbie", "dco_check"}; !reflect.DeepEqual(effective.Features, want) {
+		t.Errorf("want features: %v, got: %v", want, effective.Features)
+	}
+	if want := []string{"alexellis"}; !reflect.DeepEqual(effective.Maintainers, want) {
+		t.Errorf("want maintainers: %v, got: %v", want, effective.Maintainers)
+	}
+}
+
+func Test_ValidateRepoConfig_InvalidRedirect(t *testing.T) {
+	data := []byte("features:\n- dco_check\nredirect: https://example.com/.DEREK.yml\n")
+
+	effective, problems := ValidateRepoConfig(context.Background(), ".DEREK.yml", data, config.Config{})
+	if effective != nil {
+		t.Errorf("want no config for an invalid redirect")
+	}
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Warning {
+		t.Errorf("want an error on line 3, got: %v", problems)
+	}
+}
+
+func Test_ParseRepoConfig_MergeStrategies(t *testing.T) {
+	data := []byte(`features:
+- "!hacktoberfest"
+custom_messages:
+- name: "!docs"
+merge:
+  maintainers: replace
+  features: prepend
+  labels: replace
+`)
+
+	_, problems := ParseRepoConfig(".DEREK.yml", data)
+
+	want := []ConfigProblem{
+		{Source: ".DEREK.yml", Line: 7, Message: `unknown merge strategy "prepend" for features, use append or replace`},
+		{Source: ".DEREK.yml", Line: 8, Message: `unknown merge field "labels", fields are: features, maintainers, curators, custom_messages, required_in_issues`},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("want: %v, got: %v", want, problems)
+	}
+}
+
+func Test_ValidateRepoConfig_RedirectRemovals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("maintainers:\n- alexellis\n- rgee0\nfeatures:\n- dco_check\n- hacktoberfest\ncontributing_url: https://example.com/org\n"))
+	}))
+	defer server.Close()
+
+	cfg := config.Config{RawBaseURL: server.URL}
+	data := []byte("redirect: " + server.URL + "/org/config/master/.DEREK.yml\nfeatures:\n- \"!hacktoberfest\"\n- comments\nmaintainers:\n- Waterdrips\nmerge:\n  maintainers: replace\ncontributing_url: https://example.com/repo\n")
+
+	effective, problems := ValidateRepoConfig(context.Background(), ".DEREK.yml", data, cfg)
+	if effective == nil {
+		t.Fatalf("want a config, got problems: %v", problems)
+	}
+
+	if want := []string{"dco_check", "comments"}; !reflect.DeepEqual(effective.Features, want) {
+		t.Errorf("want features: %v, got: %v", want, effective.Features)
+	}
+	if want := []string{"Waterdrips"}; !reflect.DeepEqual(effective.Maintainers, want) {
+		t.Errorf("want maintainers: %v, got: %v", want, effective.Maintainers)
+	}
+	if want := "https://example.com/org"; effective.ContributingURL != want {
+		t.Errorf("want the contributing URL of the file redirected to: %q, got: %q", want, effective.ContributingURL)
+	}
+	if want := []string{".DEREK.yml", server.URL + "/org/config/master/.DEREK.yml"}; !reflect.DeepEqual(effective.Sources, want) {
+		t.Errorf("want sources: %v, got: %v", want, effective.Sources)
+	}
+}
+
+// The published schema has to list the same fields and features as Derek
+func Test_Schema_MatchesConfig(t *testing.T) {
+	data, err := ioutil.ReadFile("../schema/DEREK.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := struct {
+		Properties map[string]struct {
+			Items struct {
+				AnyOf []struct {
+					Enum []string `json:"enum"`
+				} `json:"anyOf"`
+			} `json:"items"`
+		} `json:"properties"`
+	}{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+
+	var fields []string
+	configType := reflect.TypeOf(types.DerekRepoConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	if !reflect.DeepEqual(properties, fields) {
+		t.Errorf("want schema properties: %v, got: %v", fields, properties)
+	}
+
+	var features []string
+	if anyOf := schema.Properties["features"].Items.AnyOf; len(anyOf) > 0 {
+		features = anyOf[0].Enum
+	}
+	if !reflect.DeepEqual(features, DefaultRegistry.ListedNames()) {
+		t.Errorf("want schema features: %v, got: %v", DefaultRegistry.ListedNames(), features)
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/metrics"
+	"github.com/alexellis/derek/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Event is a webhook delivery which has passed the customer check
+// and had its repository's .DEREK.yml loaded, ready for features.
+type Event struct {
+	// Type is the X-GitHub-Event header, i.e. "pull_request"
+	Type string
+
+	// Action is the "action" field of the payload, i.e. "opened"
+	Action string
+
+	// Payload is the raw JSON body of the webhook
+	Payload []byte
+
+	Repository     types.Repository
+	InstallationID int
+
+	DerekConfig *types.DerekRepoConfig
+
+	// ConfigErr is set when the repository's .DEREK.yml could not be
+	// loaded, DerekConfig is then empty and only the features which
+	// implement ConfigIndependent are run
+	ConfigErr error
+
+	Config          config.Config
+	ContributingURL string
+
+	// GitHub is the client features use to call the API, when nil
+	// a client is made for the installation on first use
+	GitHub *GitHub
+
+	clientMu sync.Mutex
+
+	// pullRequest is shared by the features handling a pull_request event
+	pullRequestOnce sync.Once
+	pullRequest     *pullRequestData
+}
+
+// Client returns the GitHub client for the event's installation, so
+// that every feature handling the event shares a single client.
+func (e *Event) Client(ctx context.Context) (*GitHub, error) {
+	e.clientMu.Lock()
+	defer e.clientMu.Unlock()
+
+	if e.GitHub == nil {
+		client, err := makeClient(ctx, e.InstallationID, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		e.GitHub = NewGitHub(client)
+	}
+	return e.GitHub, nil
+}
+
+// pullRequestData gives the PR data shared by every feature handling the event
+func (e *Event) pullRequestData() *pullRequestData {
+	e.pullRequestOnce.Do(func() {
+		e.pullRequest = &pullRequestData{}
+	})
+	return e.pullRequest
+}
+
+// Decode unmarshals the payload into v, i.e. a types.PullRequestOuter
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("cannot parse %s payload: %s", e.Type, err)
+	}
+	return nil
+}
+
+// Subscription is an event type and the actions of that event which
+// a feature handles, when Actions is empty then all actions are handled.
+type Subscription struct {
+	Event   string
+	Actions []string
+}
+
+func (s Subscription) matches(eventType, action string) bool {
+	if s.Event != eventType {
+		return false
+	}
+	if len(s.Actions) == 0 {
+		return true
+	}
+	for _, a := range s.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Feature is a unit of behaviour which Derek runs in response to events,
+// features can be added to the DefaultRegistry via Register.
+type Feature interface {
+	// Name is the feature's name as given in .DEREK.yml
+	Name() string
+
+	// Subscriptions lists the events and actions the feature handles
+	Subscriptions() []Subscription
+
+	// Order decides when the feature runs relative to the others
+	// subscribed to the same event, lower values run first. Features
+	// with the same Order run concurrently, so must not depend on
+	// each other's changes.
+	Order() int
+
+	// Enabled returns true if the repository has turned the feature on
+	Enabled(event *Event) bool
+
+	// Handle acts on the event, setting Stop on the returned
+	// Result prevents any later features from running
+	Handle(ctx context.Context, event *Event) *Result
+}
+
+// Unlisted is implemented by features which are not turned on by listing
+// them under features in .DEREK.yml, i.e. those which always run or are
+// turned on by another field
+type Unlisted interface {
+	Unlisted() bool
+}
+
+// ConfigIndependent is implemented by features which still run when the
+// repository's .DEREK.yml is missing or cannot be read, i.e. the check of
+// a PR which adds or fixes the file
+type ConfigIndependent interface {
+	RunsWithoutConfig() bool
+}
+
+// Registry holds the features Derek can run
+type Registry struct {
+	mu       sync.RWMutex
+	features []Feature
+}
+
+// DefaultRegistry holds Derek's built-in features along with any
+// added through Register
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a feature to the DefaultRegistry, and panics if a
+// feature with the same name is already registered.
+func Register(feature Feature) {
+	if err := DefaultRegistry.Register(feature); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a feature, names must be unique within a Registry
+func (r *Registry) Register(feature Feature) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.features {
+		if f.Name() == feature.Name() {
+			return fmt.Errorf("feature %q is already registered", feature.Name())
+		}
+	}
+
+	r.features = append(r.features, feature)
+	return nil
+}
+
+// Events returns the sorted event types which at least one feature handles
+func (r *Registry) Events() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var events []string
+	for _, f := range r.features {
+		for _, s := range f.Subscriptions() {
+			if !seen[s.Event] {
+				seen[s.Event] = true
+				events = append(events, s.Event)
+			}
+		}
+	}
+
+	sort.Strings(events)
+	return events
+}
+
+// Names returns the sorted names of the registered features
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for _, f := range r.features {
+		names = append(names, f.Name())
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ListedNames returns the sorted names of the registered features which
+// can be turned on by listing them under features in .DEREK.yml
+func (r *Registry) ListedNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for _, f := range r.features {
+		if unlisted, ok := f.(Unlisted); ok && unlisted.Unlisted() {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Handles returns true if any feature handles the event type
+func (r *Registry) Handles(eventType string) bool {
+	for _, e := range r.Events() {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribed returns the features which handle the event type and action
+// in the order they should run. Features with the same Order are given in
+// the order they were registered.
+func (r *Registry) Subscribed(eventType, action string) []Feature {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var subscribed []Feature
+	for _, f := range r.features {
+		for _, s := range f.Subscriptions() {
+			if s.matches(eventType, action) {
+				subscribed = append(subscribed, f)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(subscribed, func(i, j int) bool {
+		return subscribed[i].Order() < subscribed[j].Order()
+	})
+	return subscribed
+}
+
+// Handle runs each enabled feature subscribed to the event and adds its
+// result to the report. Features with the same Order run concurrently and
+// their results are added in the order the features were registered. A
+// failing feature does not stop later features, only a result with Stop
+// set does, once the other features with the same Order have finished.
+// Once ctx is done the remaining features are listed in the report as
+// not run.
+func (r *Registry) Handle(ctx context.Context, event *Event, report *Report) {
+	defer func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			report.TimedOut = true
+		}
+	}()
+
+	for _, group := range groupByOrder(r.Subscribed(event.Type, event.Action)) {
+		var enabled []Feature
+		for _, feature := range group {
+			if r.enabled(feature, event) {
+				enabled = append(enabled, feature)
+			}
+		}
+
+		if ctx.Err() != nil {
+			for _, feature := range enabled {
+				report.NotRun = append(report.NotRun, feature.Name())
+			}
+			continue
+		}
+
+		results := make([]*Result, len(enabled))
+		var wg sync.WaitGroup
+		for i, feature := range enabled {
+			wg.Add(1)
+			go func(i int, feature Feature) {
+				defer wg.Done()
+				results[i] = runFeature(ctx, event, feature)
+			}(i, feature)
+		}
+		wg.Wait()
+
+		stop := false
+		for i, result := range results {
+			if result == nil {
+				continue
+			}
+
+			report.Add(result)
+			metrics.FeatureRuns.Inc(result.Feature, result.outcome())
+
+			if result.Stop {
+				logging.FromContext(ctx).WithField(logging.FeatureField, enabled[i].Name()).
+					Info("Feature stopped processing of the event")
+				stop = true
+			}
+		}
+		if stop {
+			break
+		}
+	}
+}
+
+// enabled is the one check every feature passes through before it runs:
+// the operator has not disabled it for every repository, it does not need
+// a .DEREK.yml which could not be loaded, and it is enabled for the event
+func (r *Registry) enabled(feature Feature, event *Event) bool {
+	if event.Config.Operator.FeatureDisabled(feature.Name()) {
+		return false
+	}
+	if event.ConfigErr != nil && !runsWithoutConfig(feature) {
+		return false
+	}
+	return feature.Enabled(event)
+}
+
+func runsWithoutConfig(feature Feature) bool {
+	independent, ok := feature.(ConfigIndependent)
+	return ok && independent.RunsWithoutConfig()
+}
+
+// runFeature handles the event with a single feature and times it
+func runFeature(ctx context.Context, event *Event, feature Feature) *Result {
+	featureCtx := logging.WithFields(ctx, logrus.Fields{logging.FeatureField: feature.Name()})
+	logging.FromContext(featureCtx).Info("Running feature")
+
+	start := time.Now()
+	result := feature.Handle(featureCtx, event)
+	metrics.FeatureDuration.Observe(time.Since(start).Seconds(), feature.Name())
+
+	if result != nil && len(result.Feature) == 0 {
+		result.Feature = feature.Name()
+	}
+	return result
+}
+
+// groupByOrder splits features which are sorted by Order into a
+// group for each Order
+func groupByOrder(features []Feature) [][]Feature {
+	var groups [][]Feature
+	for i, feature := range features {
+		if i == 0 || feature.Order() != features[i-1].Order() {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], feature)
+	}
+	return groups
+}
@@ -0,0 +1,305 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/types"
+)
+
+type testFeature struct {
+	name          string
+	order         int
+	subscriptions []Subscription
+	disabled      bool
+	stop          bool
+	ran           *[]string
+
+	// untilDone blocks Handle until the deadline passes
+	untilDone bool
+
+	// meet blocks Handle until every feature sharing it is running
+	meet *sync.WaitGroup
+}
+
+// ranMu guards the ran slices, since features with the same Order
+// run concurrently
+var ranMu sync.Mutex
+
+func (f *testFeature) Name() string                  { return f.name }
+func (f *testFeature) Subscriptions() []Subscription { return f.subscriptions }
+func (f *testFeature) Order() int                    { return f.order }
+func (f *testFeature) Enabled(event *Event) bool     { return !f.disabled }
+
+func (f *testFeature) Handle(ctx context.Context, event *Event) *Result {
+	ranMu.Lock()
+	*f.ran = append(*f.ran, f.name)
+	ranMu.Unlock()
+
+	result := NewResult(f.name)
+	result.Stop = f.stop
+	if f.untilDone {
+		<-ctx.Done()
+		result.Fail(ctx.Err())
+	}
+	if f.meet != nil {
+		f.meet.Done()
+		met := make(chan struct{})
+		go func() {
+			f.meet.Wait()
+			close(met)
+		}()
+		select {
+		case <-met:
+		case <-time.After(time.Second):
+			result.Fail(fmt.Errorf("%s ran alone", f.name))
+		}
+	}
+	return result
+}
+
+func Test_Registry_RunsInOrder(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	prEvents := []Subscription{{Event: "pull_request"}}
+
+	r.Register(&testFeature{name: "third", order: 30, subscriptions: prEvents, ran: &ran})
+	r.Register(&testFeature{name: "first", order: 10, subscriptions: prEvents, ran: &ran})
+	r.Register(&testFeature{name: "second-a", order: 20, subscriptions: prEvents, ran: &ran})
+	r.Register(&testFeature{name: "second-b", order: 20, subscriptions: prEvents, ran: &ran})
+
+	report := NewReport("pull_request")
+	r.Handle(context.Background(), &Event{Type: "pull_request", Action: "opened"}, report)
+
+	if len(ran) != 4 || ran[0] != "first" || ran[3] != "third" {
+		t.Errorf("want features to run in order of Order, got: %v", ran)
+	}
+
+	want := []string{"first", "second-a", "second-b", "third"}
+	var got []string
+	for _, result := range report.Results {
+		got = append(got, result.Feature)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want results in the order features were registered: %v, got: %v", want, got)
+	}
+}
+
+func Test_Registry_RunsSameOrderConcurrently(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	prEvents := []Subscription{{Event: "pull_request"}}
+
+	meet := &sync.WaitGroup{}
+	meet.Add(2)
+	r.Register(&testFeature{name: "dco", order: 10, subscriptions: prEvents, meet: meet, ran: &ran})
+	r.Register(&testFeature{name: "description", order: 10, subscriptions: prEvents, meet: meet, stop: true, ran: &ran})
+	r.Register(&testFeature{name: "later", order: 20, subscriptions: prEvents, ran: &ran})
+
+	report := NewReport("pull_request")
+	r.Handle(context.Background(), &Event{Type: "pull_request", Action: "opened"}, report)
+
+	if err := report.Err(); err != nil {
+		t.Errorf("want features with the same Order to run together, got: %s", err)
+	}
+	if len(report.Results) != 2 {
+		t.Errorf("want both results before Stop took effect, got: %d", len(report.Results))
+	}
+	for _, name := range ran {
+		if name == "later" {
+			t.Errorf("want Stop to skip features with a higher Order")
+		}
+	}
+}
+
+func Test_Registry_StopSkipsLaterFeatures(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	prEvents := []Subscription{{Event: "pull_request"}}
+
+	r.Register(&testFeature{name: "dco", order: 10, subscriptions: prEvents, ran: &ran})
+	r.Register(&testFeature{name: "spam", order: 20, subscriptions: prEvents, stop: true, ran: &ran})
+	r.Register(&testFeature{name: "later", order: 30, subscriptions: prEvents, ran: &ran})
+
+	r.Handle(context.Background(), &Event{Type: "pull_request", Action: "opened"}, NewReport("pull_request"))
+
+	want := []string{"dco", "spam"}
+	if !reflect.DeepEqual(want, ran) {
+		t.Errorf("want: %v, got: %v", want, ran)
+	}
+}
+
+func Test_Registry_ReportsFeaturesNotRunAfterDeadline(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	prEvents := []Subscription{{Event: "pull_request"}}
+
+	r.Register(&testFeature{name: "dco", order: 10, subscriptions: prEvents, ran: &ran})
+	r.Register(&testFeature{name: "slow", order: 20, subscriptions: prEvents, untilDone: true, ran: &ran})
+	r.Register(&testFeature{name: "later", order: 30, subscriptions: prEvents, ran: &ran})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	report := NewReport("pull_request")
+	r.Handle(ctx, &Event{Type: "pull_request", Action: "opened"}, report)
+
+	if want := []string{"dco", "slow"}; !reflect.DeepEqual(want, ran) {
+		t.Errorf("want: %v, got: %v", want, ran)
+	}
+	if !report.TimedOut {
+		t.Errorf("want the report to be marked as timed out")
+	}
+	if want := []string{"later"}; !reflect.DeepEqual(want, report.NotRun) {
+		t.Errorf("want not run: %v, got: %v", want, report.NotRun)
+	}
+	if len(report.Results) != 2 {
+		t.Errorf("want the results of the features which ran, got: %d", len(report.Results))
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "deadline exceeded before running: later") {
+		t.Errorf("want the features not run in the error, got: %v", err)
+	}
+}
+
+func Test_Registry_SkipsDisabledAndUnsubscribed(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+
+	r.Register(&testFeature{name: "disabled", subscriptions: []Subscription{{Event: "issues"}}, disabled: true, ran: &ran})
+	r.Register(&testFeature{name: "opened-only", subscriptions: []Subscription{{Event: "issues", Actions: []string{"opened"}}}, ran: &ran})
+	r.Register(&testFeature{name: "other-event", subscriptions: []Subscription{{Event: "release"}}, ran: &ran})
+
+	r.Handle(context.Background(), &Event{Type: "issues", Action: "edited"}, NewReport("issues"))
+	if len(ran) != 0 {
+		t.Errorf("want no features to run, got: %v", ran)
+	}
+
+	r.Handle(context.Background(), &Event{Type: "issues", Action: "opened"}, NewReport("issues"))
+	if want := []string{"opened-only"}; !reflect.DeepEqual(want, ran) {
+		t.Errorf("want: %v, got: %v", want, ran)
+	}
+}
+
+func Test_Registry_DuplicateName(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+
+	if err := r.Register(&testFeature{name: "comments", ran: &ran}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(&testFeature{name: "comments", ran: &ran}); err == nil {
+		t.Errorf("want an error registering a duplicate feature")
+	}
+}
+
+func Test_DefaultRegistry_BuiltinFeatures(t *testing.T) {
+	want := []string{"issue_comment", "issues", "pull_request", "release"}
+	if got := DefaultRegistry.Events(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want events: %v, got: %v", want, got)
+	}
+
+	var names []string
+	for _, f := range DefaultRegistry.Subscribed("pull_request", "opened") {
+		names = append(names, f.Name())
+	}
+
+	wantNames := []string{dcoCheckFeature, prDescriptionRequiredFeature, configLintFeature, noNewbiesFeature, hacktoberfestFeature}
+	if !reflect.DeepEqual(wantNames, names) {
+		t.Errorf("want pull_request features: %v, got: %v", wantNames, names)
+	}
+
+	if got := DefaultRegistry.Subscribed("issue_comment", "deleted"); len(got) != 0 {
+		t.Errorf("want no features for deleted comments, got: %d", len(got))
+	}
+}
+
+func Test_DefaultRegistry_ListedNames(t *testing.T) {
+	want := []string{commentsFeature, dcoCheckFeature, hacktoberfestFeature, noNewbiesFeature, prDescriptionRequiredFeature, releaseNotesFeature}
+	if got := DefaultRegistry.ListedNames(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want features which can be listed: %v, got: %v", want, got)
+	}
+}
+
+func Test_DefaultRegistry_OperatorDisablesUnlistedFeatures(t *testing.T) {
+	// An event for each unlisted feature which it would otherwise handle
+	events := map[string]*Event{
+		configLintFeature: {
+			Type:        "pull_request",
+			Action:      "opened",
+			Payload:     []byte(`{"action": "opened", "pull_request": {"state": "open"}}`),
+			DerekConfig: &types.DerekRepoConfig{},
+		},
+		requiredInIssuesFeature: {
+			Type:        "issues",
+			Action:      "opened",
+			Payload:     []byte(`{"action": "opened"}`),
+			DerekConfig: &types.DerekRepoConfig{RequiredInIssues: []string{"## Expected Behaviour"}},
+		},
+	}
+
+	for _, feature := range DefaultRegistry.features {
+		if unlisted, ok := feature.(Unlisted); !ok || !unlisted.Unlisted() {
+			continue
+		}
+
+		t.Run(feature.Name(), func(t *testing.T) {
+			event, ok := events[feature.Name()]
+			if !ok {
+				t.Fatalf("want an event for %s", feature.Name())
+			}
+
+			if !DefaultRegistry.enabled(feature, event) {
+				t.Fatalf("want %s enabled by default", feature.Name())
+			}
+
+			event.Config.Operator.DisabledFeatures = []string{feature.Name()}
+			if DefaultRegistry.enabled(feature, event) {
+				t.Errorf("want %s turned off by the operator", feature.Name())
+			}
+		})
+	}
+}
+
+func Test_openPullRequestFeature(t *testing.T) {
+	tests := []struct {
+		title   string
+		payload string
+		want    bool
+	}{
+		{
+			title:   "Open PR with feature enabled",
+			payload: `{"action": "opened", "pull_request": {"state": "open"}}`,
+			want:    true,
+		},
+		{
+			title:   "Closing a PR",
+			payload: `{"action": "closed", "pull_request": {"state": "closed"}}`,
+			want:    false,
+		},
+		{
+			title:   "Labelling a closed PR",
+			payload: `{"action": "labeled", "pull_request": {"state": "closed"}}`,
+			want:    false,
+		},
+	}
+
+	enabled := openPullRequestFeature(dcoCheckFeature)
+	derekConfig := &types.DerekRepoConfig{Features: []string{dcoCheckFeature}}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			event := &Event{Type: "pull_request", Payload: []byte(test.payload), DerekConfig: derekConfig}
+			if got := enabled(event); got != test.want {
+				t.Errorf("want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
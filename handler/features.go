@@ -0,0 +1,255 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// The order in which the built-in pull_request features run. The DCO and
+// description checks change different labels, and the config check only
+// posts a check run, so they run concurrently.
+// The spam checks come last since they close the PR and stop any later
+// features.
+const (
+	dcoCheckOrder              = 10
+	prDescriptionRequiredOrder = 10
+	configLintOrder            = 10
+	noNewbiesOrder             = 30
+	hacktoberfestOrder         = 40
+)
+
+func init() {
+	Register(&builtinFeature{
+		name:          dcoCheckFeature,
+		order:         dcoCheckOrder,
+		subscriptions: []Subscription{{Event: "pull_request"}},
+		enabled:       openPullRequestFeature(dcoCheckFeature),
+		handle: pullRequestHandler(dcoCheckFeature, func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result {
+			return HandlePullRequest(ctx, client, req, event.ContributingURL, event.Config)
+		}),
+	})
+
+	Register(&builtinFeature{
+		name:          prDescriptionRequiredFeature,
+		order:         prDescriptionRequiredOrder,
+		subscriptions: []Subscription{{Event: "pull_request"}},
+		enabled:       openPullRequestFeature(prDescriptionRequiredFeature),
+		handle: pullRequestHandler(prDescriptionRequiredFeature, func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result {
+			return VerifyPullRequestDescription(ctx, client, req, event.ContributingURL)
+		}),
+	})
+
+	// config_lint is not listed in .DEREK.yml, it runs on every PR which
+	// changes the file unless the operator disables it, including PRs which
+	// add the file or fix one which cannot be loaded
+	Register(&builtinFeature{
+		name:          configLintFeature,
+		order:         configLintOrder,
+		unlisted:      true,
+		withoutConfig: true,
+		subscriptions: []Subscription{{Event: "pull_request", Actions: []string{"opened", "synchronize", "reopened"}}},
+		enabled: func(event *Event) bool {
+			req := types.PullRequestOuter{}
+			if err := event.Decode(&req); err != nil {
+				return false
+			}
+			return req.PullRequest.State != ClosedConstant
+		},
+		handle: pullRequestHandler(configLintFeature, func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result {
+			return HandleConfigLint(ctx, client, req, event.DerekConfig, event.Config)
+		}),
+	})
+
+	Register(&builtinFeature{
+		name:          noNewbiesFeature,
+		order:         noNewbiesOrder,
+		subscriptions: []Subscription{{Event: "pull_request"}},
+		enabled:       openPullRequestFeature(noNewbiesFeature),
+		handle: pullRequestHandler(noNewbiesFeature, func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result {
+			return HandleFirstTimerPR(ctx, client, req, event.ContributingURL)
+		}),
+	})
+
+	Register(&builtinFeature{
+		name:          hacktoberfestFeature,
+		order:         hacktoberfestOrder,
+		subscriptions: []Subscription{{Event: "pull_request"}},
+		enabled:       openPullRequestFeature(hacktoberfestFeature),
+		handle: pullRequestHandler(hacktoberfestFeature, func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result {
+			return HandleHacktoberfestPR(ctx, client, req, event.ContributingURL)
+		}),
+	})
+
+	Register(&builtinFeature{
+		name:          commentsFeature,
+		subscriptions: []Subscription{{Event: "issue_comment", Actions: []string{"created", "edited"}}},
+		enabled: func(event *Event) bool {
+			req := types.IssueCommentOuter{}
+			if err := event.Decode(&req); err != nil {
+				return false
+			}
+			return PermittedUserFeature(commentsFeature, event.DerekConfig, req.Comment.User.Login)
+		},
+		handle: func(ctx context.Context, event *Event) *Result {
+			req := types.IssueCommentOuter{}
+			if err := event.Decode(&req); err != nil {
+				return failedResult(commentsFeature, err)
+			}
+			client, err := event.Client(ctx)
+			if err != nil {
+				return failedResult(commentsFeature, err)
+			}
+			return HandleComment(ctx, client, req, event.DerekConfig)
+		},
+	})
+
+	Register(&builtinFeature{
+		name:          requiredInIssuesFeature,
+		unlisted:      true,
+		subscriptions: []Subscription{{Event: "issues", Actions: []string{"opened"}}},
+		enabled: func(event *Event) bool {
+			return len(event.DerekConfig.RequiredInIssues) > 0
+		},
+		handle: func(ctx context.Context, event *Event) *Result {
+			req := types.IssuesOuter{}
+			if err := event.Decode(&req); err != nil {
+				return failedResult(requiredInIssuesFeature, err)
+			}
+			client, err := event.Client(ctx)
+			if err != nil {
+				return failedResult(requiredInIssuesFeature, err)
+			}
+			return CheckIssueTemplateHeadings(ctx, client, req, event.DerekConfig)
+		},
+	})
+
+	Register(&builtinFeature{
+		name:          releaseNotesFeature,
+		subscriptions: []Subscription{{Event: "release", Actions: []string{"created"}}},
+		enabled: func(event *Event) bool {
+			return EnabledFeature(releaseNotesFeature, event.DerekConfig)
+		},
+		handle: handleRelease,
+	})
+}
+
+// builtinFeature adapts Derek's handler functions to the Feature interface
+type builtinFeature struct {
+	name          string
+	order         int
+	subscriptions []Subscription
+	enabled       func(event *Event) bool
+	handle        func(ctx context.Context, event *Event) *Result
+
+	// unlisted is set for features which are not turned on by listing
+	// them in .DEREK.yml
+	unlisted bool
+
+	// withoutConfig is set for features which run when .DEREK.yml
+	// cannot be loaded
+	withoutConfig bool
+}
+
+func (f *builtinFeature) Name() string {
+	return f.name
+}
+
+func (f *builtinFeature) Subscriptions() []Subscription {
+	return f.subscriptions
+}
+
+func (f *builtinFeature) Order() int {
+	return f.order
+}
+
+func (f *builtinFeature) Unlisted() bool {
+	return f.unlisted
+}
+
+func (f *builtinFeature) RunsWithoutConfig() bool {
+	return f.withoutConfig
+}
+
+func (f *builtinFeature) Enabled(event *Event) bool {
+	return f.enabled(event)
+}
+
+func (f *builtinFeature) Handle(ctx context.Context, event *Event) *Result {
+	return f.handle(ctx, event)
+}
+
+func failedResult(feature string, err error) *Result {
+	result := NewResult(feature)
+	result.Fail(err)
+	return result
+}
+
+// openPullRequestFeature enables a feature listed in .DEREK.yml
+// only whilst the pull request is open.
+func openPullRequestFeature(feature string) func(event *Event) bool {
+	return func(event *Event) bool {
+		req := types.PullRequestOuter{}
+		if err := event.Decode(&req); err != nil {
+			return false
+		}
+
+		if req.Action == ClosedConstant || req.PullRequest.State == ClosedConstant {
+			return false
+		}
+
+		return EnabledFeature(feature, event.DerekConfig)
+	}
+}
+
+func pullRequestHandler(feature string, handle func(ctx context.Context, client *GitHub, req types.PullRequestOuter, event *Event) *Result) func(ctx context.Context, event *Event) *Result {
+	return func(ctx context.Context, event *Event) *Result {
+		req := types.PullRequestOuter{}
+		if err := event.Decode(&req); err != nil {
+			return failedResult(feature, err)
+		}
+		client, err := event.Client(ctx)
+		if err != nil {
+			return failedResult(feature, err)
+		}
+		ctx = withPullRequestData(ctx, event.pullRequestData())
+		return handle(ctx, client, req, event)
+	}
+}
+
+func handleRelease(ctx context.Context, event *Event) *Result {
+	result := NewResult(releaseNotesFeature)
+
+	req := github.ReleaseEvent{}
+	if err := event.Decode(&req); err != nil {
+		result.Fail(err)
+		return result
+	}
+
+	client, err := event.Client(ctx)
+	if err != nil {
+		result.Fail(err)
+		return result
+	}
+
+	handler := NewReleaseHandler(client, event.Config.WebURL())
+	queued, err := RunOrQueue(ctx, "update release notes", func(ctx context.Context) error {
+		return handler.Handle(ctx, req)
+	})
+	if err != nil {
+		result.Fail(err)
+		return result
+	}
+
+	if queued {
+		result.Skip("queued release notes for %s for retry", req.Release.GetTagName())
+		return result
+	}
+
+	result.Action("updated release notes for %s", req.Release.GetTagName())
+	return result
+}
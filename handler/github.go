@@ -0,0 +1,213 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// IssuesService is the part of the GitHub Issues API used by Derek
+type IssuesService interface {
+	Get(ctx context.Context, owner string, repo string, number int) (*github.Issue, *github.Response, error)
+	Edit(ctx context.Context, owner string, repo string, number int, issue *github.IssueRequest) (*github.Issue, *github.Response, error)
+	AddLabelsToIssue(ctx context.Context, owner string, repo string, number int, labels []string) ([]*github.Label, *github.Response, error)
+	RemoveLabelForIssue(ctx context.Context, owner string, repo string, number int, label string) (*github.Response, error)
+	AddAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error)
+	RemoveAssignees(ctx context.Context, owner, repo string, number int, assignees []string) (*github.Issue, *github.Response, error)
+	Lock(ctx context.Context, owner string, repo string, number int, opt *github.LockIssueOptions) (*github.Response, error)
+	Unlock(ctx context.Context, owner string, repo string, number int) (*github.Response, error)
+	ListMilestones(ctx context.Context, owner string, repo string, opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error)
+	CreateComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+
+	// RemoveMilestone clears the milestone of an issue, go-github
+	// cannot send the null value this needs through Edit
+	RemoveMilestone(ctx context.Context, owner string, repo string, number int) (*github.Response, error)
+}
+
+// PullRequestsService is the part of the GitHub Pull Requests API used by Derek
+type PullRequestsService interface {
+	List(ctx context.Context, owner string, repo string, opt *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error)
+	ListCommits(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error)
+	ListFiles(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error)
+	RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error)
+	RemoveReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.Response, error)
+}
+
+// ChecksService is the part of the GitHub Checks API used by Derek
+type ChecksService interface {
+	ListCheckRunsForRef(ctx context.Context, owner, repo, ref string, opt *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error)
+	CreateCheckRun(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error)
+	UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opt github.UpdateCheckRunOptions) (*github.CheckRun, *github.Response, error)
+
+	// CreateCheckRunWithAnnotations creates a check run whose output marks
+	// lines of files, go-github cannot send the annotations' field names
+	CreateCheckRunWithAnnotations(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions, annotations []types.CheckRunAnnotation) (*github.CheckRun, *github.Response, error)
+}
+
+// RepositoriesService is the part of the GitHub Repositories API used by Derek
+type RepositoriesService interface {
+	ListCommits(ctx context.Context, owner, repo string, opt *github.CommitsListOptions) ([]*github.RepositoryCommit, *github.Response, error)
+	ListReleases(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error)
+	EditRelease(ctx context.Context, owner, repo string, id int64, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+}
+
+// GraphQLService is the GitHub GraphQL API, used to read data which
+// would otherwise take several calls to the REST API
+type GraphQLService interface {
+	// Query runs query with variables and unmarshals its data into v
+	Query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error
+}
+
+// GitHub is the API client passed to each handler, the services can be
+// replaced with fakes such as those in the fakegithub package.
+type GitHub struct {
+	Issues       IssuesService
+	PullRequests PullRequestsService
+	Checks       ChecksService
+	Repositories RepositoriesService
+
+	// GraphQL may be nil, in which case the REST API is used instead
+	GraphQL GraphQLService
+}
+
+// NewGitHub wraps a go-github client
+func NewGitHub(client *github.Client) *GitHub {
+	return &GitHub{
+		Issues:       &issuesService{IssuesService: client.Issues, client: client},
+		PullRequests: client.PullRequests,
+		Checks:       &checksService{ChecksService: client.Checks, client: client},
+		Repositories: client.Repositories,
+		GraphQL:      &graphQLService{client: client},
+	}
+}
+
+// issuesService adds RemoveMilestone to the go-github IssuesService
+type issuesService struct {
+	*github.IssuesService
+	client *github.Client
+}
+
+// RemoveMilestone sets the milestone field to null since go-github does not support that
+// reference to issue - https://github.com/google/go-github/issues/236
+func (s *issuesService) RemoveMilestone(ctx context.Context, owner string, repo string, number int) (*github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/issues/%d", owner, repo, number)
+	req, err := s.client.NewRequest("PATCH", u, &struct {
+		Milestone interface{} `json:"milestone"`
+	}{})
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// checksService adds CreateCheckRunWithAnnotations to the go-github ChecksService
+type checksService struct {
+	*github.ChecksService
+	client *github.Client
+}
+
+// CreateCheckRunWithAnnotations sends the output of opt along with annotations
+// which use the field names of the released Checks API, i.e. path and
+// annotation_level rather than filename and warning_level
+func (s *checksService) CreateCheckRunWithAnnotations(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions, annotations []types.CheckRunAnnotation) (*github.CheckRun, *github.Response, error) {
+	output := &struct {
+		Title       *string                    `json:"title,omitempty"`
+		Summary     *string                    `json:"summary,omitempty"`
+		Text        *string                    `json:"text,omitempty"`
+		Annotations []types.CheckRunAnnotation `json:"annotations,omitempty"`
+	}{Annotations: annotations}
+	if opt.Output != nil {
+		output.Title = opt.Output.Title
+		output.Summary = opt.Output.Summary
+		output.Text = opt.Output.Text
+	}
+
+	u := fmt.Sprintf("repos/%v/%v/check-runs", owner, repo)
+	req, err := s.client.NewRequest("POST", u, &struct {
+		github.CreateCheckRunOptions
+		Output interface{} `json:"output"`
+	}{opt, output})
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", checkRunsMediaType)
+
+	checkRun := &github.CheckRun{}
+	resp, err := s.client.Do(ctx, req, checkRun)
+	if err != nil {
+		return nil, resp, err
+	}
+	return checkRun, resp, nil
+}
+
+// checkRunsMediaType is sent by go-github for the Checks API
+const checkRunsMediaType = "application/vnd.github.antiope-preview+json"
+
+// graphQLService sends queries through the go-github client, so that they
+// share its authentication, transports and error handling
+type graphQLService struct {
+	client *github.Client
+}
+
+// GraphQLError is returned when GitHub answers a query with errors
+type GraphQLError struct {
+	Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+	return fmt.Sprintf("GraphQL query failed: %s", strings.Join(e.Messages, "; "))
+}
+
+func (s *graphQLService) Query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	req, err := s.client.NewRequest("POST", graphQLURL(s.client.BaseURL), &struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{query, variables})
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if _, err := s.client.Do(ctx, req, &res); err != nil {
+		return err
+	}
+
+	if len(res.Errors) > 0 {
+		graphQLErr := &GraphQLError{}
+		for _, e := range res.Errors {
+			graphQLErr.Messages = append(graphQLErr.Messages, e.Message)
+		}
+		return graphQLErr
+	}
+	if len(res.Data) == 0 || string(res.Data) == "null" {
+		return &GraphQLError{Messages: []string{"no data in response"}}
+	}
+
+	return json.Unmarshal(res.Data, v)
+}
+
+// graphQLURL gives the endpoint for the REST API's base URL, which is
+// <host>/api/graphql on GitHub Enterprise Server rather than /api/v3/graphql
+func graphQLURL(base *url.URL) string {
+	u := *base
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+		return u.String()
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/graphql"
+	return u.String()
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/google/go-github/github"
+)
+
+// newFakeGitHub gives handlers the in-memory fake in place of the API
+func newFakeGitHub(fake *fakegithub.Client) *GitHub {
+	return &GitHub{
+		Issues:       fake.Issues,
+		PullRequests: fake.PullRequests,
+		Checks:       fake.Checks,
+		Repositories: fake.Repositories,
+	}
+}
+
+func Test_NewGitHub_RemoveMilestone(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{
+		Number:    github.Int(7),
+		Milestone: &github.Milestone{Number: github.Int(1), Title: github.String("0.1.0")},
+	})
+
+	server := fakegithub.NewServer(fake)
+	defer server.Close()
+
+	client := NewGitHub(server.GitHubClient())
+
+	if _, err := client.Issues.RemoveMilestone(context.Background(), "alexellis", "derek", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := fake.Issue("alexellis", "derek", 7).Milestone; m != nil {
+		t.Errorf("want milestone removed, got: %q", m.GetTitle())
+	}
+}
+
+func Test_Event_ClientUsesGivenClient(t *testing.T) {
+	client := newFakeGitHub(fakegithub.New())
+	event := &Event{GitHub: client}
+
+	got, err := event.Client(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != client {
+		t.Errorf("want the event's client to be used")
+	}
+}
+
+func Test_graphQLURL(t *testing.T) {
+	cases := map[string]string{
+		"https://api.github.com/":            "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/graphql",
+		"http://127.0.0.1:8080/":             "http://127.0.0.1:8080/graphql",
+		"https://example.com/github/api/v3/": "https://example.com/github/api/graphql",
+	}
+	for base, want := range cases {
+		u, _ := url.Parse(base)
+		if got := graphQLURL(u); got != want {
+			t.Errorf("%s: want: %q, got: %q", base, want, got)
+		}
+	}
+}
+
+func Test_NewGitHub_GraphQLQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data": {"viewer": {"login": "derek"}}, "errors": []}`))
+	}))
+	defer server.Close()
+
+	ghClient := github.NewClient(nil)
+	ghClient.BaseURL, _ = url.Parse(server.URL + "/api/v3/")
+	client := NewGitHub(ghClient)
+
+	data := struct {
+		Viewer struct {
+			Login string `json:"login"`
+		} `json:"viewer"`
+	}{}
+	if err := client.GraphQL.Query(context.Background(), "query { viewer { login } }", nil, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Viewer.Login != "derek" {
+		t.Errorf("want login: derek, got: %q", data.Viewer.Login)
+	}
+}
@@ -8,107 +8,154 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/alexellis/derek/config"
-	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/metrics"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
 	invalidLabel = "invalid"
 )
 
-func HandleFirstTimerPR(req types.PullRequestOuter, contributingURL string, config config.Config) (bool, error) {
-	ctx := context.Background()
-	token, tokenErr := getAccessToken(config, req.Installation.ID)
+// HandleFirstTimerPR closes PRs opened by first-time contributors, the result
+// is marked as Stop when the PR was treated as spam so later features are skipped.
+func HandleFirstTimerPR(ctx context.Context, client *GitHub, req types.PullRequestOuter, contributingURL string) *Result {
+	result := NewResult(noNewbiesFeature)
 
-	if tokenErr != nil {
-		fmt.Printf("Error getting installation token: %s\n", tokenErr.Error())
-		return false, tokenErr
+	if req.Action != openedPRAction || !isFirstTimer(req) {
+		result.Skip("PR %d was not opened by a first-time contributor", req.PullRequest.Number)
+		return result
 	}
 
-	client := factory.MakeClient(ctx, token, config)
+	// Spam is not processed by any later features, even if closing the PR fails
+	result.Stop = true
 
-	if req.Action == openedPRAction {
+	// Close PR first, to prevent other handlers from executing on "label" events
+	closeState := "close"
+	input := &github.IssueRequest{State: &closeState}
 
-		if isFirstTimer(req) {
-			// Close PR first, to prevent other handlers from executing on "label" events
-			closeState := "close"
-			input := &github.IssueRequest{State: &closeState}
-
-			_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, input)
-			if err != nil {
-				log.Fatalf("unable to close pull request %d: %s", req.PullRequest.Number, err)
-				return true, err
-			}
-
-			fmt.Println(fmt.Sprintf("Request to close issue #%d was successful.\n", req.PullRequest.Number))
-
-			body := firstTimerComment(contributingURL)
-			if err = createPullRequestComment(ctx, body, req, client); err != nil {
-				log.Fatalf("unable to add comment on PR %d: %s", req.PullRequest.Number, err)
-				return true, err
-			}
+	queued, err := RunOrQueue(ctx, "close spam PR", func(ctx context.Context) error {
+		_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, input)
+		return err
+	})
+	if err != nil {
+		result.Fail(fmt.Errorf("unable to close pull request %d: %s", req.PullRequest.Number, err))
+		return result
+	}
+	if queued {
+		result.Skip("queued closing PR %d for retry", req.PullRequest.Number)
+	} else {
+		result.Action("closed PR %d", req.PullRequest.Number)
+		metrics.FirstTimerPRsClosed.Inc()
+	}
 
-			_, res, assignLabelErr := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number,
-				[]string{invalidLabel})
-			if assignLabelErr != nil {
-				log.Fatalf("%s limit: %d, remaining: %d", assignLabelErr, res.Limit, res.Remaining)
-				return true, assignLabelErr
-			}
+	body := firstTimerComment(contributingURL)
+	queued, err = RunOrQueue(ctx, "comment on spam PR", func(ctx context.Context) error {
+		return createPullRequestComment(ctx, body, req, client)
+	})
+	if err != nil {
+		result.Fail(fmt.Errorf("unable to add comment on PR %d: %s", req.PullRequest.Number, err))
+		return result
+	}
+	if queued {
+		result.Skip("queued comment on PR %d for retry", req.PullRequest.Number)
+	} else {
+		result.Action("commented on PR %d", req.PullRequest.Number)
+	}
 
-			return true, nil
-		}
+	var res *github.Response
+	queued, assignLabelErr := RunOrQueue(ctx, "add "+invalidLabel+" label", func(ctx context.Context) (err error) {
+		_, res, err = client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{invalidLabel})
+		return err
+	})
+	if assignLabelErr != nil {
+		result.Fail(fmt.Errorf("unable to add %s label: %s %s", invalidLabel, assignLabelErr, formatRate(res)))
+		return result
 	}
-	return false, nil
+	if queued {
+		result.Skip("queued adding %s label to PR %d for retry", invalidLabel, req.PullRequest.Number)
+	} else {
+		result.Action("added %s label to PR %d", invalidLabel, req.PullRequest.Number)
+	}
+
+	return result
 }
 
 // HandleHacktoberfestPR checks for opened PR, first time contributor. If only .MD files are changed, issue is closed and invalid label is added
 // The goal of this function is to mark pull requests invalid and close them from people only making typo changes without signing their commit (flybys)
-func HandleHacktoberfestPR(req types.PullRequestOuter, contributingURL string, config config.Config) (bool, error) {
-	ctx := context.Background()
-	token, tokenErr := getAccessToken(config, req.Installation.ID)
+func HandleHacktoberfestPR(ctx context.Context, client *GitHub, req types.PullRequestOuter, contributingURL string) *Result {
+	result := NewResult(hacktoberfestFeature)
 
-	if tokenErr != nil {
-		fmt.Printf("Error getting installation token: %s\n", tokenErr.Error())
-		return false, tokenErr
+	if req.Action != openedPRAction {
+		result.Skip("only checked when a PR is opened, action: %s", req.Action)
+		return result
 	}
 
-	client := factory.MakeClient(ctx, token, config)
-
-	if req.Action == openedPRAction {
+	spam, err := isHacktoberfestSpam(ctx, req, client)
+	if err != nil {
+		result.Fail(err)
+		return result
+	}
 
-		if isHacktoberfestSpam(req, client) {
-			// Close PR first, to prevent other handlers from executing on "label" events
-			closeState := "close"
-			input := &github.IssueRequest{State: &closeState}
+	if !spam {
+		result.Skip("PR %d does not look like spam", req.PullRequest.Number)
+		return result
+	}
 
-			_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, input)
-			if err != nil {
-				log.Fatalf("unable to close pull request %d: %s", req.PullRequest.Number, err)
-				return true, err
-			}
+	// Spam is not processed by any later features, even if closing the PR fails
+	result.Stop = true
 
-			fmt.Println(fmt.Sprintf("Request to close issue #%d was successful.\n", req.PullRequest.Number))
+	// Close PR first, to prevent other handlers from executing on "label" events
+	closeState := "close"
+	input := &github.IssueRequest{State: &closeState}
 
-			_, res, assignLabelErr := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{invalidLabel})
-			if assignLabelErr != nil {
-				log.Fatalf("%s limit: %d, remaining: %d", assignLabelErr, res.Limit, res.Remaining)
-				return true, assignLabelErr
-			}
+	var queued bool
+	queued, err = RunOrQueue(ctx, "close spam PR", func(ctx context.Context) error {
+		_, _, err := client.Issues.Edit(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, input)
+		return err
+	})
+	if err != nil {
+		result.Fail(fmt.Errorf("unable to close pull request %d: %s", req.PullRequest.Number, err))
+		return result
+	}
+	if queued {
+		result.Skip("queued closing PR %d for retry", req.PullRequest.Number)
+	} else {
+		result.Action("closed PR %d", req.PullRequest.Number)
+		metrics.HacktoberfestSpamClosed.Inc()
+	}
 
-			body := hacktoberfestSpamComment(contributingURL)
+	var res *github.Response
+	queued, assignLabelErr := RunOrQueue(ctx, "add "+invalidLabel+" label", func(ctx context.Context) (err error) {
+		_, res, err = client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{invalidLabel})
+		return err
+	})
+	if assignLabelErr != nil {
+		result.Fail(fmt.Errorf("unable to add %s label: %s %s", invalidLabel, assignLabelErr, formatRate(res)))
+		return result
+	}
+	if queued {
+		result.Skip("queued adding %s label to PR %d for retry", invalidLabel, req.PullRequest.Number)
+	} else {
+		result.Action("added %s label to PR %d", invalidLabel, req.PullRequest.Number)
+	}
 
-			if err = createPullRequestComment(ctx, body, req, client); err != nil {
-				log.Fatalf("unable to add comment on PR %d: %s", req.PullRequest.Number, err)
-				return true, err
-			}
+	body := hacktoberfestSpamComment(contributingURL)
 
-			return true, nil
-		}
+	queued, err = RunOrQueue(ctx, "comment on spam PR", func(ctx context.Context) error {
+		return createPullRequestComment(ctx, body, req, client)
+	})
+	if err != nil {
+		result.Fail(fmt.Errorf("unable to add comment on PR %d: %s", req.PullRequest.Number, err))
+		return result
+	}
+	if queued {
+		result.Skip("queued comment on PR %d for retry", req.PullRequest.Number)
+	} else {
+		result.Action("commented on PR %d", req.PullRequest.Number)
 	}
-	return false, nil
+
+	return result
 }
 
 func hacktoberfestSpamComment(contributingURL string) string {
@@ -140,25 +187,17 @@ func isFirstTimer(req types.PullRequestOuter) bool {
 	return req.PullRequest.FirstTimeContributor()
 }
 
-func isHacktoberfestSpam(req types.PullRequestOuter, client *github.Client) bool {
-	commits, err := fetchPullRequestCommits(req, client)
+func isHacktoberfestSpam(ctx context.Context, req types.PullRequestOuter, client *GitHub) (bool, error) {
+	snapshot, err := fetchPRSnapshot(ctx, req, client)
 	if err != nil {
-		log.Fatalf("unable to fetch pull request commits for PR %d: %s", req.PullRequest.Number, err)
-		return false
-	}
-
-	anonymousSign := hasAnonymousSign(commits)
-	unsignedCommits := hasUnsigned(commits)
-
-	files, err := fetchPullRequestFileList(req, client)
-	if err != nil {
-		log.Fatalf("unable to fetch pull request files for PR %d: %s", req.PullRequest.Number, err)
-		return false
+		return false, fmt.Errorf("unable to fetch PR %d: %s", req.PullRequest.Number, err)
 	}
 
-	onlyMD := onlyMarkdownFiles(files)
+	anonymousSign := hasAnonymousSign(snapshot.Commits)
+	unsignedCommits := hasUnsigned(snapshot.Commits)
+	onlyMD := onlyMarkdownFiles(snapshot.Files)
 
-	return onlyMD && req.PullRequest.FirstTimeContributor() && (anonymousSign || unsignedCommits)
+	return onlyMD && snapshot.FirstTimeContributor() && (anonymousSign || unsignedCommits), nil
 }
 
 func onlyMarkdownFiles(files []*github.CommitFile) bool {
@@ -4,8 +4,11 @@
 package handler
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
+	"github.com/alexellis/derek/fakegithub"
 	"github.com/google/go-github/github"
 )
 
@@ -77,3 +80,25 @@ func Test_onlyMarkdownFiles(t *testing.T) {
 		}
 	}
 }
+
+func Test_HandleHacktoberfestPR_ClosesSpam(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 5, "Update README.md")
+	req.Action = openedPRAction
+	req.PullRequest.AuthorAssociation = "NONE"
+
+	result := HandleHacktoberfestPR(context.Background(), newFakeGitHub(fake), req, "")
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+	if !result.Stop {
+		t.Errorf("want later features stopped for spam")
+	}
+
+	if got := fake.Issue("alexellis", "derek", 5).GetState(); got != ClosedConstant {
+		t.Errorf("want PR closed, got state: %q", got)
+	}
+	if want, got := []string{invalidLabel}, fake.Labels("alexellis", "derek", 5); !reflect.DeepEqual(want, got) {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/types"
+)
+
+// orgConfigRepo holds an organisation's defaults for all of its
+// repositories, in the same way as GitHub's community health files
+const orgConfigRepo = ".github"
+
+// orgConfigKey caches the organisation's file apart from the repository
+// of the same name, since it is read from the default branch
+func orgConfigKey(owner string) string {
+	return repoConfigKey(owner, orgConfigRepo, "")
+}
+
+// orgConfig is the .DEREK.yml of an organisation's .github repository,
+// it is only loaded when a repository can use it
+type orgConfig struct {
+	source string
+	load   func() (cachedConfig, error)
+}
+
+// resolveRepoConfig gives the config of a repository, with the organisation's
+// file merged beneath the repository's own, unless it sets ignore_org_config.
+// The organisation's file is used alone when the repository has no file.
+// When the organisation's file cannot be read it is left out with a
+// warning, but a file which cannot be parsed is an error.
+func resolveRepoConfig(ctx context.Context, client http.Client, repository, source string, repoFile cachedConfig, org orgConfig, config config.Config) (*types.DerekRepoConfig, error) {
+	repo := sourceConfig{source: source, config: copyConfig(repoFile.config)}
+
+	if strings.EqualFold(repository, orgConfigRepo) || (repoFile.missing == nil && repoFile.config.IgnoresOrgConfig()) {
+		if repoFile.missing != nil {
+			return nil, repoFile.missing
+		}
+		return resolveDerekConfig(ctx, client, config, repo)
+	}
+
+	orgFile, err := org.load()
+	if err != nil {
+		var parseErr *configParseError
+		if errors.As(err, &parseErr) {
+			return nil, err
+		}
+		logging.FromContext(ctx).Warnf("Unable to read %s, continuing without it: %s", org.source, err)
+		orgFile = cachedConfig{missing: err}
+	}
+
+	switch {
+	case orgFile.missing != nil && repoFile.missing != nil:
+		return nil, repoFile.missing
+	case orgFile.missing != nil:
+		return resolveDerekConfig(ctx, client, config, repo)
+	}
+
+	orgDefaults := sourceConfig{source: org.source, config: copyConfig(orgFile.config)}
+	if repoFile.missing != nil {
+		return resolveDerekConfig(ctx, client, config, orgDefaults)
+	}
+	return resolveDerekConfig(ctx, client, config, orgDefaults, repo)
+}
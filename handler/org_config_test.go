@@ -0,0 +1,154 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/config"
+)
+
+// newRawServer serves files by their raw path, i.e. /owner/repo/branch/.DEREK.yml
+func newRawServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+const orgDEREK = `maintainers:
+- alexellis
+features:
+- dco_check
+contributing_url: https://example.com/org/CONTRIBUTING.md
+`
+
+func Test_GetRepoConfig_OrgConfig(t *testing.T) {
+	tests := []struct {
+		title           string
+		repoFile        string
+		wantSources     []string
+		wantMaintainers []string
+		wantURL         string
+	}{
+		{
+			title:           "Repository without a file uses the organisation's",
+			wantSources:     []string{"/openfaas/.github/HEAD/.DEREK.yml"},
+			wantMaintainers: []string{"alexellis"},
+			wantURL:         "https://example.com/org/CONTRIBUTING.md",
+		},
+		{
+			title:           "Repository's file is merged over the organisation's",
+			repoFile:        "maintainers:\n- rgee0\ncontributing_url: https://example.com/faas/CONTRIBUTING.md\n",
+			wantSources:     []string{"/openfaas/.github/HEAD/.DEREK.yml", "/openfaas/faas/master/.DEREK.yml"},
+			wantMaintainers: []string{"alexellis", "rgee0"},
+			wantURL:         "https://example.com/faas/CONTRIBUTING.md",
+		},
+		{
+			title:           "Repository can ignore the organisation's file",
+			repoFile:        "ignore_org_config: true\nmaintainers:\n- rgee0\n",
+			wantSources:     []string{"/openfaas/faas/master/.DEREK.yml"},
+			wantMaintainers: []string{"rgee0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			previous := repoConfigs
+			defer func() { repoConfigs = previous }()
+			repoConfigs = newConfigCache(time.Minute)
+
+			files := map[string]string{"/openfaas/.github/HEAD/.DEREK.yml": orgDEREK}
+			if len(test.repoFile) > 0 {
+				files["/openfaas/faas/master/.DEREK.yml"] = test.repoFile
+			}
+			server := newRawServer(files)
+			defer server.Close()
+
+			repoConfig, err := GetRepoConfig(context.Background(), "openfaas", "faas", "master", config.Config{RawBaseURL: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sources []string
+			for _, source := range repoConfig.Sources {
+				sources = append(sources, strings.TrimPrefix(source, server.URL))
+			}
+			if !reflect.DeepEqual(test.wantSources, sources) {
+				t.Errorf("want sources: %v, got: %v", test.wantSources, sources)
+			}
+			if !reflect.DeepEqual(test.wantMaintainers, repoConfig.Maintainers) {
+				t.Errorf("want maintainers: %v, got: %v", test.wantMaintainers, repoConfig.Maintainers)
+			}
+			if repoConfig.ContributingURL != test.wantURL {
+				t.Errorf("want contributing URL: %q, got: %q", test.wantURL, repoConfig.ContributingURL)
+			}
+		})
+	}
+}
+
+func Test_GetRepoConfig_NoRepoOrOrgConfig(t *testing.T) {
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+	repoConfigs = newConfigCache(time.Minute)
+
+	server := newRawServer(map[string]string{})
+	defer server.Close()
+
+	_, err := GetRepoConfig(context.Background(), "openfaas", "faas", "master", config.Config{RawBaseURL: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "/openfaas/faas/master/.DEREK.yml") {
+		t.Errorf("want the repository's file reported missing, got: %v", err)
+	}
+}
+
+func Test_GetRepoConfig_UnreadableOrgConfigIsLeftOut(t *testing.T) {
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+	repoConfigs = newConfigCache(time.Minute)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openfaas/faas/master/.DEREK.yml" {
+			w.Write([]byte("maintainers:\n- rgee0\n"))
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	repoConfig, err := GetRepoConfig(context.Background(), "openfaas", "faas", "master", config.Config{RawBaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"rgee0"}
+	if !reflect.DeepEqual(want, repoConfig.Maintainers) {
+		t.Errorf("want maintainers: %v, got: %v", want, repoConfig.Maintainers)
+	}
+}
+
+func Test_GetRepoConfig_InvalidOrgConfigIsAnError(t *testing.T) {
+	previous := repoConfigs
+	defer func() { repoConfigs = previous }()
+	repoConfigs = newConfigCache(time.Minute)
+
+	server := newRawServer(map[string]string{
+		"/openfaas/.github/HEAD/.DEREK.yml": "maintainers: [",
+		"/openfaas/faas/master/.DEREK.yml":  "maintainers:\n- rgee0\n",
+	})
+	defer server.Close()
+
+	if _, err := GetRepoConfig(context.Background(), "openfaas", "faas", "master", config.Config{RawBaseURL: server.URL}); err == nil {
+		t.Errorf("want an error for the organisation's invalid file")
+	}
+}
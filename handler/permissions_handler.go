@@ -4,22 +4,41 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
-	yaml "gopkg.in/yaml.v2"
-
 	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
 	"github.com/alexellis/derek/types"
 	github "github.com/google/go-github/github"
 )
 
 const (
-	configFile      = ".DEREK.yml"
-	configURLFormat = "https://github.com/%s/%s/raw/%s/%s"
+	configFile = ".DEREK.yml"
+)
+
+// configHTTPClient downloads .DEREK.yml files, its timeout is an upper
+// bound for when the context of the download has no deadline
+var configHTTPClient = http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// Names of the features which can be listed in .DEREK.yml
+const (
+	dcoCheckFeature              = "dco_check"
+	commentsFeature              = "comments"
+	prDescriptionRequiredFeature = "pr_description_required"
+	hacktoberfestFeature         = "hacktoberfest"
+	noNewbiesFeature             = "no_newbies"
+	releaseNotesFeature          = "release_notes"
+	requiredInIssuesFeature      = "required_in_issues"
 )
 
 func EnabledFeature(attemptedFeature string, config *types.DerekRepoConfig) bool {
@@ -51,37 +70,66 @@ func PermittedUserFeature(attemptedFeature string, config *types.DerekRepoConfig
 	return permitted
 }
 
-func readConfigFromURL(client http.Client, url string) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// readConfigFromURL downloads a config file, when etag is non-empty it is sent
+// as If-None-Match and notModified is returned as true for a 304 response.
+func readConfigFromURL(ctx context.Context, client http.Client, url, etag string) (bytesOut []byte, newETag string, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to make request to %q, %e", url, err)
+		return nil, "", false, fmt.Errorf("unable to make request to %q, %e", url, err)
+	}
+
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
 	}
 
 	res, resErr := client.Do(req)
 	if resErr != nil {
-		return nil, fmt.Errorf("could not action request url: %q, err: %s", url, resErr.Error())
+		return nil, "", false, fmt.Errorf("could not action request url: %q, err: %s", url, resErr.Error())
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Status code: %d while fetching config (%s)", res.StatusCode, req.URL.String())
-	}
 	if res.Body != nil {
 		defer res.Body.Close()
 	}
-	bytesOut, err := ioutil.ReadAll(res.Body)
+
+	if res.StatusCode == http.StatusNotModified && len(etag) > 0 {
+		return nil, etag, true, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("HTTP Status code: %d while fetching config (%s)", res.StatusCode, req.URL.String())
+		if res.StatusCode == http.StatusNotFound {
+			err = &configNotFoundError{err: err}
+		}
+		return nil, "", false, err
+	}
+
+	bytesOut, err = ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, "", false, err
 	}
 
-	return bytesOut, nil
+	return bytesOut, res.Header.Get("ETag"), false, nil
 }
 
-func getValidRedirectDomains() []string {
-	return []string{"github.com", "www.github.com", "raw.githubusercontent.com"}
+// getValidRedirectDomains gives the hosts of the web UI and raw
+// content, i.e. github.com, www.github.com and raw.githubusercontent.com
+func getValidRedirectDomains(config config.Config) []string {
+	var domains []string
+	for _, base := range []string{config.WebURL(), config.RawURL()} {
+		u, err := url.Parse(base)
+		if err != nil || len(u.Host) == 0 {
+			continue
+		}
+		domains = append(domains, u.Host)
+		if !strings.HasPrefix(u.Host, "www.") && !strings.HasPrefix(u.Host, "raw.") {
+			domains = append(domains, "www."+u.Host)
+		}
+	}
+	return domains
 }
 
-func validateRedirectURL(url string) error {
-	for _, d := range getValidRedirectDomains() {
+func validateRedirectURL(url string, config config.Config) error {
+	for _, d := range getValidRedirectDomains(config) {
 		if strings.HasPrefix(url, d) || strings.HasPrefix(url, "http://"+d) || strings.HasPrefix(url, "https://"+d) {
 			return nil
 		}
@@ -92,87 +140,246 @@ func validateRedirectURL(url string) error {
 // GetPrivateRepoConfig returns the configuration for derek
 // for the specified repository. Since the repository is
 // private we use the github API to fetch `.DEREK.yml`.
-func GetPrivateRepoConfig(owner, repository, branch string, installation int, config config.Config) (*types.DerekRepoConfig, error) {
-	client, ctx := makeClient(installation, config)
-	response, err := client.Repositories.DownloadContents(ctx, owner, repository, configFile, &github.RepositoryContentGetOptions{
-		Ref: branch,
-	})
+func GetPrivateRepoConfig(ctx context.Context, owner, repository, branch string, installation int, config config.Config) (*types.DerekRepoConfig, error) {
+	var client *github.Client
+	download := func(repository, branch string) func(etag string) ([]byte, string, bool, error) {
+		return func(etag string) ([]byte, string, bool, error) {
+			if client == nil {
+				var err error
+				if client, err = makeClient(ctx, installation, config); err != nil {
+					return nil, "", false, err
+				}
+			}
+			return downloadPrivateConfig(ctx, client, owner, repository, branch, etag)
+		}
+	}
+
+	repoFile, err := loadRepoConfig(ctx, repoConfigKey(owner, repository, branch), download(repository, branch))
 	if err != nil {
-		return nil, fmt.Errorf("unable to download config file: %s", err)
+		return nil, err
 	}
-	defer response.Close()
 
-	bytesConfig, err := ioutil.ReadAll(response)
+	source := repoConfigURL(owner, repository, branch, config)
+	org := orgConfig{
+		source: repoConfigURL(owner, orgConfigRepo, "HEAD", config),
+		load: func() (cachedConfig, error) {
+			return loadRepoConfig(ctx, orgConfigKey(owner), download(orgConfigRepo, ""))
+		},
+	}
+	return resolveRepoConfig(ctx, configHTTPClient, repository, source, repoFile, org, config)
+}
+
+// downloadPrivateConfig fetches the raw contents of `.DEREK.yml` through
+// the contents API, so that If-None-Match can be sent with the request.
+// The repository's default branch is used when branch is empty.
+func downloadPrivateConfig(ctx context.Context, client *github.Client, owner, repository, branch, etag string) ([]byte, string, bool, error) {
+	u := fmt.Sprintf("repos/%s/%s/contents/%s", owner, repository, configFile)
+	if len(branch) > 0 {
+		u += "?ref=" + url.QueryEscape(branch)
+	}
+	req, err := client.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read github's response: %s", err)
+		return nil, "", false, err
 	}
 
-	httpClient := http.Client{
-		Timeout: 30 * time.Second,
+	req.Header.Set("Accept", "application/vnd.github.v3.raw")
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	var buf bytes.Buffer
+	res, err := client.Do(ctx, req, &buf)
+	if res != nil && res.StatusCode == http.StatusNotModified && len(etag) > 0 {
+		return nil, etag, true, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to download config file: %s", err)
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			err = &configNotFoundError{err: err}
+		}
+		return nil, "", false, err
 	}
-	return buildDerekConfig(httpClient, bytesConfig)
+
+	return buf.Bytes(), res.Header.Get("ETag"), false, nil
 }
 
 // GetRepoConfig returns derek's configuration for the specified
 // repository. The repository has to be public since this function
 // will fetch the file from the CDN. If you are trying to fetch
 // the config from a private repo use `GetPrivateRepoConfig` instead.
-func GetRepoConfig(owner, repository, branch string) (*types.DerekRepoConfig, error) {
-	client := http.Client{
-		Timeout: 30 * time.Second,
-	}
+func GetRepoConfig(ctx context.Context, owner, repository, branch string, config config.Config) (*types.DerekRepoConfig, error) {
+	client := configHTTPClient
 
-	configFile := fmt.Sprintf(configURLFormat, owner, repository, branch, configFile)
-	bytesConfig, err := readConfigFromURL(client, configFile)
+	configURL := repoConfigURL(owner, repository, branch, config)
+	repoFile, err := loadRepoConfig(ctx, repoConfigKey(owner, repository, branch), func(etag string) ([]byte, string, bool, error) {
+		return readConfigFromURL(ctx, client, configURL, etag)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return buildDerekConfig(client, bytesConfig)
+	orgURL := repoConfigURL(owner, orgConfigRepo, "HEAD", config)
+	org := orgConfig{
+		source: orgURL,
+		load: func() (cachedConfig, error) {
+			return loadRepoConfig(ctx, orgConfigKey(owner), func(etag string) ([]byte, string, bool, error) {
+				return readConfigFromURL(ctx, client, orgURL, etag)
+			})
+		},
+	}
+	return resolveRepoConfig(ctx, client, repository, configURL, repoFile, org, config)
 }
 
-func buildDerekConfig(client http.Client, bytesConfig []byte) (*types.DerekRepoConfig, error) {
-	var localConfig types.DerekRepoConfig
-	var remoteConfig types.DerekRepoConfig
+// loadRepoConfig gives the .DEREK.yml cached under key, calling download
+// when there is no fresh copy. A file which does not exist is cached as
+// missing rather than returned as an error.
+func loadRepoConfig(ctx context.Context, key string, download func(etag string) ([]byte, string, bool, error)) (cachedConfig, error) {
+	cached, found, fresh := repoConfigs.repo(key)
+	if fresh {
+		return cached, nil
+	}
 
-	err := parseConfig(bytesConfig, &localConfig)
-	if err != nil {
-		return nil, err
+	var etag string
+	if found {
+		etag = cached.etag
 	}
 
-	// The config contains a redirect URL. Load the config from there.
-	if len(localConfig.Redirect) > 0 {
-		err = validateRedirectURL(localConfig.Redirect)
-		if err != nil {
-			return nil, err
+	bytesConfig, newETag, notModified, err := download(etag)
+	if err != nil {
+		var notFound *configNotFoundError
+		if !errors.As(err, &notFound) {
+			return cachedConfig{}, err
 		}
+		cached = cachedConfig{missing: err}
+		repoConfigs.storeRepo(key, cached)
+		return cached, nil
+	}
 
-		bytesConfig, err = readConfigFromURL(client, localConfig.Redirect)
-		if err != nil {
-			return nil, err
+	if !notModified {
+		cached = cachedConfig{etag: newETag}
+		if err := parseConfig(ctx, configFile, bytesConfig, &cached.config); err != nil {
+			return cachedConfig{}, &configParseError{err: err}
 		}
+	}
+	repoConfigs.storeRepo(key, cached)
+	return cached, nil
+}
+
+// ReadRepoConfigFile loads a .DEREK.yml file from disk, following any redirect
+// and extends in the same way as a file fetched from a repository.
+func ReadRepoConfigFile(ctx context.Context, path string, config config.Config) (*types.DerekRepoConfig, error) {
+	bytesConfig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 
-		err = parseConfig(bytesConfig, &remoteConfig)
+	var localConfig types.DerekRepoConfig
+	if err := parseConfig(ctx, path, bytesConfig, &localConfig); err != nil {
+		return nil, err
+	}
+
+	return resolveDerekConfig(ctx, configHTTPClient, config, sourceConfig{source: path, config: localConfig})
+}
+
+// resolveDerekConfig merges each file with those it extends and redirects
+// to, then merges the files in turn, each taking precedence over those
+// before it. The files which are extended or redirected to are cached
+// separately from the repository's own file since many repositories can
+// share them.
+func resolveDerekConfig(ctx context.Context, client http.Client, config config.Config, files ...sourceConfig) (*types.DerekRepoConfig, error) {
+	resolver := &configResolver{
+		config: config,
+		read: func(sourceURL string) (types.DerekRepoConfig, error) {
+			return readSourceConfig(ctx, client, sourceURL)
+		},
+	}
+
+	var layers []types.DerekRepoConfig
+	for _, file := range files {
+		resolved, err := resolver.resolve(file.source, file.config, nil)
 		if err != nil {
 			return nil, err
 		}
+		layers = append(layers, resolved)
+	}
+
+	mergedConfig, err := mergeLayers(layers)
+	if err != nil {
+		return nil, err
 	}
 
-	mergedConfig, err := types.MergeDerekRepoConfigs(localConfig, remoteConfig)
+	return applyOperatorConfig(mergedConfig, config.Operator)
+}
 
+// applyOperatorConfig merges the operator's defaults beneath the repository's
+// config, so that values set by the repository win, and then applies the
+// features the operator has disabled or forced on for every repository.
+// It is the last merge, so entries which remove others are dropped.
+func applyOperatorConfig(repoConfig types.DerekRepoConfig, operator config.OperatorConfig) (*types.DerekRepoConfig, error) {
+	mergedConfig, err := types.OverrideDerekRepoConfig(operator.Defaults, repoConfig)
 	if err != nil {
 		return &mergedConfig, err
 	}
+	mergedConfig = types.RemoveMarkers(mergedConfig)
+
+	var features []string
+	for _, feature := range mergedConfig.Features {
+		if !operator.FeatureDisabled(feature) {
+			features = append(features, feature)
+		}
+	}
+	mergedConfig.Features = features
+
+	for _, feature := range operator.ForcedFeatures {
+		if operator.FeatureForced(feature) && !EnabledFeature(feature, &mergedConfig) {
+			mergedConfig.Features = append(mergedConfig.Features, feature)
+		}
+	}
 
 	return &mergedConfig, nil
 }
 
-func parseConfig(bytesOut []byte, config *types.DerekRepoConfig) error {
-	err := yaml.Unmarshal(bytesOut, &config)
+// readSourceConfig reads a file which is redirected to or extended
+func readSourceConfig(ctx context.Context, client http.Client, sourceURL string) (types.DerekRepoConfig, error) {
+	cached, found, fresh := repoConfigs.source(sourceURL)
+	if fresh {
+		return copyConfig(cached.config), nil
+	}
+
+	var etag string
+	if found {
+		etag = cached.etag
+	}
+
+	bytesConfig, newETag, notModified, err := readConfigFromURL(ctx, client, sourceURL, etag)
+	if err != nil {
+		return types.DerekRepoConfig{}, err
+	}
+
+	if !notModified {
+		cached = cachedConfig{etag: newETag}
+		if err := parseConfig(ctx, sourceURL, bytesConfig, &cached.config); err != nil {
+			return types.DerekRepoConfig{}, err
+		}
+	}
+	repoConfigs.storeSource(sourceURL, cached)
+
+	return copyConfig(cached.config), nil
+}
+
+// parseConfig decodes a .DEREK.yml leniently, so that a file with an
+// unknown field is still used. Its problems are logged as warnings, and
+// are errors for `derek config validate` and the config_lint check.
+func parseConfig(ctx context.Context, source string, bytesOut []byte, config *types.DerekRepoConfig) error {
+	parsed, problems, err := parseRepoConfigLenient(source, bytesOut)
+	if err != nil {
+		return err
+	}
 
-	if len(config.Maintainers) == 0 && len(config.Curators) > 0 {
-		config.Maintainers = config.Curators
+	for _, problem := range problems {
+		logging.FromContext(ctx).Warnf("Problem with config: %s", problem)
 	}
 
-	return err
+	*config = parsed
+	return nil
 }
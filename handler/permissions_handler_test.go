@@ -4,14 +4,17 @@
 package handler
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
+	"github.com/alexellis/derek/config"
 	"github.com/alexellis/derek/types"
 )
 
 func Test_maintainersparsed(t *testing.T) {
 	config := types.DerekRepoConfig{}
-	parseConfig([]byte(`maintainers:
+	parseConfig(context.Background(), configFile, []byte(`maintainers:
 - alexellis
 - rgee0
 `), &config)
@@ -42,7 +45,7 @@ func Test_validateRedirectURL(t *testing.T) {
 		},
 	}
 	// append valid domain tests
-	for _, d := range getValidRedirectDomains() {
+	for _, d := range getValidRedirectDomains(config.Config{}) {
 		tests = append(tests,
 			redirectURLTest{URL: d, expectedErr: false},
 			redirectURLTest{URL: "http://" + d, expectedErr: false},
@@ -50,17 +53,39 @@ func Test_validateRedirectURL(t *testing.T) {
 		)
 	}
 	for _, test := range tests {
-		err := validateRedirectURL(test.URL)
+		err := validateRedirectURL(test.URL, config.Config{})
 		if (err != nil) != test.expectedErr {
 			t.Fatalf("URL: %q, expected error: %v, got: %v", test.URL, err != nil, test.expectedErr)
 		}
 	}
 }
 
+func Test_validateRedirectURL_Enterprise(t *testing.T) {
+	ghes := config.Config{
+		WebBaseURL: "https://github.example.com",
+		RawBaseURL: "https://raw.github.example.com",
+	}
+
+	tests := []struct {
+		URL         string
+		expectedErr bool
+	}{
+		{URL: "https://github.example.com/org/config/raw/master/.DEREK.yml", expectedErr: false},
+		{URL: "https://raw.github.example.com/org/config/master/.DEREK.yml", expectedErr: false},
+		{URL: "https://raw.githubusercontent.com/org/config/master/.DEREK.yml", expectedErr: true},
+	}
+	for _, test := range tests {
+		err := validateRedirectURL(test.URL, ghes)
+		if (err != nil) != test.expectedErr {
+			t.Errorf("URL: %q, expected error: %v, got: %v", test.URL, test.expectedErr, err)
+		}
+	}
+}
+
 func Test_redirectparsed(t *testing.T) {
 	url := "some-url"
 	config := types.DerekRepoConfig{}
-	parseConfig([]byte(`redirect: `+url), &config)
+	parseConfig(context.Background(), configFile, []byte(`redirect: `+url), &config)
 	actual := len(config.Redirect)
 	lenURL := len(url)
 	if actual != lenURL {
@@ -70,7 +95,7 @@ func Test_redirectparsed(t *testing.T) {
 
 func Test_curatorequalsmaintainer(t *testing.T) {
 	config := types.DerekRepoConfig{}
-	parseConfig([]byte(`curators:
+	parseConfig(context.Background(), configFile, []byte(`curators:
 - alexellis
 - rgee0
 `), &config)
@@ -229,3 +254,39 @@ func Test_PermittedUserFeature(t *testing.T) {
 		})
 	}
 }
+
+func Test_applyOperatorConfig(t *testing.T) {
+	operator := config.OperatorConfig{
+		Defaults: types.DerekRepoConfig{
+			Features:        []string{"comments"},
+			Maintainers:     []string{"operator"},
+			ContributingURL: "https://example.com/CONTRIBUTING.md",
+		},
+		DisabledFeatures: []string{"hacktoberfest"},
+		ForcedFeatures:   []string{"dco_check", "hacktoberfest"},
+	}
+
+	repoConfig := types.DerekRepoConfig{
+		Features:        []string{"Hacktoberfest", "release_notes"},
+		Maintainers:     []string{"alexellis"},
+		ContributingURL: "https://example.com/repo/CONTRIBUTING.md",
+	}
+
+	got, err := applyOperatorConfig(repoConfig, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"comments", "release_notes", "dco_check"}; !reflect.DeepEqual(got.Features, want) {
+		t.Errorf("want features: %v, got: %v", want, got.Features)
+	}
+	if want := []string{"operator", "alexellis"}; !reflect.DeepEqual(got.Maintainers, want) {
+		t.Errorf("want maintainers: %v, got: %v", want, got.Maintainers)
+	}
+	if got.ContributingURL != repoConfig.ContributingURL {
+		t.Errorf("want the repository's contributing URL, got: %q", got.ContributingURL)
+	}
+	if len(operator.Defaults.Features) != 1 {
+		t.Errorf("want the operator's defaults left unchanged, got: %v", operator.Defaults.Features)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/types"
+	"github.com/google/go-github/github"
+)
+
+// PRSnapshot is what the PR features read about a pull request, fetched
+// once per event with a single GraphQL query, or from the REST API when
+// GraphQL is unavailable.
+type PRSnapshot struct {
+	Commits []*github.RepositoryCommit
+	Files   []*github.CommitFile
+	Labels  []string
+
+	// AuthorAssociation is the author's relationship with the repository,
+	// i.e. NONE for a first-time contributor
+	AuthorAssociation string
+}
+
+// FirstTimeContributor whether the author is new to the repo
+func (s *PRSnapshot) FirstTimeContributor() bool {
+	return s.AuthorAssociation == "NONE"
+}
+
+// prSnapshotPageSize is how many commits, files and labels are read,
+// by both the GraphQL query and the REST calls, so that larger PRs are
+// truncated in the same way whichever API is used
+const prSnapshotPageSize = 100
+
+// The snapshot leaves out check runs, since reading them needs the Checks
+// permission, which is only required for dco_status_checks
+const prSnapshotQuery = `query($owner: String!, $repo: String!, $number: Int!, $first: Int!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      authorAssociation
+      labels(first: $first) { nodes { name } }
+      files(first: $first) { nodes { path additions deletions changeType } }
+      commits(first: $first) {
+        nodes {
+          commit {
+            oid
+            message
+            author { name email user { login } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type prSnapshotData struct {
+	Repository *struct {
+		PullRequest *struct {
+			AuthorAssociation string `json:"authorAssociation"`
+			Labels            struct {
+				Nodes []struct {
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"labels"`
+			Files struct {
+				Nodes []struct {
+					Path       string `json:"path"`
+					Additions  int    `json:"additions"`
+					Deletions  int    `json:"deletions"`
+					ChangeType string `json:"changeType"`
+				} `json:"nodes"`
+			} `json:"files"`
+			Commits struct {
+				Nodes []struct {
+					Commit struct {
+						OID     string `json:"oid"`
+						Message string `json:"message"`
+						Author  *struct {
+							Name  string `json:"name"`
+							Email string `json:"email"`
+							User  *struct {
+								Login string `json:"login"`
+							} `json:"user"`
+						} `json:"author"`
+					} `json:"commit"`
+				} `json:"nodes"`
+			} `json:"commits"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+// fetchPRSnapshot gives the snapshot of the PR, which is shared by the
+// features handling the same event
+func fetchPRSnapshot(ctx context.Context, req types.PullRequestOuter, client *GitHub) (*PRSnapshot, error) {
+	value, err := pullRequestDataFromContext(ctx).snapshot.get(func() (interface{}, error) {
+		if client.GraphQL != nil {
+			snapshot, err := queryPRSnapshot(ctx, req, client.GraphQL)
+			if err == nil {
+				return snapshot, nil
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			logging.FromContext(ctx).Warnf("Unable to query PR %d with GraphQL, falling back to REST: %s", req.PullRequest.Number, err)
+		}
+		return restPRSnapshot(ctx, req, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*PRSnapshot), nil
+}
+
+func queryPRSnapshot(ctx context.Context, req types.PullRequestOuter, graphQL GraphQLService) (*PRSnapshot, error) {
+	data := prSnapshotData{}
+	err := graphQL.Query(ctx, prSnapshotQuery, map[string]interface{}{
+		"owner":  req.Repository.Owner.Login,
+		"repo":   req.Repository.Name,
+		"number": req.PullRequest.Number,
+		"first":  prSnapshotPageSize,
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Repository == nil || data.Repository.PullRequest == nil {
+		return nil, errors.New("pull request not found")
+	}
+
+	pr := data.Repository.PullRequest
+	snapshot := &PRSnapshot{
+		AuthorAssociation: pr.AuthorAssociation,
+	}
+
+	for _, label := range pr.Labels.Nodes {
+		snapshot.Labels = append(snapshot.Labels, label.Name)
+	}
+
+	for _, file := range pr.Files.Nodes {
+		snapshot.Files = append(snapshot.Files, &github.CommitFile{
+			Filename:  github.String(file.Path),
+			Additions: github.Int(file.Additions),
+			Deletions: github.Int(file.Deletions),
+			Status:    github.String(fileStatus(file.ChangeType)),
+		})
+	}
+
+	for _, node := range pr.Commits.Nodes {
+		commit := &github.RepositoryCommit{
+			SHA: github.String(node.Commit.OID),
+			Commit: &github.Commit{
+				SHA:     github.String(node.Commit.OID),
+				Message: github.String(node.Commit.Message),
+			},
+		}
+		if author := node.Commit.Author; author != nil {
+			commit.Commit.Author = &github.CommitAuthor{
+				Name:  github.String(author.Name),
+				Email: github.String(author.Email),
+			}
+			if author.User != nil {
+				commit.Author = &github.User{Login: github.String(author.User.Login)}
+			}
+		}
+		snapshot.Commits = append(snapshot.Commits, commit)
+	}
+
+	return snapshot, nil
+}
+
+// fileStatus gives the REST API's status for a GraphQL change type
+func fileStatus(changeType string) string {
+	if changeType == "DELETED" {
+		return "removed"
+	}
+	return strings.ToLower(changeType)
+}
+
+// restPRSnapshot fetches the snapshot with one REST call for each part
+func restPRSnapshot(ctx context.Context, req types.PullRequestOuter, client *GitHub) (*PRSnapshot, error) {
+	snapshot := &PRSnapshot{
+		AuthorAssociation: req.PullRequest.AuthorAssociation,
+	}
+
+	var err error
+	if snapshot.Commits, err = fetchPullRequestCommits(ctx, req, client); err != nil {
+		return nil, err
+	}
+
+	if snapshot.Files, err = fetchPullRequestFileList(ctx, req, client); err != nil {
+		return nil, err
+	}
+
+	issue, err := fetchPullRequestIssue(ctx, req, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range issue.Labels {
+		snapshot.Labels = append(snapshot.Labels, label.GetName())
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alexellis/derek/fakegithub"
+)
+
+// fakeGraphQL answers every query with response, or with err
+type fakeGraphQL struct {
+	response string
+	err      error
+	queries  int
+}
+
+func (f *fakeGraphQL) Query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	f.queries++
+	if f.err != nil {
+		return f.err
+	}
+	return json.Unmarshal([]byte(f.response), v)
+}
+
+const prSnapshotResponse = `{
+  "repository": {
+    "pullRequest": {
+      "authorAssociation": "NONE",
+      "labels": {"nodes": [{"name": "no-dco"}]},
+      "files": {"nodes": [{"path": "README.md", "additions": 2, "deletions": 1, "changeType": "MODIFIED"}]},
+      "commits": {"nodes": [{"commit": {
+        "oid": "abc123",
+        "message": "Fix typo",
+        "author": {"name": "Alex", "email": "alex@example.com", "user": {"login": "alexellis"}}
+      }}]}
+    }
+  }
+}`
+
+func Test_fetchPRSnapshot_GraphQL(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 1, "Fix typo")
+
+	client := newFakeGitHub(fake)
+	client.GraphQL = &fakeGraphQL{response: prSnapshotResponse}
+
+	snapshot, err := fetchPRSnapshot(context.Background(), req, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.Calls()) != 0 {
+		t.Errorf("want no REST calls, got: %v", fake.Calls())
+	}
+
+	if !snapshot.FirstTimeContributor() {
+		t.Errorf("want a first-time contributor")
+	}
+	if want := []string{"no-dco"}; !reflect.DeepEqual(want, snapshot.Labels) {
+		t.Errorf("want labels: %v, got: %v", want, snapshot.Labels)
+	}
+	if len(snapshot.Files) != 1 || snapshot.Files[0].GetFilename() != "README.md" || snapshot.Files[0].GetStatus() != "modified" {
+		t.Errorf("want README.md changed, got: %v", snapshot.Files)
+	}
+	if len(snapshot.Commits) != 1 || snapshot.Commits[0].GetCommit().GetMessage() != "Fix typo" ||
+		snapshot.Commits[0].GetAuthor().GetLogin() != "alexellis" {
+		t.Errorf("want one commit by alexellis, got: %v", snapshot.Commits)
+	}
+}
+
+func Test_fetchPRSnapshot_FallsBackToREST(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 2, "Fix typo")
+	req.PullRequest.AuthorAssociation = "CONTRIBUTOR"
+
+	graphQL := &fakeGraphQL{err: &GraphQLError{Messages: []string{"Resource not accessible by integration"}}}
+	client := newFakeGitHub(fake)
+	client.GraphQL = graphQL
+	ctx := withPullRequestData(context.Background(), &pullRequestData{})
+
+	snapshot, err := fetchPRSnapshot(ctx, req, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchPRSnapshot(ctx, req, client); err != nil {
+		t.Fatal(err)
+	}
+
+	if graphQL.queries != 1 {
+		t.Errorf("want GraphQL tried once for the event, got: %d", graphQL.queries)
+	}
+	if got := countCalls(fake, "PullRequests.ListCommits"); got != 1 {
+		t.Errorf("want commits listed once with REST, got: %d", got)
+	}
+	if len(snapshot.Commits) != 1 || len(snapshot.Files) != 1 {
+		t.Errorf("want commits and files from REST, got: %v, %v", snapshot.Commits, snapshot.Files)
+	}
+	if snapshot.FirstTimeContributor() {
+		t.Errorf("want the author association from the webhook")
+	}
+	if got := countCalls(fake, "Checks.ListCheckRunsForRef"); got != 0 {
+		t.Errorf("want no check runs listed without dco_status_checks, got: %d", got)
+	}
+}
+
+func Test_fetchPRSnapshot_DoesNotFallBackAfterDeadline(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 3, "Fix typo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := newFakeGitHub(fake)
+	client.GraphQL = &fakeGraphQL{err: errors.New("context canceled")}
+
+	if _, err := fetchPRSnapshot(ctx, req, client); err == nil {
+		t.Errorf("want an error")
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("want no REST calls, got: %v", fake.Calls())
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"sync"
+)
+
+// pullRequestData fetches the snapshot of a pull request once per event,
+// so that the features handling the event share the calls to GitHub
+// rather than each making their own.
+type pullRequestData struct {
+	snapshot fetchOnce
+}
+
+// fetchOnce keeps the first successful result of a fetch, errors are not
+// kept so that a later feature can try again
+type fetchOnce struct {
+	mu    sync.Mutex
+	done  bool
+	value interface{}
+}
+
+func (f *fetchOnce) get(fetch func() (interface{}, error)) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.done {
+		return f.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	f.value = value
+	f.done = true
+	return value, nil
+}
+
+type pullRequestDataKey struct{}
+
+func withPullRequestData(ctx context.Context, data *pullRequestData) context.Context {
+	return context.WithValue(ctx, pullRequestDataKey{}, data)
+}
+
+// pullRequestDataFromContext gives the data shared by the event, or empty
+// data which is not shared when handlers are called outside of an event
+func pullRequestDataFromContext(ctx context.Context) *pullRequestData {
+	if data, ok := ctx.Value(pullRequestDataKey{}).(*pullRequestData); ok {
+		return data
+	}
+	return &pullRequestData{}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/fakegithub"
+)
+
+func countCalls(fake *fakegithub.Client, method string) int {
+	count := 0
+	for _, call := range fake.Calls() {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+func Test_pullRequestData_SharedByFeatures(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 7, "Update README.md")
+	req.Action = openedPRAction
+
+	client := newFakeGitHub(fake)
+	ctx := withPullRequestData(context.Background(), &pullRequestData{})
+
+	HandlePullRequest(ctx, client, req, "", config.Config{})
+	HandleHacktoberfestPR(ctx, client, req, "")
+
+	if got := countCalls(fake, "PullRequests.ListCommits"); got != 1 {
+		t.Errorf("want commits listed once for the event, got: %d", got)
+	}
+}
+
+func Test_pullRequestData_NotSharedWithoutEvent(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 8, "Update README.md")
+
+	client := newFakeGitHub(fake)
+	fetchPRSnapshot(context.Background(), req, client)
+	fetchPRSnapshot(context.Background(), req, client)
+
+	if got := countCalls(fake, "PullRequests.ListCommits"); got != 2 {
+		t.Errorf("want commits listed for each call, got: %d", got)
+	}
+}
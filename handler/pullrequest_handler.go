@@ -8,16 +8,16 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"os"
-
 	"github.com/alexellis/derek/auth"
 	"github.com/alexellis/derek/config"
-	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/metrics"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -25,6 +25,8 @@ const (
 	openedPRAction             = "opened"
 	actionRequiredConclusion   = "action_required"
 	successConclusion          = "success"
+	failureConclusion          = "failure"
+	neutralConclusion          = "neutral"
 )
 
 // DCO is the check name
@@ -32,93 +34,116 @@ var DCO string = "DCO"
 
 var anonymousSign = regexp.MustCompile("Signed-off-by:(.*)noreply.github.com")
 
-func HandlePullRequest(req types.PullRequestOuter, contributingURL string, config config.Config) {
-	ctx := context.Background()
-	token, tokenErr := getAccessToken(config, req.Installation.ID)
-
-	if tokenErr != nil {
-		fmt.Printf("Error getting installation token: %s\n", tokenErr.Error())
-		return
-	}
+// HandlePullRequest checks every commit in the PR is signed-off, labelling and
+// commenting on the PR when they are not, and updating the DCO check run if enabled.
+func HandlePullRequest(ctx context.Context, client *GitHub, req types.PullRequestOuter, contributingURL string, config config.Config) *Result {
+	result := NewResult(dcoCheckFeature)
 
-	client := factory.MakeClient(ctx, token, config)
+	// dcoRun is the DCO check run to update once the commits are checked,
+	// it stays nil when the run is not created yet. Only the first attempt
+	// sets it, since a queued retry runs after the handler has returned.
+	var dcoRun *github.CheckRun
+	var firstAttempt sync.Once
 
 	if config.DCOStatusChecks {
-		checkErr := createSuccessfulCheck(req, client, ctx)
+		queued, checkErr := RunOrQueue(ctx, "create DCO check run", func(ctx context.Context) error {
+			checkRun, err := createSuccessfulCheck(req, client, ctx)
+			firstAttempt.Do(func() {
+				dcoRun = checkRun
+			})
+			return err
+		})
 		if checkErr != nil {
-			log.Fatalf("Error while creating successful DCO check: %s", checkErr.Error())
+			result.Fail(fmt.Errorf("error while creating successful DCO check: %s", checkErr.Error()))
+		} else if queued {
+			result.Skip("queued creating %s check run for retry", DCO)
+		} else {
+			result.Action("ensured %s check run exists", DCO)
 		}
 	}
 
 	if req.Action == "review_requested" {
-		log.Printf("[%s/%s] review_requested on PR %d, unable to process this request\n",
-			req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
-		return
+		result.Skip("review_requested on PR %d, unable to process this request", req.PullRequest.Number)
+		return result
 	}
 
 	if req.Action == openedPRAction {
 		if req.PullRequest.FirstTimeContributor() == true {
-			_, res, assignLabelErr := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{"new-contributor"})
+			var res *github.Response
+			queued, assignLabelErr := RunOrQueue(ctx, "add new-contributor label", func(ctx context.Context) (err error) {
+				_, res, err = client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{"new-contributor"})
+				return err
+			})
 			if assignLabelErr != nil {
-				log.Fatalf("[%s/%s] %s limit: %d, remaining: %d",
-					req.Repository.Owner.Login, req.Repository.Name, assignLabelErr, res.Limit, res.Remaining)
+				result.Fail(fmt.Errorf("[%s/%s] unable to add new-contributor label: %s %s",
+					req.Repository.Owner.Login, req.Repository.Name, assignLabelErr, formatRate(res)))
+			} else if queued {
+				result.Skip("queued adding new-contributor label to PR %d for retry", req.PullRequest.Number)
+			} else {
+				result.Action("added new-contributor label to PR %d", req.PullRequest.Number)
 			}
 		}
 	}
 
-	commits, err := fetchPullRequestCommits(req, client)
+	snapshot, err := fetchPRSnapshot(ctx, req, client)
 	if err != nil {
-		log.Fatalf("[%s/%s] unable to fetch pull request commits for PR %d: %s",
-			req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, err)
+		result.Fail(fmt.Errorf("[%s/%s] unable to fetch PR %d: %s",
+			req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, err))
+		return result
 	}
 
-	issue, resp, labelErr := client.Issues.Get(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
-	action := "Issues.Get"
-	if resp != nil {
-		fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
-	}
+	anonymousSign := hasAnonymousSign(snapshot.Commits)
+	unsignedCommits := hasUnsigned(snapshot.Commits)
+	noDcoLabelExists := hasNoDcoLabel(snapshot.Labels)
 
-	if labelErr != nil {
-		log.Fatalf("%s - [%s/%s] unable to fetch labels for PR %d: %s",
-			action, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, err)
+	if anonymousSign || unsignedCommits {
+		metrics.DCOChecks.Inc("fail")
+	} else {
+		metrics.DCOChecks.Inc("pass")
 	}
 
-	defer resp.Body.Close()
-
-	anonymousSign := hasAnonymousSign(commits)
-	unsignedCommits := hasUnsigned(commits)
-	noDcoLabelExists := hasNoDcoLabel(issue)
-
 	if config.DCOStatusChecks {
+		conclusion := successConclusion
 		if unsignedCommits {
-			checkErr := updateExistingDCOCheck(req, client, ctx, actionRequiredConclusion)
-			if checkErr != nil {
-				log.Fatalf("Error while updating existing DCO check: %s", checkErr)
-			}
+			conclusion = actionRequiredConclusion
+		}
+
+		// A create which failed, was queued or was only planned in dry-run
+		// has no run to update, the queued create sets it to success
+		if dcoRun == nil || dcoRun.ID == nil {
+			result.Skip("%s check run was not created, so is not set to %s", DCO, conclusion)
+		} else if queued, checkErr := RunOrQueue(ctx, "update DCO check run", func(ctx context.Context) error {
+			return updateExistingDCOCheck(req, client, ctx, dcoRun, conclusion)
+		}); checkErr != nil {
+			result.Fail(fmt.Errorf("error while updating existing DCO check: %s", checkErr))
+		} else if queued {
+			result.Skip("queued setting %s check run to %s for retry", DCO, conclusion)
 		} else {
-			checkErr := updateExistingDCOCheck(req, client, ctx, successConclusion)
-			if checkErr != nil {
-				log.Fatalf("Error while updating check: %s", checkErr.Error())
-			}
+			result.Action("set %s check run to %s", DCO, conclusion)
 		}
 	}
 
 	if !anonymousSign && !unsignedCommits {
 		if noDcoLabelExists {
-			fmt.Printf("[%s/%s] Removing no-dco label: PR: %d\n",
-				req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
-			resp, removeLabelErr := client.Issues.RemoveLabelForIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, "no-dco")
+			logging.FromContext(ctx).Info("Removing no-dco label")
+			queued, removeLabelErr := RunOrQueue(ctx, "remove no-dco label", func(ctx context.Context) error {
+				resp, err := client.Issues.RemoveLabelForIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, "no-dco")
+				logRateLimits(ctx, "RemoveLabelForIssue", resp)
+				return err
+			})
 			if removeLabelErr != nil {
-				log.Fatalf("unable to remove DCO label from PR %d: %s", req.PullRequest.Number, err)
+				result.Fail(fmt.Errorf("unable to remove DCO label from PR %d: %s", req.PullRequest.Number, removeLabelErr))
+				return result
 			}
-			action := "RemoveLabelForIssue"
-			if resp != nil {
-				fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
+			if queued {
+				result.Skip("queued removing no-dco label from PR %d for retry", req.PullRequest.Number)
+			} else {
+				result.Action("removed no-dco label from PR %d", req.PullRequest.Number)
 			}
-			fmt.Printf("[%s/%s] Removing no-dco label: PR: %d\n",
-				req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
+		} else {
+			result.Skip("all commits signed-off on PR %d", req.PullRequest.Number)
 		}
-		return
+		return result
 	}
 
 	var body string
@@ -129,62 +154,117 @@ func HandlePullRequest(req types.PullRequestOuter, contributingURL string, confi
 	}
 
 	if !noDcoLabelExists {
-		fmt.Printf("[%s/%s] Adding no-dco label: PR: %d\n",
-			req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
+		logging.FromContext(ctx).Info("Adding no-dco label")
 
-		_, resp, assignLabelErr := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{"no-dco"})
 		action := "AddLabelsToIssue"
-		if resp != nil {
-			fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
-		}
+		queued, assignLabelErr := RunOrQueue(ctx, "add no-dco label", func(ctx context.Context) error {
+			_, resp, err := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{"no-dco"})
+			logRateLimits(ctx, action, resp)
+			return err
+		})
 
 		if assignLabelErr != nil {
-			log.Fatalf("%s unable to add DCO label to PR %d: %v", action, req.PullRequest.Number, assignLabelErr)
+			result.Fail(fmt.Errorf("%s unable to add DCO label to PR %d: %v", action, req.PullRequest.Number, assignLabelErr))
+			return result
 		}
-		if err = createPullRequestComment(ctx, body, req, client); err != nil {
-			log.Fatalf("unable to add comment on PR %d: %v", req.PullRequest.Number, err)
+		if queued {
+			result.Skip("queued adding no-dco label to PR %d for retry", req.PullRequest.Number)
+		} else {
+			result.Action("added no-dco label to PR %d", req.PullRequest.Number)
+		}
+
+		queued, err = RunOrQueue(ctx, "comment on missing sign-off", func(ctx context.Context) error {
+			return createPullRequestComment(ctx, body, req, client)
+		})
+		if err != nil {
+			result.Fail(fmt.Errorf("unable to add comment on PR %d: %v", req.PullRequest.Number, err))
+			return result
+		}
+		if queued {
+			result.Skip("queued comment on PR %d for retry", req.PullRequest.Number)
+		} else {
+			result.Action("commented on PR %d", req.PullRequest.Number)
 		}
 	} else {
-		fmt.Printf("[%s/%s] DCO label already applied: PR: %d\n",
-			req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
+		result.Skip("DCO label already applied to PR %d", req.PullRequest.Number)
 	}
+
+	return result
 }
 
 // VerifyPullRequestDescription checks that the PR has anything in the body.
 // If there is no body, a label is added and comment posted to the PR with a link to the contributing guide.
-func VerifyPullRequestDescription(req types.PullRequestOuter, contributingURL string, config config.Config) {
-	ctx := context.Background()
-	token, tokenErr := getAccessToken(config, req.Installation.ID)
+func VerifyPullRequestDescription(ctx context.Context, client *GitHub, req types.PullRequestOuter, contributingURL string) *Result {
+	result := NewResult(prDescriptionRequiredFeature)
 
-	if tokenErr != nil {
-		fmt.Printf("Error getting installation token: %s\n", tokenErr.Error())
-		return
+	if req.Action != openedPRAction {
+		result.Skip("only checked when a PR is opened, action: %s", req.Action)
+		return result
 	}
 
-	client := factory.MakeClient(ctx, token, config)
+	if hasDescription(req.PullRequest) {
+		result.Skip("PR %d has a description", req.PullRequest.Number)
+		return result
+	}
 
-	if req.Action == openedPRAction {
-		if !hasDescription(req.PullRequest) {
-			fmt.Printf("Applying label: %s", prDescriptionRequiredLabel)
-			_, res, assignLabelErr := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{prDescriptionRequiredLabel})
-			if assignLabelErr != nil {
-				log.Fatalf("%s limit: %d, remaining: %d", assignLabelErr, res.Limit, res.Remaining)
-			}
+	logging.FromContext(ctx).Infof("Applying label: %s", prDescriptionRequiredLabel)
+	var res *github.Response
+	queued, assignLabelErr := RunOrQueue(ctx, "add "+prDescriptionRequiredLabel+" label", func(ctx context.Context) (err error) {
+		_, res, err = client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, []string{prDescriptionRequiredLabel})
+		return err
+	})
+	if assignLabelErr != nil {
+		result.Fail(fmt.Errorf("unable to add %s label: %s %s", prDescriptionRequiredLabel, assignLabelErr, formatRate(res)))
+		return result
+	}
+	if queued {
+		result.Skip("queued adding %s label to PR %d for retry", prDescriptionRequiredLabel, req.PullRequest.Number)
+	} else {
+		result.Action("added %s label to PR %d", prDescriptionRequiredLabel, req.PullRequest.Number)
+	}
 
-			body := emptyDescriptionComment(contributingURL)
+	body := emptyDescriptionComment(contributingURL)
 
-			comment := &github.IssueComment{
-				Body: &body,
-			}
+	comment := &github.IssueComment{
+		Body: &body,
+	}
 
-			comment, resp, err := client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, comment)
-			if err != nil {
-				log.Fatalf("%s limit: %d, remaining: %d", assignLabelErr, resp.Limit, resp.Remaining)
-				log.Fatal(err)
-			}
-			fmt.Println(comment, resp.Rate)
-		}
+	var resp *github.Response
+	queued, err := RunOrQueue(ctx, "comment on missing description", func(ctx context.Context) (err error) {
+		_, resp, err = client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, comment)
+		return err
+	})
+	if err != nil {
+		result.Fail(fmt.Errorf("unable to comment on PR %d: %s %s", req.PullRequest.Number, err, formatRate(resp)))
+		return result
+	}
+	if queued {
+		result.Skip("queued comment on PR %d for retry", req.PullRequest.Number)
+	} else {
+		result.Action("commented on PR %d", req.PullRequest.Number)
 	}
+
+	return result
+}
+
+// logRateLimits logs the rate limit left after a call, resp may be nil
+func logRateLimits(ctx context.Context, action string, resp *github.Response) {
+	if resp == nil {
+		return
+	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"call":           action,
+		"rate_limit":     resp.Rate.Limit,
+		"rate_remaining": resp.Rate.Remaining,
+	}).Debug("GitHub rate limits")
+}
+
+// formatRate describes the rate limit from a response which may be nil
+func formatRate(resp *github.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return fmt.Sprintf("limit: %d, remaining: %d", resp.Rate.Limit, resp.Rate.Remaining)
 }
 
 const fixCommits = `### :bulb: Shall we fix this?
@@ -227,37 +307,65 @@ func emptyDescriptionComment(contributingURL string) string {
 That's something we need before your Pull Request can be merged. Please see our [contributing guide](` + contributingURL + `).`
 }
 
-func getAccessToken(config config.Config, installationID int) (string, error) {
-	token := os.Getenv("personal_access_token")
-	if len(token) == 0 {
+// tokenCacheKey is the config a token cache is made from, so that a
+// reloaded config which changes any of it gets a cache of its own
+type tokenCacheKey struct {
+	path          string
+	apiURL        string
+	applicationID string
+}
 
-		installationToken, tokenErr := auth.MakeAccessTokenForInstallation(
-			config.ApplicationID,
-			installationID,
-			config.PrivateKey)
+var (
+	tokenCachesMu sync.Mutex
+	tokenCaches   = map[tokenCacheKey]*auth.TokenCache{}
+)
 
-		if tokenErr != nil {
-			return "", tokenErr
-		}
+// installationTokens returns the token cache shared by all handlers,
+// so that a single event only needs one token exchange with GitHub.
+func installationTokens(config config.Config) *auth.TokenCache {
+	key := tokenCacheKey{
+		path:          config.TokenCachePath,
+		apiURL:        config.APIURL(),
+		applicationID: config.ApplicationID,
+	}
+
+	tokenCachesMu.Lock()
+	defer tokenCachesMu.Unlock()
 
-		token = installationToken
+	cache, ok := tokenCaches[key]
+	if !ok {
+		cache = auth.NewTokenCache(key.path, key.apiURL)
+		tokenCaches[key] = cache
 	}
+	return cache
+}
 
-	return token, nil
+// installationTokenSource gives the clients made by makeClient the
+// installation's token from the shared cache
+type installationTokenSource struct {
+	cache        *auth.TokenCache
+	config       config.Config
+	installation int
 }
 
-func hasNoDcoLabel(issue *github.Issue) bool {
-	if issue != nil {
-		for _, label := range issue.Labels {
-			if label.GetName() == "no-dco" {
-				return true
-			}
+func (s *installationTokenSource) Token(ctx context.Context) (string, error) {
+	return s.cache.Token(ctx, s.config.ApplicationID, s.installation, s.config.PrivateKey)
+}
+
+func (s *installationTokenSource) Invalidate() {
+	s.cache.Invalidate(s.installation)
+}
+
+func hasNoDcoLabel(labels []string) bool {
+	for _, label := range labels {
+		if label == "no-dco" {
+			return true
 		}
 	}
 	return false
 }
 
-func createPullRequestComment(ctx context.Context, body string, req types.PullRequestOuter, client *github.Client) error {
+func createPullRequestComment(ctx context.Context, body string, req types.PullRequestOuter, client *GitHub) error {
 	comment := &github.IssueComment{
 		Body: &body,
 	}
@@ -266,55 +374,46 @@ func createPullRequestComment(ctx context.Context, body string, req types.PullRe
 	_, resp, err := client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, comment)
 
 	action := "CreateComment"
-	if resp != nil {
-		fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
-	}
+	logRateLimits(ctx, action, resp)
 
 	if err != nil {
-		log.Fatalf("Error with %s for PR %s/%s, %d\n%s", action, owner, repo, req.PullRequest.Number, err.Error())
-		return err
+		return fmt.Errorf("error with %s for PR %s/%s, %d: %w", action, owner, repo, req.PullRequest.Number, err)
 	}
 
 	resp.Body.Close()
 	return nil
 }
 
-func fetchPullRequestCommits(req types.PullRequestOuter, client *github.Client) ([]*github.RepositoryCommit, error) {
-	ctx := context.Background()
+// fetchPullRequestCommits lists the PR's commits with the REST API
+func fetchPullRequestCommits(ctx context.Context, req types.PullRequestOuter, client *GitHub) ([]*github.RepositoryCommit, error) {
 	listOpts := &github.ListOptions{
-		Page: 0,
+		PerPage: prSnapshotPageSize,
 	}
 	owner := req.Repository.Owner.Login
 	repo := req.Repository.Name
 	commits, resp, err := client.PullRequests.ListCommits(ctx, owner, repo, req.PullRequest.Number, listOpts)
 
 	action := "ListCommits"
-	if resp != nil {
-		fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
-	}
+	logRateLimits(ctx, action, resp)
 
 	if err != nil {
-		log.Fatalf("Error with %s for PR %s/%s, %d\n%s", action, owner, repo, req.PullRequest.Number, err.Error())
-		return nil, err
+		return nil, fmt.Errorf("error with %s for PR %s/%s, %d: %s", action, owner, repo, req.PullRequest.Number, err.Error())
 	}
 
 	resp.Body.Close()
 	return commits, nil
 }
 
-func fetchPullRequestFileList(req types.PullRequestOuter, client *github.Client) ([]*github.CommitFile, error) {
-	ctx := context.Background()
+// fetchPullRequestFileList lists the files changed by the PR with the REST API
+func fetchPullRequestFileList(ctx context.Context, req types.PullRequestOuter, client *GitHub) ([]*github.CommitFile, error) {
 	listOpts := &github.ListOptions{
-		Page: 0,
+		PerPage: prSnapshotPageSize,
 	}
 	action := "ListFiles"
 	commitFiles, resp, err := client.PullRequests.ListFiles(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, listOpts)
-	if resp != nil {
-		fmt.Printf("%s rate limits: %d/%d\n", action, resp.Rate.Remaining, resp.Rate.Limit)
-	}
+	logRateLimits(ctx, action, resp)
 	if err != nil {
-		log.Fatalf("Error with %s for PR %d\n%s", action, req.PullRequest.Number, err.Error())
-		return nil, err
+		return nil, fmt.Errorf("error with %s for PR %d: %s", action, req.PullRequest.Number, err.Error())
 	}
 
 	defer resp.Body.Close()
@@ -322,6 +421,21 @@ func fetchPullRequestFileList(req types.PullRequestOuter, client *github.Client)
 	return commitFiles, nil
 }
 
+// fetchPullRequestIssue gets the PR's issue for its labels with the REST API
+func fetchPullRequestIssue(ctx context.Context, req types.PullRequestOuter, client *GitHub) (*github.Issue, error) {
+	issue, resp, err := client.Issues.Get(ctx, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number)
+	action := "Issues.Get"
+	logRateLimits(ctx, action, resp)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s - [%s/%s] unable to fetch labels for PR %d: %s",
+			action, req.Repository.Owner.Login, req.Repository.Name, req.PullRequest.Number, err)
+	}
+
+	defer resp.Body.Close()
+	return issue, nil
+}
+
 func hasUnsigned(commits []*github.RepositoryCommit) bool {
 	for _, commit := range commits {
 		if commit.Commit != nil && commit.Commit.Message != nil {
@@ -356,47 +470,52 @@ func hasDescription(pr types.PullRequest) bool {
 	return len(strings.TrimSpace(pr.Body)) > 0
 }
 
-func createSuccessfulCheck(req types.PullRequestOuter, client *github.Client, ctx context.Context) error {
+// createSuccessfulCheck gives the DCO check run of the head commit, creating
+// it when there is none. A run created in dry-run mode has no ID.
+func createSuccessfulCheck(req types.PullRequestOuter, client *GitHub, ctx context.Context) (*github.CheckRun, error) {
 	checks, checksErr := determineExistingDCOCheck(req, client, ctx)
 	if checksErr != nil {
-		return fmt.Errorf("Error while creating successful DCO check: %s", checksErr.Error())
+		return nil, fmt.Errorf("Error while creating successful DCO check: %w", checksErr)
 	}
 	if *checks.Total > 1 {
-		return fmt.Errorf("Error unexpected count of existing DCO checks: %d", *checks.Total)
+		return nil, fmt.Errorf("Error unexpected count of existing DCO checks: %d", *checks.Total)
 	}
 	if *checks.Total == 1 {
-		return nil
+		return checks.CheckRuns[0], nil
 	}
 
 	check := createDCOCheck(req)
-	_, apiResponse, apiErr := client.Checks.CreateCheckRun(ctx, req.Repository.Owner.Login, req.Repository.Name, check)
+	checkRun, apiResponse, apiErr := client.Checks.CreateCheckRun(ctx, req.Repository.Owner.Login, req.Repository.Name, check)
 	if apiErr != nil {
-		return fmt.Errorf("Error while creating successful DCO check: %s", apiErr.Error())
+		return nil, fmt.Errorf("Error while creating successful DCO check: %w", apiErr)
 	}
 	if apiResponse.StatusCode != 201 {
-		return fmt.Errorf("Error while creating successful DCO check unexpected status code: %d", apiResponse.StatusCode)
+		return nil, fmt.Errorf("Error while creating successful DCO check unexpected status code: %d", apiResponse.StatusCode)
 	}
-	return nil
+	if checkRun == nil {
+		checkRun = &github.CheckRun{}
+	}
+	return checkRun, nil
 }
 
-func determineExistingDCOCheck(req types.PullRequestOuter, client *github.Client, ctx context.Context) (*github.ListCheckRunsResults, error) {
+func determineExistingDCOCheck(req types.PullRequestOuter, client *GitHub, ctx context.Context) (*github.ListCheckRunsResults, error) {
 	checks, checkRes, checkErr := client.Checks.ListCheckRunsForRef(ctx,
 		req.Repository.Owner.Login,
 		req.Repository.Name,
 		req.PullRequest.Head.SHA,
 		&github.ListCheckRunsOptions{CheckName: &DCO})
 
+	if checkErr != nil {
+		return nil, fmt.Errorf("Error while retreiving existing checks: %w", checkErr)
+	}
 	if checkRes.StatusCode != 200 {
 		return nil, fmt.Errorf("Error unexpected status code while retreiving existing checks %d", checkRes.StatusCode)
 	}
-	if checkErr != nil {
-		return nil, fmt.Errorf("Error while retreiving existing checks: %s", checkErr.Error())
-	}
 	return checks, nil
 }
 
 func createDCOCheck(req types.PullRequestOuter) github.CreateCheckRunOptions {
-	now := github.Timestamp{time.Now()}
+	now := github.Timestamp{Time: time.Now()}
 	status := "in_progress"
 	text := "Thank you for the contribution, everything looks fine."
 	title := "Signed commits"
@@ -418,25 +537,20 @@ func createDCOCheck(req types.PullRequestOuter) github.CreateCheckRunOptions {
 	return check
 }
 
-func updateExistingDCOCheck(req types.PullRequestOuter, client *github.Client, ctx context.Context, conclusion string) error {
+// updateExistingDCOCheck sets the conclusion of the run which was just
+// created or found, rather than listing it again, as a run created moments
+// ago may not be listed yet
+func updateExistingDCOCheck(req types.PullRequestOuter, client *GitHub, ctx context.Context, checkRun *github.CheckRun, conclusion string) error {
 	var check github.UpdateCheckRunOptions
-	checks, checksErr := determineExistingDCOCheck(req, client, ctx)
-	if checksErr != nil {
-		return fmt.Errorf("Error while creating successful DCO check: %s", checksErr.Error())
-	}
-	if *checks.Total == 0 {
-		return fmt.Errorf("Error unexpected count of existing DCO checks: %d", *checks.Total)
-	}
-
 	if conclusion == successConclusion {
-		check = updateSuccessfulDCOCheck(checks)
+		check = updateSuccessfulDCOCheck(checkRun)
 	} else if conclusion == actionRequiredConclusion {
-		check = updateUnsuccessfulDCOCheck(checks)
+		check = updateUnsuccessfulDCOCheck(checkRun)
 	}
 
-	_, apiResponse, apiErr := client.Checks.UpdateCheckRun(ctx, req.Repository.Owner.Login, req.Repository.Name, *checks.CheckRuns[0].ID, check)
+	_, apiResponse, apiErr := client.Checks.UpdateCheckRun(ctx, req.Repository.Owner.Login, req.Repository.Name, checkRun.GetID(), check)
 	if apiErr != nil {
-		return fmt.Errorf("Error while updating the DCO check: %s", apiErr.Error())
+		return fmt.Errorf("Error while updating the DCO check: %w", apiErr)
 	}
 	if apiResponse.StatusCode != 200 {
 		return fmt.Errorf("Error while updating the DCO check unexpected status code: %d", apiResponse.StatusCode)
@@ -444,14 +558,14 @@ func updateExistingDCOCheck(req types.PullRequestOuter, client *github.Client, c
 	return nil
 }
 
-func updateSuccessfulDCOCheck(checks *github.ListCheckRunsResults) github.UpdateCheckRunOptions {
-	now := github.Timestamp{time.Now()}
+func updateSuccessfulDCOCheck(checkRun *github.CheckRun) github.UpdateCheckRunOptions {
+	now := github.Timestamp{Time: time.Now()}
 	text := "Thank you for the contribution, everything looks fine."
 	title := "Signed commits"
 	summary := "All of your commits are signed"
 
 	check := github.UpdateCheckRunOptions{
-		Name: *checks.CheckRuns[0].Name,
+		Name: checkRun.GetName(),
 		Output: &github.CheckRunOutput{
 			Text:    &text,
 			Title:   &title,
@@ -464,8 +578,8 @@ func updateSuccessfulDCOCheck(checks *github.ListCheckRunsResults) github.Update
 	return check
 }
 
-func updateUnsuccessfulDCOCheck(checks *github.ListCheckRunsResults) github.UpdateCheckRunOptions {
-	now := github.Timestamp{time.Now()}
+func updateUnsuccessfulDCOCheck(checkRun *github.CheckRun) github.UpdateCheckRunOptions {
+	now := github.Timestamp{Time: time.Now()}
 	text := `Thank you for your contribution. I've just checked and your commit doesn't appear to be signed-off.
 	That's something we need before your Pull Request can be merged.`
 
@@ -473,7 +587,7 @@ func updateUnsuccessfulDCOCheck(checks *github.ListCheckRunsResults) github.Upda
 	summary := "One or more of the commits in this Pull Request are not signed-off."
 
 	check := github.UpdateCheckRunOptions{
-		Name: *checks.CheckRuns[0].Name,
+		Name: checkRun.GetName(),
 		Output: &github.CheckRunOutput{
 			Text:    &text,
 			Title:   &title,
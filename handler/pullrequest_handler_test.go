@@ -4,8 +4,14 @@
 package handler
 
 import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/fakegithub"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
 )
@@ -81,14 +87,7 @@ func Test_hasNoDcoLabel(t *testing.T) {
 	for _, test := range labelOpts {
 		t.Run(test.title, func(t *testing.T) {
 
-			var ghLabels []github.Label
-			for _, label := range test.labels {
-				ghLabels = append(ghLabels, github.Label{Name: &label})
-			}
-
-			inputIssue := &github.Issue{Labels: ghLabels}
-
-			hasLabel := hasNoDcoLabel(inputIssue)
+			hasLabel := hasNoDcoLabel(test.labels)
 
 			if hasLabel != test.expectedBool {
 				t.Errorf("Has no-dco label - wanted: %t, found %t", test.expectedBool, hasLabel)
@@ -213,3 +212,113 @@ func Test_hasAnonymousSign(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func newPullRequest(fake *fakegithub.Client, number int, messages ...string) types.PullRequestOuter {
+	var commits []*github.RepositoryCommit
+	for _, msg := range messages {
+		commits = append(commits, &github.RepositoryCommit{Commit: &github.Commit{Message: github.String(msg)}})
+	}
+
+	fake.AddPullRequest("alexellis", "derek", &github.PullRequest{
+		Number: github.Int(number),
+		State:  github.String("open"),
+	}, commits, []*github.CommitFile{{Filename: github.String("README.md")}})
+
+	return types.PullRequestOuter{
+		Repository:  types.Repository{Owner: types.Owner{Login: "alexellis"}, Name: "derek"},
+		PullRequest: types.PullRequest{Number: number, State: "open", Head: types.Head{SHA: "abc123"}},
+		Action:      "synchronize",
+	}
+}
+
+func Test_HandlePullRequest_Unsigned(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 1, "Fix typo")
+
+	result := HandlePullRequest(context.Background(), newFakeGitHub(fake), req, "https://example.com/CONTRIBUTING.md", config.Config{DCOStatusChecks: true})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	if want, got := []string{"no-dco"}, fake.Labels("alexellis", "derek", 1); !reflect.DeepEqual(want, got) {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+
+	comments := fake.Comments("alexellis", "derek", 1)
+	if len(comments) != 1 || !strings.Contains(comments[0], "https://example.com/CONTRIBUTING.md") {
+		t.Errorf("want a comment linking to the contributing guide, got: %v", comments)
+	}
+
+	runs := fake.CheckRuns("alexellis", "derek")
+	if len(runs) != 1 || runs[0].GetConclusion() != actionRequiredConclusion {
+		t.Errorf("want one %s check run, got: %v", actionRequiredConclusion, runs)
+	}
+}
+
+// plannedChecks answers CreateCheckRun as the dry-run transport does, with
+// an empty run which was never created
+type plannedChecks struct {
+	ChecksService
+}
+
+func (p *plannedChecks) CreateCheckRun(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	return &github.CheckRun{}, &github.Response{Response: &http.Response{StatusCode: http.StatusCreated}}, nil
+}
+
+func Test_HandlePullRequest_DryRunDoesNotUpdatePlannedCheck(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 3, "Fix typo")
+
+	client := newFakeGitHub(fake)
+	client.Checks = &plannedChecks{ChecksService: fake.Checks}
+
+	result := HandlePullRequest(context.Background(), client, req, "", config.Config{DCOStatusChecks: true})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	if got := countCalls(fake, "Checks.UpdateCheckRun"); got != 0 {
+		t.Errorf("want the planned check run not updated, got: %d calls", got)
+	}
+	if got := countCalls(fake, "Checks.ListCheckRunsForRef"); got != 1 {
+		t.Errorf("want check runs listed once, got: %d", got)
+	}
+}
+
+func Test_HandlePullRequest_SignedRemovesLabel(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 2, "Fix typo\n\nSigned-off-by: Alex Ellis <alex@example.com>")
+	ctx := context.Background()
+	fake.Issues.AddLabelsToIssue(ctx, "alexellis", "derek", 2, []string{"no-dco"})
+
+	result := HandlePullRequest(ctx, newFakeGitHub(fake), req, "", config.Config{})
+	if result.Failed() {
+		t.Fatalf("want no errors, got: %v", result.Errors)
+	}
+
+	if got := fake.Labels("alexellis", "derek", 2); len(got) != 0 {
+		t.Errorf("want no-dco label removed, got: %v", got)
+	}
+	if got := fake.Comments("alexellis", "derek", 2); len(got) != 0 {
+		t.Errorf("want no comments, got: %v", got)
+	}
+}
+
+func Test_installationTokens_KeyedByConfig(t *testing.T) {
+	first := config.Config{APIBaseURL: "https://github.example.com/api/v3/", ApplicationID: "1"}
+	if installationTokens(first) != installationTokens(first) {
+		t.Errorf("want the same cache for the same config")
+	}
+
+	reloaded := first
+	reloaded.TokenCachePath = "/tmp/derek-tokens.json"
+	if installationTokens(first) == installationTokens(reloaded) {
+		t.Errorf("want a new cache when the token cache path changes")
+	}
+
+	reloaded = first
+	reloaded.APIBaseURL = "https://api.github.com/"
+	if installationTokens(first) == installationTokens(reloaded) {
+		t.Errorf("want a new cache when the API URL changes")
+	}
+}
@@ -2,16 +2,23 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/queue"
 	"github.com/google/go-github/github"
 )
 
+const releaseRetryMessage = "unable to detect current release, retry webhook after a few seconds"
+
+// releaseRetryAfter gives GitHub time to list a release which was
+// created moments before its webhook was sent
+const releaseRetryAfter = time.Second * 5
+
 type WorkingRelease struct {
 	CurrentTag     string
 	CurrentDate    time.Time
@@ -22,33 +29,33 @@ type WorkingRelease struct {
 }
 
 type ReleaseHandler interface {
-	Handle(github.ReleaseEvent) error
+	Handle(context.Context, github.ReleaseEvent) error
 }
 
 type UpdatingReleaseHandler struct {
-	Config         config.Config
-	InstallationID int
+	Client *GitHub
+
+	// WebURL is the base URL used for the compare link, i.e. https://github.com/
+	WebURL string
 }
 
-func NewReleaseHandler(config config.Config, installationID int) ReleaseHandler {
+func NewReleaseHandler(client *GitHub, webURL string) ReleaseHandler {
 	return &UpdatingReleaseHandler{
-		InstallationID: installationID,
-		Config:         config,
+		Client: client,
+		WebURL: webURL,
 	}
 }
 
-func (h *UpdatingReleaseHandler) Handle(req github.ReleaseEvent) error {
-	client, _ := makeClient(h.InstallationID, h.Config)
-
-	err := updateReleaseNotes(client, req.Repo.Owner.GetLogin(), req.Repo.GetName(), req.Release.GetTagName())
+func (h *UpdatingReleaseHandler) Handle(ctx context.Context, req github.ReleaseEvent) error {
+	err := updateReleaseNotes(ctx, h.Client, h.WebURL, req.Repo.Owner.GetLogin(), req.Repo.GetName(), req.Release.GetTagName())
 
 	return err
 }
 
-func updateReleaseNotes(client *github.Client, owner, repo, latestTag string) error {
+func updateReleaseNotes(ctx context.Context, client *GitHub, webURL, owner, repo, latestTag string) error {
 
 	listOptions := &github.ListOptions{}
-	releases, _, err := client.Repositories.ListReleases(context.Background(), owner, repo, listOptions)
+	releases, _, err := client.Repositories.ListReleases(ctx, owner, repo, listOptions)
 	if err != nil {
 		return err
 	}
@@ -56,16 +63,15 @@ func updateReleaseNotes(client *github.Client, owner, repo, latestTag string) er
 	workingReleases := getWorkingReleases(releases, owner, repo, latestTag)
 
 	if workingReleases.CurrentRelease == nil {
-		return fmt.Errorf("unable to detect current release, retry webhook after a few seconds")
-
+		return queue.Retryable(errors.New(releaseRetryMessage), releaseRetryAfter)
 	}
 
-	includedPRs, err := buildClosedPRs(client, workingReleases, owner, repo, latestTag)
+	includedPRs, err := buildClosedPRs(ctx, client, workingReleases, owner, repo, latestTag)
 	if err != nil {
 		return err
 	}
 
-	includedCommits, err := buildCommits(client, workingReleases, owner, repo, latestTag)
+	includedCommits, err := buildCommits(ctx, client, workingReleases, owner, repo, latestTag)
 	if err != nil {
 		return err
 	}
@@ -102,20 +108,20 @@ func updateReleaseNotes(client *github.Client, owner, repo, latestTag string) er
 
 	var releaseDiff string
 	if workingReleases.PreviousTag != "" {
-		releaseDiff = fmt.Sprintf("Changes: https://github.com/%s/%s/compare/%s...%s", owner, repo, workingReleases.PreviousTag, workingReleases.CurrentTag)
+		releaseDiff = fmt.Sprintf("Changes: %s%s/%s/compare/%s...%s", webURL, owner, repo, workingReleases.PreviousTag, workingReleases.CurrentTag)
 	} else {
-		releaseDiff = fmt.Sprintf("Changes: https://github.com/%s/%s/commits/%s", owner, repo, workingReleases.CurrentTag)
+		releaseDiff = fmt.Sprintf("Changes: %s%s/%s/commits/%s", webURL, owner, repo, workingReleases.CurrentTag)
 	}
 	output = fmt.Sprintf("%s\n%s\n\nGenerated by [Derek](https://github.com/alexellis/derek/)\n", output, releaseDiff)
 
-	log.Printf("Release notes: %q", output)
+	logging.FromContext(ctx).WithField("release", workingReleases.CurrentTag).Debugf("Release notes: %q", output)
 
-	err = updateRelease(client, workingReleases.CurrentRelease, owner, repo, workingReleases.CurrentTag, output)
+	err = updateRelease(ctx, client, workingReleases.CurrentRelease, owner, repo, workingReleases.CurrentTag, output)
 
 	return err
 }
 
-func buildCommits(client *github.Client, workingReleases WorkingRelease, owner, repo, latestTag string) ([]github.RepositoryCommit, error) {
+func buildCommits(ctx context.Context, client *GitHub, workingReleases WorkingRelease, owner, repo, latestTag string) ([]github.RepositoryCommit, error) {
 	var err error
 	var commits []github.RepositoryCommit
 
@@ -124,7 +130,7 @@ func buildCommits(client *github.Client, workingReleases WorkingRelease, owner,
 		Until: workingReleases.CurrentDate,
 	}
 
-	res, _, err := client.Repositories.ListCommits(context.Background(), owner, repo, &opts)
+	res, _, err := client.Repositories.ListCommits(ctx, owner, repo, &opts)
 
 	for _, c := range res {
 		if includeCommit(*c, workingReleases.PreviousDate, workingReleases.CurrentDate) {
@@ -139,7 +145,7 @@ func buildCommits(client *github.Client, workingReleases WorkingRelease, owner,
 	return commits, err
 }
 
-func buildClosedPRs(client *github.Client, workingReleases WorkingRelease, owner, repo, latestTag string) ([]github.PullRequest, error) {
+func buildClosedPRs(ctx context.Context, client *GitHub, workingReleases WorkingRelease, owner, repo, latestTag string) ([]github.PullRequest, error) {
 	opts := &github.PullRequestListOptions{
 		State:     "closed",
 		Base:      "master",
@@ -147,13 +153,13 @@ func buildClosedPRs(client *github.Client, workingReleases WorkingRelease, owner
 		Direction: "desc",
 	}
 
-	prs, _, err := client.PullRequests.List(context.Background(), owner, repo, opts)
+	prs, _, err := client.PullRequests.List(ctx, owner, repo, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Release [%s/%s:%s] start: %s\tend: %q\n",
-		owner, repo, latestTag, workingReleases.CurrentDate.String(), workingReleases.PreviousDate.String())
+	logging.FromContext(ctx).WithField("release", latestTag).Infof("Release start: %s, end: %s",
+		workingReleases.CurrentDate.String(), workingReleases.PreviousDate.String())
 
 	included := []github.PullRequest{}
 	for _, pr := range prs {
@@ -205,10 +211,10 @@ func includePR(pr github.PullRequest, previous, current time.Time) bool {
 		merged
 }
 
-func updateRelease(client *github.Client, release *github.RepositoryRelease, owner, repo, tag, body string) error {
+func updateRelease(ctx context.Context, client *GitHub, release *github.RepositoryRelease, owner, repo, tag, body string) error {
 	release.Body = &body
 
-	_, _, err := client.Repositories.EditRelease(context.Background(), owner, repo, *release.ID, release)
+	_, _, err := client.Repositories.EditRelease(ctx, owner, repo, *release.ID, release)
 	return err
 }
 
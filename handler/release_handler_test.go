@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/alexellis/derek/queue"
 	"github.com/google/go-github/github"
 )
 
@@ -203,3 +207,62 @@ func Test_includeCommit_WithinCurrentRange(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_updateReleaseNotes(t *testing.T) {
+	now := time.Now()
+	previous := github.Timestamp{Time: now.Add(-48 * time.Hour)}
+	current := github.Timestamp{Time: now}
+	mergedAt := now.Add(-24 * time.Hour)
+	committedAt := now.Add(-25 * time.Hour)
+
+	fake := fakegithub.New()
+	fake.Update("alexellis", "derek", func(r *fakegithub.Repo) {
+		r.Releases = []*github.RepositoryRelease{
+			{ID: github.Int64(1), TagName: github.String("0.1.0"), CreatedAt: &previous},
+			{ID: github.Int64(2), TagName: github.String("0.2.0"), CreatedAt: &current},
+		}
+		r.PullRequests[10] = &github.PullRequest{
+			Number:   github.Int(10),
+			Title:    github.String("Add dry-run"),
+			State:    github.String("closed"),
+			User:     &github.User{Login: github.String("rgee0")},
+			ClosedAt: &mergedAt,
+			MergedAt: &mergedAt,
+		}
+		r.Commits = []*github.RepositoryCommit{{
+			SHA:    github.String("abc123"),
+			Author: &github.User{Login: github.String("rgee0")},
+			Commit: &github.Commit{
+				Message:   github.String("Add dry-run\n\nSigned-off-by: rgee0"),
+				Committer: &github.CommitAuthor{Date: &committedAt},
+			},
+		}}
+	})
+
+	err := updateReleaseNotes(context.Background(), newFakeGitHub(fake), "https://github.example.com/", "alexellis", "derek", "0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fake.Release("alexellis", "derek", "0.2.0").GetBody()
+	for _, want := range []string{
+		"Changelog for 0.2.0",
+		"* PR #10 Add dry-run by @rgee0",
+		"abc123 Add dry-run by @rgee0",
+		"https://github.example.com/alexellis/derek/compare/0.1.0...0.2.0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want release notes to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func Test_updateReleaseNotes_UnknownRelease(t *testing.T) {
+	err := updateReleaseNotes(context.Background(), newFakeGitHub(fakegithub.New()), "https://github.com/", "alexellis", "derek", "0.3.0")
+	if err == nil || err.Error() != releaseRetryMessage {
+		t.Errorf("want error: %q, got: %v", releaseRetryMessage, err)
+	}
+	if !queue.IsRetryable(err) {
+		t.Errorf("want a retryable error, since the release may not be listed yet")
+	}
+}
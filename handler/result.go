@@ -0,0 +1,227 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Result records what a single feature did whilst handling an event:
+// the actions it took, the actions it decided against and any errors.
+type Result struct {
+	Feature string
+	Actions []string
+	Skipped []string
+	Errors  []error
+
+	// Stop prevents any later features from handling the event,
+	// i.e. after a PR has been closed as spam
+	Stop bool
+}
+
+// NewResult creates an empty Result for the named feature
+func NewResult(feature string) *Result {
+	return &Result{Feature: feature}
+}
+
+// Action records an action taken against GitHub
+func (r *Result) Action(format string, a ...interface{}) {
+	r.Actions = append(r.Actions, fmt.Sprintf(format, a...))
+}
+
+// Skip records an action which was not needed or not permitted
+func (r *Result) Skip(format string, a ...interface{}) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, a...))
+}
+
+// Fail records an error, the feature may carry on or return early
+func (r *Result) Fail(err error) {
+	if err != nil {
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+// Failed returns true if any error was recorded
+func (r *Result) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// outcome is "failed" when there were errors, "acted" when any action
+// was taken, otherwise "skipped"
+func (r *Result) outcome() string {
+	switch {
+	case r.Failed():
+		return "failed"
+	case len(r.Actions) > 0:
+		return "acted"
+	default:
+		return "skipped"
+	}
+}
+
+// Report aggregates the results of every feature which ran for an event
+type Report struct {
+	Event   string
+	Results []*Result
+
+	// DryRun is set when mutating calls to GitHub were recorded
+	// into Plan rather than sent
+	DryRun bool
+	Plan   []factory.PlannedAction
+
+	// TimedOut is set when the deadline for the event passed, so the
+	// results only cover part of the event. NotRun lists the features
+	// which were due to run after the deadline.
+	TimedOut bool
+	NotRun   []string
+}
+
+// NewReport creates an empty Report for the event type
+func NewReport(event string) *Report {
+	return &Report{Event: event}
+}
+
+// Add appends a feature's result to the report
+func (r *Report) Add(result *Result) {
+	if result != nil {
+		r.Results = append(r.Results, result)
+	}
+}
+
+// Failed returns true if any feature recorded an error
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Err combines the errors from every feature, or returns nil
+// when all features completed successfully.
+func (r *Report) Err() error {
+	var msgs []string
+	for _, result := range r.Results {
+		for _, err := range result.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", result.Feature, err))
+		}
+	}
+	if len(r.NotRun) > 0 {
+		msgs = append(msgs, fmt.Sprintf("deadline exceeded before running: %s", strings.Join(r.NotRun, ", ")))
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d error(s) handling %s event: %s", len(msgs), r.Event, strings.Join(msgs, "; "))
+}
+
+// String gives a one-line summary per feature for the logs
+func (r *Report) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Event: %s, features: %d\n", r.Event, len(r.Results)))
+
+	for _, result := range r.Results {
+		sb.WriteString(fmt.Sprintf("[%s] actions: %d, skipped: %d, errors: %d\n",
+			result.Feature, len(result.Actions), len(result.Skipped), len(result.Errors)))
+	}
+
+	if r.TimedOut {
+		sb.WriteString(fmt.Sprintf("Deadline exceeded, features not run: %d\n", len(r.NotRun)))
+	}
+
+	if r.DryRun {
+		sb.WriteString(fmt.Sprintf("Dry-run, planned actions: %d\n", len(r.Plan)))
+		for _, action := range r.Plan {
+			sb.WriteString(fmt.Sprintf("[plan] %s\n", action))
+		}
+	}
+	return sb.String()
+}
+
+// Log writes a line per feature with its actions, skips and errors,
+// followed by a line per planned action for a dry-run
+func (r *Report) Log(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	for _, result := range r.Results {
+		entry := logger.WithFields(logrus.Fields{
+			logging.FeatureField: result.Feature,
+			"actions":            result.Actions,
+			"skipped":            result.Skipped,
+		})
+
+		if result.Failed() {
+			var errs []string
+			for _, err := range result.Errors {
+				errs = append(errs, err.Error())
+			}
+			entry.WithField("errors", errs).Error("Feature failed")
+			continue
+		}
+		entry.Info("Feature completed")
+	}
+
+	if r.TimedOut {
+		logger.WithField("not_run", r.NotRun).Warn("Deadline exceeded, the event was only partly handled")
+	}
+
+	if r.DryRun {
+		for _, action := range r.Plan {
+			logger.WithField("plan", action.String()).Info("Dry-run, change not sent to GitHub")
+		}
+	}
+}
+
+type resultJSON struct {
+	Feature string   `json:"feature"`
+	Actions []string `json:"actions,omitempty"`
+	Skipped []string `json:"skipped,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Stop    bool     `json:"stop,omitempty"`
+}
+
+// MarshalJSON renders errors as strings, since the error
+// interface has no exported fields to encode.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	out := resultJSON{
+		Feature: r.Feature,
+		Actions: r.Actions,
+		Skipped: r.Skipped,
+		Stop:    r.Stop,
+	}
+	for _, err := range r.Errors {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON adds the aggregate outcome alongside the results
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Event    string                  `json:"event"`
+		Failed   bool                    `json:"failed"`
+		Results  []*Result               `json:"results"`
+		TimedOut bool                    `json:"timed_out,omitempty"`
+		NotRun   []string                `json:"not_run,omitempty"`
+		DryRun   bool                    `json:"dry_run,omitempty"`
+		Plan     []factory.PlannedAction `json:"plan,omitempty"`
+	}{
+		Event:    r.Event,
+		Failed:   r.Failed(),
+		Results:  r.Results,
+		TimedOut: r.TimedOut,
+		NotRun:   r.NotRun,
+		DryRun:   r.DryRun,
+		Plan:     r.Plan,
+	})
+}
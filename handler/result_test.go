@@ -0,0 +1,73 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Report_AggregatesResults(t *testing.T) {
+	report := NewReport("pull_request")
+
+	dco := NewResult(dcoCheckFeature)
+	dco.Fail(fmt.Errorf("unable to add DCO label"))
+	report.Add(dco)
+
+	newbies := NewResult(noNewbiesFeature)
+	newbies.Action("closed PR %d", 1)
+	report.Add(newbies)
+
+	if !report.Failed() {
+		t.Errorf("want report to have failed")
+	}
+
+	err := report.Err()
+	if err == nil {
+		t.Fatalf("want an error")
+	}
+
+	want := "1 error(s) handling pull_request event: dco_check: unable to add DCO label"
+	if err.Error() != want {
+		t.Errorf("want error: %q, got: %q", want, err.Error())
+	}
+}
+
+func Test_Report_NoErrors(t *testing.T) {
+	report := NewReport("issues")
+
+	result := NewResult(requiredInIssuesFeature)
+	result.Skip("issue #%d has all required headings", 1)
+	result.Fail(nil)
+	report.Add(result)
+
+	if report.Failed() {
+		t.Errorf("want report not to have failed")
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("want no error, got: %s", err)
+	}
+}
+
+func Test_Report_MarshalJSON(t *testing.T) {
+	report := NewReport("issue_comment")
+
+	result := NewResult(commentsFeature)
+	result.Action("Request to close issue #1 by alexellis was successful.")
+	result.Fail(fmt.Errorf("rate limited"))
+	report.Add(result)
+
+	out, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"failed":true`, `"feature":"comments"`, `"errors":["rate limited"]`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("want %s in %s", want, string(out))
+		}
+	}
+}
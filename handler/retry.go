@@ -0,0 +1,83 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/queue"
+	"github.com/google/go-github/github"
+)
+
+// RunOrQueue makes a call to GitHub, when the call fails with a transient
+// error and ctx carries a queue then it is retried in the background and
+// queued is true. Any other error is returned.
+func RunOrQueue(ctx context.Context, name string, run func(ctx context.Context) error) (queued bool, err error) {
+	err = transientError(run(ctx))
+	if err == nil {
+		return false, nil
+	}
+
+	q := queue.FromContext(ctx)
+	if q == nil || !queue.IsRetryable(err) {
+		return false, err
+	}
+
+	q.Retry(ctx, name, err, func(ctx context.Context) error {
+		return transientError(run(ctx))
+	})
+	return true, nil
+}
+
+// transientError marks errors from GitHub which are worth retrying:
+// rate limits, server errors and network timeouts
+func transientError(err error) error {
+	if err == nil || queue.IsRetryable(err) {
+		return err
+	}
+
+	var budgetErr *factory.RateLimitExceededError
+	if errors.As(err, &budgetErr) {
+		return queue.Retryable(err, budgetErr.Wait)
+	}
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return queue.Retryable(err, time.Until(rateErr.Rate.Reset.Time))
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		var after time.Duration
+		if abuseErr.RetryAfter != nil {
+			after = *abuseErr.RetryAfter
+		}
+		return queue.Retryable(err, after)
+	}
+
+	var resErr *github.ErrorResponse
+	if errors.As(err, &resErr) && resErr.Response != nil {
+		if resErr.Response.StatusCode >= http.StatusInternalServerError {
+			return queue.Retryable(err, 0)
+		}
+		return err
+	}
+
+	// The deadline for the event has passed, which the report records
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return queue.Retryable(err, 0)
+	}
+
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/alexellis/derek/queue"
+	"github.com/google/go-github/github"
+)
+
+func newErrorResponse(status int) *github.ErrorResponse {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/alexellis/derek/issues/1/labels", nil)
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: status, Request: req}}
+}
+
+func Test_transientError(t *testing.T) {
+	serverErr := newErrorResponse(http.StatusBadGateway)
+	notFound := newErrorResponse(http.StatusNotFound)
+
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "server error", err: serverErr, retryable: true},
+		{name: "wrapped server error", err: fmt.Errorf("unable to add label: %w", serverErr), retryable: true},
+		{name: "not found", err: notFound, retryable: false},
+		{name: "rate limit budget", err: &factory.RateLimitExceededError{Wait: time.Minute}, retryable: true},
+		{name: "other error", err: errors.New("cannot parse payload"), retryable: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := queue.IsRetryable(transientError(c.err)); got != c.retryable {
+				t.Errorf("want retryable: %t, got: %t", c.retryable, got)
+			}
+		})
+	}
+}
+
+func Test_RunOrQueue(t *testing.T) {
+	serverErr := newErrorResponse(http.StatusBadGateway)
+
+	t.Run("without a queue the error is returned", func(t *testing.T) {
+		queued, err := RunOrQueue(context.Background(), "add label", func(ctx context.Context) error {
+			return serverErr
+		})
+		if queued || err == nil {
+			t.Errorf("want an error and nothing queued, got queued: %t, error: %v", queued, err)
+		}
+	})
+
+	t.Run("transient errors are queued", func(t *testing.T) {
+		q := queue.New(queue.Options{MaxAttempts: 2, BaseDelay: time.Millisecond})
+		ctx := queue.WithQueue(context.Background(), q)
+
+		calls := 0
+		queued, err := RunOrQueue(ctx, "add label", func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return serverErr
+			}
+			return nil
+		})
+		if err != nil || !queued {
+			t.Fatalf("want queued without an error, got queued: %t, error: %v", queued, err)
+		}
+
+		q.Drain(context.Background())
+		if calls != 2 {
+			t.Errorf("want 2 calls, got: %d", calls)
+		}
+	})
+
+	t.Run("permanent errors are returned", func(t *testing.T) {
+		ctx := queue.WithQueue(context.Background(), queue.New(queue.Options{}))
+
+		queued, err := RunOrQueue(ctx, "add label", func(ctx context.Context) error {
+			return errors.New("label does not exist")
+		})
+		if queued || err == nil {
+			t.Errorf("want an error and nothing queued, got queued: %t, error: %v", queued, err)
+		}
+	})
+}
+
+// flakyIssues fails the first calls which add labels or comments with a 502
+type flakyIssues struct {
+	IssuesService
+	failures int
+}
+
+func (f *flakyIssues) fail() error {
+	if f.failures == 0 {
+		return nil
+	}
+	f.failures--
+	return newErrorResponse(http.StatusBadGateway)
+}
+
+func (f *flakyIssues) AddLabelsToIssue(ctx context.Context, owner, repo string, number int, labels []string) ([]*github.Label, *github.Response, error) {
+	if err := f.fail(); err != nil {
+		return nil, nil, err
+	}
+	return f.IssuesService.AddLabelsToIssue(ctx, owner, repo, number, labels)
+}
+
+func (f *flakyIssues) CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	if err := f.fail(); err != nil {
+		return nil, nil, err
+	}
+	return f.IssuesService.CreateComment(ctx, owner, repo, number, comment)
+}
+
+func Test_VerifyPullRequestDescription_QueuesTransientFailures(t *testing.T) {
+	fake := fakegithub.New()
+	req := newPullRequest(fake, 1, "Fix typo")
+	req.Action = openedPRAction
+
+	client := newFakeGitHub(fake)
+	client.Issues = &flakyIssues{IssuesService: fake.Issues, failures: 2}
+
+	q := queue.New(queue.Options{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	ctx := queue.WithQueue(context.Background(), q)
+
+	result := VerifyPullRequestDescription(ctx, client, req, "https://example.com/CONTRIBUTING.md")
+	if result.Failed() {
+		t.Fatalf("want the failures queued, got: %v", result.Errors)
+	}
+	if len(result.Skipped) != 2 {
+		t.Errorf("want the label and comment queued, got: %v", result.Skipped)
+	}
+
+	q.Drain(context.Background())
+
+	if want, got := []string{prDescriptionRequiredLabel}, fake.Labels("alexellis", "derek", 1); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+	if got := fake.Comments("alexellis", "derek", 1); len(got) != 1 {
+		t.Errorf("want a comment, got: %d", len(got))
+	}
+}
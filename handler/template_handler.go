@@ -1,15 +1,18 @@
 package handler
 
 import (
-	"log"
+	"context"
 	"strings"
 
-	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/logging"
 	"github.com/alexellis/derek/types"
 	"github.com/google/go-github/github"
 )
 
-func CheckIssueTemplateHeadings(req types.IssuesOuter, derekConfig *types.DerekRepoConfig, config config.Config) error {
+// CheckIssueTemplateHeadings labels and comments on issues from non-maintainers
+// which are missing any of the headings listed in `required_in_issues`
+func CheckIssueTemplateHeadings(ctx context.Context, client *GitHub, req types.IssuesOuter, derekConfig *types.DerekRepoConfig) *Result {
+	result := NewResult(requiredInIssuesFeature)
 
 	maintainer := false
 	for _, u := range derekConfig.Maintainers {
@@ -19,7 +22,8 @@ func CheckIssueTemplateHeadings(req types.IssuesOuter, derekConfig *types.DerekR
 		}
 	}
 	if maintainer {
-		return nil
+		result.Skip("issue #%d was opened by a maintainer", req.Issue.Number)
+		return result
 	}
 
 	body := req.Issue.Body
@@ -31,25 +35,30 @@ func CheckIssueTemplateHeadings(req types.IssuesOuter, derekConfig *types.DerekR
 		}
 	}
 
-	client, ctx := makeClient(req.Installation.ID, config)
+	if found == len(derekConfig.RequiredInIssues) {
+		result.Skip("issue #%d has all required headings", req.Issue.Number)
+		return result
+	}
 
-	if found != len(derekConfig.RequiredInIssues) {
-		log.Printf("Issue headings found: %d, wanted: %d", found, len(derekConfig.RequiredInIssues))
-		if _, _, err := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, []string{"invalid"}); err != nil {
-			return err
-		}
+	logging.FromContext(ctx).Infof("Issue headings found: %d, wanted: %d", found, len(derekConfig.RequiredInIssues))
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, []string{"invalid"}); err != nil {
+		result.Fail(err)
+		return result
+	}
+	result.Action("added invalid label to issue #%d", req.Issue.Number)
 
-		messageValue, err := createIssueComment(derekConfig.Messages, "template")
-		if err != nil {
-			msg := "Please complete the whole issue template, without deleting any headings."
-			messageValue = &github.IssueComment{
-				Body: &msg,
-			}
-		}
-		if _, _, err = client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, messageValue); err != nil {
-			return err
+	messageValue, err := createIssueComment(derekConfig.Messages, "template")
+	if err != nil {
+		msg := "Please complete the whole issue template, without deleting any headings."
+		messageValue = &github.IssueComment{
+			Body: &msg,
 		}
 	}
+	if _, _, err = client.Issues.CreateComment(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Issue.Number, messageValue); err != nil {
+		result.Fail(err)
+		return result
+	}
+	result.Action("commented on issue #%d", req.Issue.Number)
 
-	return nil
+	return result
 }
@@ -0,0 +1,82 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package logging gives Derek's structured logger. Fields which describe
+// the webhook being handled are carried in a context, so every line logged
+// whilst handling it can be filtered by delivery, repository or PR.
+package logging
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the fields added to log lines
+const (
+	DeliveryField     = "delivery"
+	EventField        = "event"
+	ActionField       = "action"
+	OwnerField        = "owner"
+	RepoField         = "repo"
+	NumberField       = "number"
+	InstallationField = "installation"
+	FeatureField      = "feature"
+)
+
+// Logger writes every log line, it is set up from the environment
+// by Configure
+var Logger = logrus.New()
+
+type contextKey struct{}
+
+// Configure reads log_format, where "json" gives one JSON object per
+// line, and log_level, i.e. "debug", from the environment
+func Configure() {
+	if strings.EqualFold(os.Getenv("log_format"), "json") {
+		Logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		Logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	if val, ok := os.LookupEnv("log_level"); ok && len(val) > 0 {
+		if level, err := logrus.ParseLevel(val); err == nil {
+			Logger.SetLevel(level)
+		} else {
+			Logger.Warnf("Invalid log_level: %q, using: %s", val, Logger.GetLevel())
+		}
+	}
+}
+
+// FromContext gives the entry stored in ctx, or one without any fields
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(Logger)
+}
+
+// WithFields adds fields to the entry in ctx, fields with empty
+// or zero values are left out
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	set := logrus.Fields{}
+	for k, v := range fields {
+		switch val := v.(type) {
+		case string:
+			if len(val) == 0 {
+				continue
+			}
+		case int:
+			if val == 0 {
+				continue
+			}
+		}
+		set[k] = v
+	}
+
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).WithFields(set))
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_WithFields_JSON(t *testing.T) {
+	os.Setenv("log_format", "json")
+	defer os.Unsetenv("log_format")
+
+	var out bytes.Buffer
+	Logger.SetOutput(&out)
+	defer Logger.SetOutput(os.Stderr)
+
+	Configure()
+	defer Logger.SetFormatter(new(logrus.TextFormatter))
+
+	ctx := WithFields(context.Background(), logrus.Fields{
+		DeliveryField: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		EventField:    "pull_request",
+		NumberField:   0,
+	})
+	ctx = WithFields(ctx, logrus.Fields{
+		OwnerField:  "alexellis",
+		RepoField:   "derek",
+		NumberField: 42,
+		ActionField: "",
+	})
+
+	FromContext(ctx).Info("Handling event")
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("want a JSON line, got: %q, error: %s", out.String(), err)
+	}
+
+	want := map[string]interface{}{
+		DeliveryField: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		EventField:    "pull_request",
+		OwnerField:    "alexellis",
+		RepoField:     "derek",
+		NumberField:   float64(42),
+		"msg":         "Handling event",
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("want %s: %v, got: %v", k, v, line[k])
+		}
+	}
+	if _, ok := line[ActionField]; ok {
+		t.Errorf("want empty %s left out, got: %v", ActionField, line[ActionField])
+	}
+}
+
+func Test_FromContext_WithoutFields(t *testing.T) {
+	if entry := FromContext(context.Background()); len(entry.Data) != 0 {
+		t.Errorf("want no fields, got: %v", entry.Data)
+	}
+}
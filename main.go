@@ -4,46 +4,63 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
-
 	"github.com/alexellis/derek/auth"
 	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/delivery"
+	"github.com/alexellis/derek/factory"
 
 	"github.com/alexellis/derek/handler"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/queue"
 
 	"github.com/alexellis/derek/types"
 	"github.com/alexellis/hmac/v2"
-)
-
-const (
-	dcoCheck              = "dco_check"
-	comments              = "comments"
-	deleted               = "deleted"
-	prDescriptionRequired = "pr_description_required"
-	hacktoberfest         = "hacktoberfest"
-	noNewbies             = "no_newbies"
-	releaseNotes          = "release_notes"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	logging.Configure()
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := serve(); err != nil {
+			os.Stderr.Write([]byte(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := replay(os.Args[2:], os.Stdout); err != nil {
+			os.Stderr.Write([]byte(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := configCommand(os.Args[2:], os.Stdout); err != nil {
+			os.Stderr.Write([]byte(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	validateHmac := hmacValidation()
 
 	requestRaw, _ := ioutil.ReadAll(os.Stdin)
 
 	xHubSignature256 := os.Getenv("Http_X_Hub_Signature_256")
-
-	if validateHmac && len(xHubSignature256) == 0 {
-		os.Stderr.Write([]byte("must provide X_Hub_Signature_256"))
-		os.Exit(1)
-	}
+	xHubSignature := os.Getenv("Http_X_Hub_Signature")
 
 	config, configErr := config.NewConfig()
 	if configErr != nil {
@@ -51,219 +68,346 @@ func main() {
 		os.Exit(1)
 	}
 
+	deliveryID := os.Getenv("Http_X_Github_Delivery")
+	eventType := os.Getenv("Http_X_Github_Event")
+
+	ctx := logging.WithFields(context.Background(), logrus.Fields{
+		logging.DeliveryField: deliveryID,
+		logging.EventField:    eventType,
+	})
+
 	if validateHmac {
-		err := hmac.Validate(requestRaw, xHubSignature256, config.SecretKey)
-		if err != nil {
+		if err := validateSignature(ctx, requestRaw, xHubSignature256, xHubSignature, config); err != nil {
 			os.Stderr.Write([]byte(err.Error()))
 			os.Exit(1)
 		}
 	}
 
-	eventType := os.Getenv("Http_X_Github_Event")
+	// Each webhook is a new process, so duplicates can only be
+	// found when the deliveries are recorded on disk
+	deliveries, storeErr := newDeliveryStore(config, nil)
+	if storeErr != nil {
+		logging.FromContext(ctx).Errorf("Unable to open delivery store: %s", storeErr)
+	}
 
-	if err := handleEvent(eventType, requestRaw, config); err != nil {
+	if err := checkDelivery(ctx, deliveries, deliveryID, requestRaw, config); err == errDuplicateDelivery {
+		logging.FromContext(ctx).Info("Skipping delivery, it has already been processed")
+		return
+	} else if err != nil {
 		os.Stderr.Write([]byte(err.Error()))
 		os.Exit(1)
 	}
+
+	// The process exits once the response is written, so any retries
+	// are run before then, within the event's deadline
+	retries := newQueue(config)
+	ctx = queue.WithQueue(ctx, retries)
+	drainCtx, cancel := drainContext(ctx, config)
+	defer cancel()
+
+	report, err := handleEvent(ctx, eventType, requestRaw, config)
+	report.Log(ctx)
+	if drainErr := retries.Drain(drainCtx); drainErr != nil {
+		logging.FromContext(ctx).Warnf("Retries still queued at the event's deadline were dead-lettered: %s", drainErr)
+	}
+
+	if err != nil {
+		forgetDelivery(ctx, deliveries, deliveryID)
+		os.Stderr.Write([]byte(err.Error()))
+		os.Exit(1)
+	}
+
+	if report.TimedOut || report.Failed() {
+		forgetDelivery(ctx, deliveries, deliveryID)
+	}
+
+	if reportErr := report.Err(); reportErr != nil {
+		os.Stderr.Write([]byte(reportErr.Error()))
+		os.Exit(1)
+	}
+}
+
+// drainContext bounds how long retries are waited for to the event's
+// deadline, which starts when the webhook is received
+func drainContext(ctx context.Context, config config.Config) (context.Context, context.CancelFunc) {
+	if config.EventTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.EventTimeout)
 }
 
-func handleEvent(eventType string, bytesIn []byte, config config.Config) error {
+// handleEvent runs each enabled feature for the event and returns a report of their
+// results. An error is only returned when the event cannot be handled at all, a
+// feature which fails does not prevent the remaining features from running.
+func handleEvent(ctx context.Context, eventType string, bytesIn []byte, config config.Config) (*handler.Report, error) {
+	return newEventHandler(config).handle(ctx, eventType, bytesIn)
+}
+
+// eventHandler holds what handleEvent needs from outside of the payload, so
+// that replay can swap the customer check, .DEREK.yml and GitHub client.
+type eventHandler struct {
+	config config.Config
+
+	isCustomer func(ctx context.Context, owner string) (bool, error)
+	repoConfig func(ctx context.Context, req types.EventOuter, config config.Config) (*types.DerekRepoConfig, error)
+
+	// client makes the GitHub client shared by the features, when nil
+	// a client is made for the event's installation
+	client func(ctx context.Context) (*handler.GitHub, error)
+}
+
+func newEventHandler(config config.Config) *eventHandler {
+	return &eventHandler{
+		config: config,
+		isCustomer: func(ctx context.Context, owner string) (bool, error) {
+			return auth.IsCustomer(ctx, owner, &http.Client{})
+		},
+		repoConfig: fetchRepoConfig,
+	}
+}
+
+// fetchRepoConfig downloads .DEREK.yml from the repository's default branch
+func fetchRepoConfig(ctx context.Context, req types.EventOuter, config config.Config) (*types.DerekRepoConfig, error) {
+	if req.Repository.Private {
+		return handler.GetPrivateRepoConfig(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch, req.Installation.ID, config)
+	}
+	return handler.GetRepoConfig(ctx, req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch, config)
+}
+
+func (h *eventHandler) handle(ctx context.Context, eventType string, bytesIn []byte) (*handler.Report, error) {
+	config := h.config
+	report := handler.NewReport(eventType)
+
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.EventField: eventType})
 
-	switch eventType {
-	case "pull_request":
-		req := types.PullRequestOuter{}
+	// Pushes are only used to keep Derek's copy of .DEREK.yml up to date
+	if eventType == "push" {
+		req := types.PushOuter{}
 		if err := json.Unmarshal(bytesIn, &req); err != nil {
-			return fmt.Errorf("Cannot parse input %s", err.Error())
+			return report, fmt.Errorf("Cannot parse input %s", err.Error())
 		}
 
-		customer, err := auth.IsCustomer(req.Repository.Owner.Login, &http.Client{})
-		if err != nil {
-			return fmt.Errorf("Unable to verify customer: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
-		} else if !customer {
-			return fmt.Errorf("No customer found for: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
+		if handler.HandlePush(req) {
+			logging.FromContext(ctx).WithFields(logrus.Fields{
+				logging.OwnerField: req.Repository.Owner.Login,
+				logging.RepoField:  req.Repository.Name,
+			}).Info("Invalidated cached .DEREK.yml")
 		}
+		return report, nil
+	}
 
-		log.Printf("Owner: %s, repo: %s, action: %s", req.Repository.Owner.Login, req.Repository.Name, "pull_request")
+	if !handler.DefaultRegistry.Handles(eventType) {
+		return report, fmt.Errorf("X_Github_Event want: %q, got: %s", append(handler.DefaultRegistry.Events(), "push"), eventType)
+	}
 
-		var derekConfig *types.DerekRepoConfig
-		if req.Repository.Private {
-			derekConfig, err = handler.GetPrivateRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch, req.Installation.ID, config)
-		} else {
-			derekConfig, err = handler.GetRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch)
-		}
+	req := types.EventOuter{}
+	if err := json.Unmarshal(bytesIn, &req); err != nil {
+		return report, fmt.Errorf("Cannot parse input %s", err.Error())
+	}
 
-		if err != nil {
-			return fmt.Errorf("Unable to access maintainers file at: %s/%s\nError: %s",
-				req.Repository.Owner.Login,
-				req.Repository.Name,
-				err.Error())
-		}
+	if len(handler.DefaultRegistry.Subscribed(eventType, req.Action)) == 0 {
+		return report, nil
+	}
+
+	ctx = logging.WithFields(ctx, logrus.Fields{
+		logging.ActionField:       req.Action,
+		logging.OwnerField:        req.Repository.Owner.Login,
+		logging.RepoField:         req.Repository.Name,
+		logging.NumberField:       eventNumber(bytesIn),
+		logging.InstallationField: req.Installation.ID,
+	})
+	logging.FromContext(ctx).Info("Handling event")
+
+	// Token minting, config and customer lookups and every call made by
+	// the features share the deadline, so the webhook is answered in time
+	if config.EventTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.EventTimeout)
+		defer cancel()
+	}
 
-		if req.Action != handler.ClosedConstant && req.PullRequest.State != handler.ClosedConstant {
-			contributingURL := getContributingURL(derekConfig.ContributingURL, req.Repository.Owner.Login, req.Repository.Name)
+	customer, err := h.isCustomer(ctx, req.Repository.Owner.Login)
+	if err != nil {
+		return report, fmt.Errorf("Unable to verify customer: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
+	} else if !customer {
+		return report, fmt.Errorf("No customer found for: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
+	}
 
-			if handler.EnabledFeature(dcoCheck, derekConfig) {
-				log.Printf("Owner: %s, repo: %s, action: %s", req.Repository.Owner.Login, req.Repository.Name, "derek:dco_check")
+	// Features which check a PR adding or fixing .DEREK.yml still run when
+	// it cannot be loaded, the error is returned once they have finished
+	derekConfig, configErr := h.repoConfig(ctx, req, config)
+	if configErr != nil {
+		derekConfig = &types.DerekRepoConfig{}
+	}
 
-				handler.HandlePullRequest(req, contributingURL, config)
-			}
+	event := &handler.Event{
+		Type:            eventType,
+		Action:          req.Action,
+		Payload:         bytesIn,
+		Repository:      req.Repository,
+		InstallationID:  req.Installation.ID,
+		DerekConfig:     derekConfig,
+		ConfigErr:       configErr,
+		Config:          config,
+		ContributingURL: getContributingURL(config.WebURL(), derekConfig.ContributingURL, req.Repository.Owner.Login, req.Repository.Name),
+	}
 
-			if handler.EnabledFeature(prDescriptionRequired, derekConfig) {
-				handler.VerifyPullRequestDescription(req, contributingURL, config)
-			}
+	var plan *factory.Plan
+	if config.DryRun || derekConfig.IsDryRun() {
+		plan = factory.NewPlan()
+		ctx = factory.WithPlan(ctx, plan)
 
-			if handler.EnabledFeature(noNewbies, derekConfig) {
-				isSpamPR, _ := handler.HandleFirstTimerPR(req, contributingURL, config)
-				if isSpamPR {
-					return nil
-				}
-			}
+		// Retries would run after the plan has been reported
+		ctx = queue.WithQueue(ctx, nil)
+	}
 
-			if handler.EnabledFeature(hacktoberfest, derekConfig) {
-				isSpamPR, _ := handler.HandleHacktoberfestPR(req, contributingURL, config)
-				if isSpamPR {
-					return nil
-				}
-			}
+	if h.client != nil {
+		if event.GitHub, err = h.client(ctx); err != nil {
+			return report, err
 		}
-		break
+	}
 
-	case "issues":
+	handler.DefaultRegistry.Handle(ctx, event, report)
 
-		req := types.IssuesOuter{}
-		if err := json.Unmarshal(bytesIn, &req); err != nil {
-			return fmt.Errorf("Cannot parse input %s", err.Error())
-		}
+	if plan != nil {
+		report.DryRun = true
+		report.Plan = plan.Actions()
+	}
 
-		if req.Action == "opened" {
-			log.Printf("Owner: %s, repo: %s, action: %s", req.Repository.Owner.Login, req.Repository.Name, "issues")
-
-			customer, err := auth.IsCustomer(req.Repository.Owner.Login, &http.Client{})
-			if err != nil {
-				return fmt.Errorf("Unable to verify customer: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
-			} else if !customer {
-				return fmt.Errorf("No customer found for: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
-			}
-
-			var derekConfig *types.DerekRepoConfig
-			if req.Repository.Private {
-				derekConfig, err = handler.GetPrivateRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch, req.Installation.ID, config)
-			} else {
-				derekConfig, err = handler.GetRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch)
-			}
-			if err != nil {
-				return fmt.Errorf("Unable to access maintainers file at: %s/%s\nError: %s",
-					req.Repository.Owner.Login,
-					req.Repository.Name,
-					err.Error())
-			}
-
-			if len(derekConfig.RequiredInIssues) > 0 {
-				err := handler.CheckIssueTemplateHeadings(req, derekConfig, config)
-				if err != nil {
-					return err
-				}
-			}
-		}
+	if configErr != nil {
+		return report, fmt.Errorf("Unable to access maintainers file at: %s/%s\nError: %s",
+			req.Repository.Owner.Login,
+			req.Repository.Name,
+			configErr.Error())
+	}
 
-	case "issue_comment":
-		req := types.IssueCommentOuter{}
-		if err := json.Unmarshal(bytesIn, &req); err != nil {
-			return fmt.Errorf("Cannot parse input %s", err.Error())
-		}
+	return report, nil
+}
 
-		log.Printf("Owner: %s, repo: %s, action: %s", req.Repository.Owner.Login, req.Repository.Name, "issue_comment")
+// newQueue creates the queue which retries calls to GitHub that failed
+// with a transient error
+func newQueue(config config.Config) *queue.Queue {
+	opts := queue.Options{MaxAttempts: config.RetryMaxAttempts}
+	if len(config.DeadLetterPath) > 0 {
+		opts.DeadLetter = queue.NewDeadLetterFile(config.DeadLetterPath)
+	}
+	return queue.New(opts)
+}
 
-		customer, err := auth.IsCustomer(req.Repository.Owner.Login, &http.Client{})
-		if err != nil {
-			return fmt.Errorf("Unable to verify customer: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
-		} else if !customer {
-			return fmt.Errorf("No customer found for: %s/%s", req.Repository.Owner.Login, req.Repository.Name)
+// eventNumber gives the issue or pull request number from a payload, or 0
+func eventNumber(bytesIn []byte) int {
+	numbers := struct {
+		Number int `json:"number"`
+		Issue  struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+	}{}
+	json.Unmarshal(bytesIn, &numbers)
+
+	for _, n := range []int{numbers.Number, numbers.PullRequest.Number, numbers.Issue.Number} {
+		if n > 0 {
+			return n
 		}
+	}
+	return 0
+}
 
-		var derekConfig *types.DerekRepoConfig
-		if req.Repository.Private {
-			derekConfig, err = handler.GetPrivateRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch, req.Installation.ID, config)
-		} else {
-			derekConfig, err = handler.GetRepoConfig(req.Repository.Owner.Login, req.Repository.Name, req.Repository.DefaultBranch)
-		}
+// getContributingURL defaults to CONTRIBUTING.md on master under webURL
+func getContributingURL(webURL, contributingURL, owner, repositoryName string) string {
+	if len(contributingURL) == 0 {
+		contributingURL = fmt.Sprintf("%s%s/%s/blob/master/CONTRIBUTING.md", webURL, owner, repositoryName)
+	}
+	return contributingURL
+}
 
-		if err != nil {
-			return fmt.Errorf("Unable to access maintainers file at: %s/%s\nError: %s",
-				req.Repository.Owner.Login,
-				req.Repository.Name,
-				err.Error())
-		}
+// validateSignature checks the X-Hub-Signature-256 header sent by GitHub
+// against each of the webhook secrets. The SHA-1 X-Hub-Signature header is
+// only checked when enabled and there is no X-Hub-Signature-256 header.
+func validateSignature(ctx context.Context, body []byte, xHubSignature256, xHubSignature string, config config.Config) error {
+	signature, prefix := xHubSignature256, "sha256="
+	if len(signature) == 0 && config.LegacySHA1Signatures && len(xHubSignature) > 0 {
+		signature, prefix = xHubSignature, "sha1="
+	}
 
-		if req.Action != deleted {
-			if handler.PermittedUserFeature(comments, derekConfig, req.Comment.User.Login) {
-				log.Printf("Owner: %s, repo: %s, action: %s", req.Repository.Owner.Login, req.Repository.Name, "derek:handle_comment")
+	if len(signature) == 0 {
+		return fmt.Errorf("must provide X_Hub_Signature_256")
+	}
 
-				handler.HandleComment(req, config, derekConfig)
-			}
-		}
+	// hmac.Validate picks the hash from the prefix, so SHA-1 must not
+	// be accepted through the SHA-256 header
+	if !strings.HasPrefix(signature, prefix) {
+		return fmt.Errorf("valid hash prefix: %s, got: %s", prefix, signature)
+	}
 
-	case "release":
-		req := github.ReleaseEvent{}
+	secrets := config.WebhookSecrets()
+	if len(secrets) == 0 {
+		return fmt.Errorf("no webhook secret is configured")
+	}
 
-		if err := json.Unmarshal(bytesIn, &req); err != nil {
-			return fmt.Errorf("Cannot parse input %s", err.Error())
+	for i, secret := range secrets {
+		if hmac.Validate(body, signature, secret) == nil {
+			logging.FromContext(ctx).Infof("Webhook signature (%s) matched secret %d of %d", strings.TrimSuffix(prefix, "="), i+1, len(secrets))
+			return nil
 		}
+	}
 
-		log.Printf("Owner: %s, repo: %s, action: %s", req.Repo.Owner.GetLogin(), req.Repo.GetName(), "release")
-
-		if req.GetAction() == "created" {
-			customer, err := auth.IsCustomer(req.Repo.Owner.GetLogin(), &http.Client{})
-			if err != nil {
-				return fmt.Errorf("unable to verify customer: %s/%s", req.Repo.Owner.GetLogin(), req.Repo.GetName())
-			} else if customer == false {
-				return fmt.Errorf("no customer found for: %s/%s", req.Repo.Owner.GetLogin(), req.Repo.GetName())
-			}
-
-			var derekConfig *types.DerekRepoConfig
-			if req.Repo.GetPrivate() {
-				derekConfig, err = handler.GetPrivateRepoConfig(req.Repo.Owner.GetLogin(), req.Repo.GetName(), req.Repo.GetDefaultBranch(), int(req.Installation.GetID()), config)
-				if err != nil {
-					return fmt.Errorf("unable to get private repo config: %s", err)
-				}
-			} else {
-				derekConfig, err = handler.GetRepoConfig(req.Repo.Owner.GetLogin(), req.Repo.GetName(), req.Repo.GetDefaultBranch())
-				if err != nil {
-					return fmt.Errorf("unable to get repo config: %s", err)
-				}
-			}
-
-			err = fmt.Errorf(`"release_notes" feature not enabled`)
-			if handler.EnabledFeature(releaseNotes, derekConfig) {
-				log.Printf("Owner: %s, repo: %s, action: %s", req.Repo.Owner.GetLogin(), req.Repo.GetName(), "derek:handle_release")
-
-				handler := handler.NewReleaseHandler(config, int(req.Installation.GetID()))
-				err = handler.Handle(req)
-				// retry once - with a 5 second delay
-				if err != nil && err.Error() == "unable to detect current release, retry webhook after a few seconds" {
-					time.Sleep(time.Second * 5)
-					err = handler.Handle(req)
-					if err != nil {
-						err = fmt.Errorf("got an error, then retried after 5 seconds: %w", err)
-					}
-
-				}
-			}
-			return err
+	return fmt.Errorf("invalid message digest or secret")
+}
+
+// errDuplicateDelivery is given for a delivery which was already processed
+var errDuplicateDelivery = errors.New("delivery has already been processed")
+
+// newDeliveryStore gives a directory store when delivery_store_path is
+// set, otherwise fallback which may be nil to disable de-duplication
+func newDeliveryStore(config config.Config, fallback delivery.Store) (delivery.Store, error) {
+	if len(config.DeliveryStorePath) == 0 {
+		return fallback, nil
+	}
+
+	store, err := delivery.NewDirStore(config.DeliveryStorePath, config.DeliveryTTL)
+	if err != nil {
+		return fallback, err
+	}
+	return store, nil
+}
+
+// checkDelivery rejects payloads older than max_payload_age then records
+// the X-GitHub-Delivery ID, errDuplicateDelivery is given when it was
+// already recorded
+func checkDelivery(ctx context.Context, store delivery.Store, deliveryID string, body []byte, config config.Config) error {
+	if config.MaxPayloadAge > 0 {
+		if at, ok := delivery.PayloadTime(body); ok && time.Since(at) > config.MaxPayloadAge {
+			return fmt.Errorf("payload from %s is older than max_payload_age: %s", at.Format(time.RFC3339), config.MaxPayloadAge)
 		}
+	}
 
-	default:
-		return fmt.Errorf("X_Github_Event want: ['pull_request', 'issue_comment', 'release'], got: " + eventType)
+	if store == nil || len(deliveryID) == 0 {
+		return nil
 	}
 
+	first, err := store.Record(deliveryID)
+	if err != nil {
+		// Webhooks are still processed when the store is unavailable
+		logging.FromContext(ctx).Errorf("Unable to record delivery: %s", err)
+		return nil
+	}
+	if !first {
+		return errDuplicateDelivery
+	}
 	return nil
 }
 
-func getContributingURL(contributingURL, owner, repositoryName string) string {
-	if len(contributingURL) == 0 {
-		contributingURL = fmt.Sprintf("https://github.com/%s/%s/blob/master/CONTRIBUTING.md", owner, repositoryName)
+// forgetDelivery lets a redelivery run again when an event could not be handled
+func forgetDelivery(ctx context.Context, store delivery.Store, deliveryID string) {
+	if store == nil || len(deliveryID) == 0 {
+		return
+	}
+	if err := store.Forget(deliveryID); err != nil {
+		logging.FromContext(ctx).Errorf("Unable to forget delivery: %s", err)
 	}
-	return contributingURL
 }
 
 func hmacValidation() bool {
@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/alexellis/derek/handler"
+	"github.com/alexellis/derek/types"
+	"github.com/alexellis/hmac/v2"
+	"github.com/google/go-github/github"
 )
 
 func Test_getContributingURL(t *testing.T) {
 	var TestCases = []struct {
 		Name            string
+		WebURL          string
 		ContributingURL string
 		Owner           string
 		RepositoryName  string
@@ -15,6 +30,7 @@ func Test_getContributingURL(t *testing.T) {
 	}{
 		{
 			Name:            "Empty contributing URL",
+			WebURL:          "https://github.com/",
 			ContributingURL: "",
 			Owner:           "openfaas",
 			RepositoryName:  "faas",
@@ -22,15 +38,24 @@ func Test_getContributingURL(t *testing.T) {
 		},
 		{
 			Name:            "Non empty contributing URL",
+			WebURL:          "https://github.com/",
 			ContributingURL: "https://github.com/openfaas/faas/blob/master/CONTRIBUTING.md",
 			Owner:           "openfaas",
 			RepositoryName:  "faas",
 			ExpectedOuptput: "https://github.com/openfaas/faas/blob/master/CONTRIBUTING.md",
 		},
+		{
+			Name:            "Empty contributing URL on GitHub Enterprise Server",
+			WebURL:          "https://github.example.com/",
+			ContributingURL: "",
+			Owner:           "openfaas",
+			RepositoryName:  "faas",
+			ExpectedOuptput: "https://github.example.com/openfaas/faas/blob/master/CONTRIBUTING.md",
+		},
 	}
 
 	for _, test := range TestCases {
-		actualContrinbutingURL := getContributingURL(test.ContributingURL, test.Owner, test.RepositoryName)
+		actualContrinbutingURL := getContributingURL(test.WebURL, test.ContributingURL, test.Owner, test.RepositoryName)
 		if actualContrinbutingURL != test.ExpectedOuptput {
 			t.Errorf("Testcase %s failed. want - %s, got - %s", test.Name, test.ExpectedOuptput, actualContrinbutingURL)
 		}
@@ -74,3 +99,161 @@ func Test_customerValidation(t *testing.T) {
 		})
 	}
 }
+
+func Test_handleEvent_UnsupportedEvent(t *testing.T) {
+	_, err := handleEvent(context.Background(), "fork", []byte(`{}`), config.Config{})
+	if err == nil {
+		t.Fatalf("want an error for an unsupported event")
+	}
+
+	want := `X_Github_Event want: ["issue_comment" "issues" "pull_request" "release" "push"], got: fork`
+	if err.Error() != want {
+		t.Errorf("want: %q, got: %q", want, err.Error())
+	}
+}
+
+func Test_eventHandler_EventTimeout(t *testing.T) {
+	var deadlines []bool
+	h := &eventHandler{
+		config: config.Config{EventTimeout: time.Second * 5},
+		isCustomer: func(ctx context.Context, owner string) (bool, error) {
+			_, ok := ctx.Deadline()
+			deadlines = append(deadlines, ok)
+			return true, nil
+		},
+		repoConfig: func(ctx context.Context, req types.EventOuter, config config.Config) (*types.DerekRepoConfig, error) {
+			_, ok := ctx.Deadline()
+			deadlines = append(deadlines, ok)
+			return nil, fmt.Errorf("not found")
+		},
+	}
+
+	payload := `{"action": "created", "repository": {"name": "derek", "owner": {"login": "alexellis"}}}`
+	if _, err := h.handle(context.Background(), "issue_comment", []byte(payload)); err == nil {
+		t.Fatalf("want the error from fetching .DEREK.yml")
+	}
+
+	if want := []bool{true, true}; !reflect.DeepEqual(want, deadlines) {
+		t.Errorf("want the customer and config lookups to have a deadline, got: %v", deadlines)
+	}
+}
+
+// A PR which adds .DEREK.yml is checked although the default branch has none
+func Test_eventHandler_ConfigLintWithoutRepoConfig(t *testing.T) {
+	fake := fakegithub.New()
+	fake.AddPullRequest("alexellis", "derek", &github.PullRequest{
+		Number: github.Int(1),
+		State:  github.String("open"),
+	}, []*github.RepositoryCommit{{Commit: &github.Commit{Message: github.String("Add config")}}},
+		[]*github.CommitFile{{Filename: github.String(".DEREK.yml"), Status: github.String("added")}})
+	fake.AddFile("alexellis", "derek", "abc123", ".DEREK.yml", "maintainers:\n- alexellis\nfeature:\n- comments\n")
+
+	h := &eventHandler{
+		isCustomer: func(ctx context.Context, owner string) (bool, error) {
+			return true, nil
+		},
+		repoConfig: func(ctx context.Context, req types.EventOuter, config config.Config) (*types.DerekRepoConfig, error) {
+			return nil, fmt.Errorf("not found")
+		},
+		client: func(ctx context.Context) (*handler.GitHub, error) {
+			return &handler.GitHub{
+				Issues:       fake.Issues,
+				PullRequests: fake.PullRequests,
+				Checks:       fake.Checks,
+				Repositories: fake.Repositories,
+			}, nil
+		},
+	}
+
+	payload := `{"action": "opened", "repository": {"name": "derek", "owner": {"login": "alexellis"}},
+  "pull_request": {"number": 1, "state": "open", "head": {"sha": "abc123"}}, "installation": {"id": 1}}`
+	if _, err := h.handle(context.Background(), "pull_request", []byte(payload)); err == nil {
+		t.Errorf("want the error from fetching .DEREK.yml")
+	}
+
+	runs := fake.CheckRuns("alexellis", "derek")
+	if len(runs) != 1 || runs[0].GetConclusion() != "failure" {
+		t.Fatalf("want a failed config check run, got: %v", runs)
+	}
+}
+
+func Test_validateSignature(t *testing.T) {
+	body := []byte(`{"action": "opened"}`)
+	sign256 := func(secret string) string {
+		return "sha256=" + hex.EncodeToString(hmac.Sign(body, []byte(secret), sha256.New))
+	}
+	sign1 := func(secret string) string {
+		return "sha1=" + hex.EncodeToString(hmac.Sign(body, []byte(secret), sha1.New))
+	}
+
+	rotating := config.Config{SecretKey: "current", SecretKeys: []string{"current", "previous"}}
+	legacy := rotating
+	legacy.LegacySHA1Signatures = true
+
+	tests := []struct {
+		title           string
+		signature256    string
+		signature       string
+		config          config.Config
+		expectedSuccess bool
+	}{
+		{
+			title:           "Single secret",
+			signature256:    sign256("secret"),
+			config:          config.Config{SecretKey: "secret"},
+			expectedSuccess: true,
+		},
+		{
+			title:           "Current secret",
+			signature256:    sign256("current"),
+			config:          rotating,
+			expectedSuccess: true,
+		},
+		{
+			title:           "Previous secret",
+			signature256:    sign256("previous"),
+			config:          rotating,
+			expectedSuccess: true,
+		},
+		{
+			title:           "Unknown secret",
+			signature256:    sign256("unknown"),
+			config:          rotating,
+			expectedSuccess: false,
+		},
+		{
+			title:           "SHA-1 header is ignored unless enabled",
+			signature:       sign1("current"),
+			config:          rotating,
+			expectedSuccess: false,
+		},
+		{
+			title:           "SHA-1 header when enabled",
+			signature:       sign1("previous"),
+			config:          legacy,
+			expectedSuccess: true,
+		},
+		{
+			title:           "SHA-1 signature in the SHA-256 header",
+			signature256:    sign1("current"),
+			config:          legacy,
+			expectedSuccess: false,
+		},
+		{
+			title:           "SHA-256 header is checked before SHA-1",
+			signature256:    sign256("unknown"),
+			signature:       sign1("current"),
+			config:          legacy,
+			expectedSuccess: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			err := validateSignature(context.Background(), body, test.signature256, test.signature, test.config)
+			if (err == nil) != test.expectedSuccess {
+				t.Errorf("want success: %v, got error: %v", test.expectedSuccess, err)
+			}
+		})
+	}
+}
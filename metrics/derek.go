@@ -0,0 +1,49 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+// Derek's metrics, all are written by DefaultRegistry
+var (
+	WebhooksReceived = NewCounter("derek_webhooks_received_total",
+		"Webhooks received by event type.", "event")
+
+	FeatureRuns = NewCounter("derek_feature_runs_total",
+		"Features run by outcome: acted, skipped or failed.", "feature", "outcome")
+
+	FeatureDuration = NewHistogram("derek_feature_duration_seconds",
+		"Time taken by each feature to handle an event.", DefaultBuckets, "feature")
+
+	DCOChecks = NewCounter("derek_dco_checks_total",
+		"Pull requests checked for sign-off by result: pass or fail.", "result")
+
+	HacktoberfestSpamClosed = NewCounter("derek_hacktoberfest_spam_closed_total",
+		"Pull requests closed as Hacktoberfest spam.")
+
+	FirstTimerPRsClosed = NewCounter("derek_first_timer_prs_closed_total",
+		"Pull requests from first-time contributors closed by no_newbies.")
+
+	CommandsParsed = NewCounter("derek_commands_parsed_total",
+		"Commands parsed from comments by type.", "command")
+
+	JobRetries = NewCounter("derek_job_retries_total",
+		"Retries of jobs queued after a transient failure.", "job")
+
+	JobsDeadLettered = NewCounter("derek_jobs_dead_lettered_total",
+		"Jobs which gave up after a permanent failure or running out of attempts.", "job")
+
+	ConfigReloads = NewCounter("derek_config_reloads_total",
+		"Reloads of secrets and operator config by result: reloaded or failed.", "result")
+
+	GitHubRequests = NewCounter("derek_github_requests_total",
+		"Calls to the GitHub API by method and status code.", "method", "status")
+
+	GitHubRequestDuration = NewHistogram("derek_github_request_duration_seconds",
+		"Latency of calls to the GitHub API.", DefaultBuckets, "method")
+
+	GitHubRateLimitRemaining = NewGauge("derek_github_rate_limit_remaining",
+		"Requests left in the current rate limit window, from the last response.", "resource")
+
+	GitHubRateLimit = NewGauge("derek_github_rate_limit",
+		"Requests allowed in each rate limit window, from the last response.", "resource")
+)
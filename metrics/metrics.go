@@ -0,0 +1,258 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package metrics keeps counters, gauges and histograms in memory and
+// writes them in the Prometheus text exposition format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is a metric which can be written to /metrics
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics which are written by its Handler
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// DefaultRegistry holds Derek's metrics
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric in the order it was created
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the metrics for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w)
+	})
+}
+
+// vec holds a series for each combination of label values
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+
+	// buckets, sum and count are only used by histograms
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newVec(r *Registry, kind, name, help string, labels []string) *vec {
+	v := &vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: map[string]*series{},
+	}
+	r.register(v)
+	return v
+}
+
+// get must be called whilst holding mu
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s wants %d label values, got: %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted must be called whilst holding mu
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, v.series[key])
+	}
+	return out
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues), formatValue(s.value))
+	}
+}
+
+// Counter is a value which only goes up, i.e. webhooks received
+type Counter struct {
+	*vec
+}
+
+// NewCounter creates a counter in DefaultRegistry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newVec(DefaultRegistry, "counter", name, help, labels)}
+}
+
+// Inc adds one to the counter for the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a positive value to the counter for the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(labelValues).value += value
+}
+
+// Gauge is a value which can go up and down, i.e. remaining rate limit
+type Gauge struct {
+	*vec
+}
+
+// NewGauge creates a gauge in DefaultRegistry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newVec(DefaultRegistry, "gauge", name, help, labels)}
+}
+
+// Set sets the gauge for the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(labelValues).value = value
+}
+
+// DefaultBuckets suit durations in seconds of calls to GitHub
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts observations into buckets, i.e. durations
+type Histogram struct {
+	*vec
+	upperBounds []float64
+}
+
+// NewHistogram creates a histogram in DefaultRegistry, buckets are the
+// upper bounds in ascending order
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{upperBounds: buckets}
+	h.vec = &vec{
+		name:   name,
+		help:   help,
+		kind:   "histogram",
+		labels: labels,
+		series: map[string]*series{},
+	}
+	DefaultRegistry.register(h)
+	return h
+}
+
+// Observe records a value for the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.upperBounds))
+	}
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	labels := append(append([]string{}, h.labels...), "le")
+	for _, s := range h.sorted() {
+		for i, bound := range h.upperBounds {
+			values := append(append([]string{}, s.labelValues...), formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), s.buckets[i])
+		}
+		values := append(append([]string{}, s.labelValues...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Registry_Write(t *testing.T) {
+	counter := NewCounter("test_events_total", "Events by type.", "event")
+	counter.Inc("pull_request")
+	counter.Inc("pull_request")
+	counter.Add(3, `issue"comment`)
+
+	gauge := NewGauge("test_remaining", "Remaining calls.")
+	gauge.Set(4999)
+
+	histogram := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "method")
+	histogram.Observe(0.05, "GET")
+	histogram.Observe(0.5, "GET")
+	histogram.Observe(5, "GET")
+
+	var out bytes.Buffer
+	DefaultRegistry.Write(&out)
+
+	for _, want := range []string{
+		"# TYPE test_events_total counter",
+		`test_events_total{event="issue\"comment"} 3`,
+		`test_events_total{event="pull_request"} 2`,
+		"# TYPE test_remaining gauge",
+		"test_remaining 4999",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{method="GET",le="0.1"} 1`,
+		`test_duration_seconds_bucket{method="GET",le="1"} 2`,
+		`test_duration_seconds_bucket{method="GET",le="+Inf"} 3`,
+		`test_duration_seconds_sum{method="GET"} 5.55`,
+		`test_duration_seconds_count{method="GET"} 3`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("want line %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func Test_Counter_WrongLabels(t *testing.T) {
+	counter := NewCounter("test_labels_total", "Wrong labels.", "feature", "outcome")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("want a panic when label values are missing")
+		}
+	}()
+	counter.Inc("dco_check")
+}
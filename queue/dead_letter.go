@@ -0,0 +1,75 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/logging"
+)
+
+// DeadLetter records jobs which gave up, so they can be looked into or
+// run again by hand
+type DeadLetter interface {
+	Add(ctx context.Context, job string, attempts int, err error)
+}
+
+// DeadLetterEntry is a line of a DeadLetterFile
+type DeadLetterEntry struct {
+	Time     time.Time              `json:"time"`
+	Job      string                 `json:"job"`
+	Attempts int                    `json:"attempts"`
+	Error    string                 `json:"error"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+}
+
+// DeadLetterFile appends a JSON line per job to a file, along with the
+// log fields of the job such as its delivery, repository and feature
+type DeadLetterFile struct {
+	path string
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewDeadLetterFile creates a DeadLetterFile, the file is created
+// when the first job is added
+func NewDeadLetterFile(path string) *DeadLetterFile {
+	return &DeadLetterFile{path: path, now: time.Now}
+}
+
+// Add implements DeadLetter
+func (d *DeadLetterFile) Add(ctx context.Context, job string, attempts int, err error) {
+	entry := DeadLetterEntry{
+		Time:     d.now().UTC(),
+		Job:      job,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Fields:   map[string]interface{}(logging.FromContext(ctx).Data),
+	}
+
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		logging.Logger.Errorf("Unable to encode dead-letter entry: %s", marshalErr)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, openErr := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if openErr != nil {
+		logging.Logger.Errorf("Unable to open dead-letter log: %s", openErr)
+		return
+	}
+	defer f.Close()
+
+	if _, writeErr := f.Write(append(line, '\n')); writeErr != nil {
+		logging.Logger.Errorf("Unable to write dead-letter log: %s", writeErr)
+	}
+}
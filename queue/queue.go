@@ -0,0 +1,308 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package queue retries jobs which failed with a transient error in the
+// background, with exponential backoff. Jobs which run out of attempts,
+// or fail with an error which is not retryable, are written to a
+// dead-letter log.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults for a Queue
+const (
+	DefaultMaxAttempts = 5
+	DefaultBaseDelay   = time.Second * 2
+	DefaultMaxDelay    = time.Minute
+	DefaultWorkers     = 4
+)
+
+// RetryableError marks an error as transient, so the job which gave it
+// is tried again
+type RetryableError struct {
+	Err error
+
+	// After is the least time to wait before trying again, i.e. from a
+	// Retry-After header. Zero leaves the wait to the queue's backoff.
+	After time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap gives the transient error
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable marks err as transient, nil is returned for a nil error
+func Retryable(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err, After: after}
+}
+
+// IsRetryable returns true when err, or an error it wraps, is a RetryableError
+func IsRetryable(err error) bool {
+	var retryable *RetryableError
+	return errors.As(err, &retryable)
+}
+
+// Options configure a Queue, zero values are given the defaults
+type Options struct {
+	// MaxAttempts includes the first attempt, made before the job is queued
+	MaxAttempts int
+
+	// BaseDelay doubles for each attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Workers limits how many jobs run at once
+	Workers int
+
+	// DeadLetter records jobs which gave up, when nil they are only logged
+	DeadLetter DeadLetter
+}
+
+// Queue runs jobs in the background until they succeed or give up
+type Queue struct {
+	opts Options
+
+	slots   chan struct{}
+	pending sync.WaitGroup
+
+	// jobs are those which are queued, so that Drain can give up on them
+	mu   sync.Mutex
+	jobs map[*job]bool
+
+	sleep  func(d time.Duration)
+	jitter func(d time.Duration) time.Duration
+}
+
+// New creates a Queue
+func New(opts Options) *Queue {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+
+	return &Queue{
+		opts:   opts,
+		slots:  make(chan struct{}, opts.Workers),
+		jobs:   map[*job]bool{},
+		sleep:  time.Sleep,
+		jitter: addJitter,
+	}
+}
+
+// Retry queues a job which has already failed once with err. The job is
+// run with a context which keeps the values of ctx, such as its log
+// fields, but which is not cancelled along with ctx, since ctx usually
+// belongs to a webhook which has been answered.
+func (q *Queue) Retry(ctx context.Context, name string, err error, run func(ctx context.Context) error) {
+	ctx = detach(ctx)
+	logger := logging.FromContext(ctx).WithField("job", name)
+
+	if !IsRetryable(err) || q.opts.MaxAttempts < 2 {
+		q.deadLetter(ctx, name, 1, err)
+		return
+	}
+
+	delay := q.delay(1, err)
+	logger.Warnf("Queued for retry in %s after: %s", delay.Round(time.Millisecond), err)
+
+	j := &job{ctx: ctx, name: name, attempts: 1, err: err}
+	q.mu.Lock()
+	q.jobs[j] = true
+	q.mu.Unlock()
+
+	q.pending.Add(1)
+	go func() {
+		defer q.pending.Done()
+		q.run(j, delay, run)
+	}()
+}
+
+// job is a queued job along with its last failure
+type job struct {
+	ctx      context.Context
+	name     string
+	attempts int
+	err      error
+}
+
+func (q *Queue) run(j *job, delay time.Duration, run func(ctx context.Context) error) {
+	logger := logging.FromContext(j.ctx).WithField("job", j.name)
+
+	for attempt := j.attempts + 1; ; attempt++ {
+		q.sleep(delay)
+
+		q.slots <- struct{}{}
+		if !q.queued(j) {
+			<-q.slots
+			return
+		}
+		metrics.JobRetries.Inc(j.name)
+		err := run(j.ctx)
+		<-q.slots
+
+		if err == nil {
+			if q.finish(j) {
+				logger.Infof("Succeeded on attempt %d", attempt)
+			}
+			return
+		}
+
+		if !IsRetryable(err) || attempt >= q.opts.MaxAttempts {
+			if q.finish(j) {
+				q.deadLetter(j.ctx, j.name, attempt, err)
+			}
+			return
+		}
+
+		q.mu.Lock()
+		j.attempts, j.err = attempt, err
+		q.mu.Unlock()
+
+		delay = q.delay(attempt, err)
+		logger.Warnf("Attempt %d of %d failed, retrying in %s: %s",
+			attempt, q.opts.MaxAttempts, delay.Round(time.Millisecond), err)
+	}
+}
+
+// queued whether the job has not been given up on by Drain
+func (q *Queue) queued(j *job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.jobs[j]
+}
+
+// finish removes the job from the queue, and returns false when Drain
+// has already given up on it
+func (q *Queue) finish(j *job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := q.jobs[j]
+	delete(q.jobs, j)
+	return queued
+}
+
+// Drain waits for every queued job to succeed or give up. When ctx is done
+// first, the jobs still queued are given up on and dead-lettered with
+// their last error, then the error of ctx is returned.
+func (q *Queue) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	abandoned := q.jobs
+	q.jobs = map[*job]bool{}
+	q.mu.Unlock()
+
+	for j := range abandoned {
+		q.deadLetter(j.ctx, j.name, j.attempts, fmt.Errorf("still queued when draining stopped (%s), last error: %w", ctx.Err(), j.err))
+	}
+	return ctx.Err()
+}
+
+// delay doubles BaseDelay for each attempt made, up to MaxDelay, but is
+// never shorter than the wait asked for by a RetryableError
+func (q *Queue) delay(attempts int, err error) time.Duration {
+	delay := q.opts.BaseDelay
+	for i := 1; i < attempts && delay < q.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.opts.MaxDelay {
+		delay = q.opts.MaxDelay
+	}
+	delay = q.jitter(delay)
+
+	var retryable *RetryableError
+	if errors.As(err, &retryable) && retryable.After > delay {
+		delay = retryable.After
+	}
+	return delay
+}
+
+func (q *Queue) deadLetter(ctx context.Context, name string, attempts int, err error) {
+	metrics.JobsDeadLettered.Inc(name)
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"job":      name,
+		"attempts": attempts,
+	}).Errorf("Gave up on job: %s", err)
+
+	if q.opts.DeadLetter != nil {
+		q.opts.DeadLetter.Add(ctx, name, attempts, err)
+	}
+}
+
+type queueKey struct{}
+
+// WithQueue returns a context which lets handlers queue retries on q
+func WithQueue(ctx context.Context, q *Queue) context.Context {
+	return context.WithValue(ctx, queueKey{}, q)
+}
+
+// FromContext gives the Queue added by WithQueue, or nil
+func FromContext(ctx context.Context) *Queue {
+	if q, ok := ctx.Value(queueKey{}).(*Queue); ok {
+		return q
+	}
+	return nil
+}
+
+// detached keeps the values of a context without its deadline or cancellation
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+// addJitter spreads retries over the second half of d, so that jobs
+// which failed together do not all retry together
+func addJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,231 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingDeadLetter struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (d *recordingDeadLetter) Add(ctx context.Context, job string, attempts int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries = append(d.entries, job)
+}
+
+func newTestQueue(maxAttempts int, deadLetter DeadLetter, slept *[]time.Duration) *Queue {
+	q := New(Options{MaxAttempts: maxAttempts, DeadLetter: deadLetter})
+	q.jitter = func(d time.Duration) time.Duration { return d }
+
+	var mu sync.Mutex
+	q.sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		*slept = append(*slept, d)
+	}
+	return q
+}
+
+func Test_Queue_RetriesUntilSuccess(t *testing.T) {
+	var slept []time.Duration
+	deadLetter := &recordingDeadLetter{}
+	q := newTestQueue(5, deadLetter, &slept)
+
+	calls := 0
+	transient := Retryable(errors.New("502 Bad Gateway"), 0)
+
+	q.Retry(context.Background(), "add label", transient, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	})
+
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Errorf("want 3 retries, got: %d", calls)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
+	if len(slept) != len(want) {
+		t.Fatalf("want waits: %v, got: %v", want, slept)
+	}
+	for i := range want {
+		if slept[i] != want[i] {
+			t.Errorf("want waits: %v, got: %v", want, slept)
+		}
+	}
+	if len(deadLetter.entries) != 0 {
+		t.Errorf("want no dead letters, got: %v", deadLetter.entries)
+	}
+}
+
+func Test_Queue_DeadLettersAfterMaxAttempts(t *testing.T) {
+	var slept []time.Duration
+	deadLetter := &recordingDeadLetter{}
+	q := newTestQueue(3, deadLetter, &slept)
+
+	calls := 0
+	transient := Retryable(errors.New("502 Bad Gateway"), 0)
+
+	q.Retry(context.Background(), "add label", transient, func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	q.Drain(context.Background())
+
+	// The first of the 3 attempts was made before the job was queued
+	if calls != 2 {
+		t.Errorf("want 2 retries, got: %d", calls)
+	}
+	if len(deadLetter.entries) != 1 || deadLetter.entries[0] != "add label" {
+		t.Errorf("want add label dead-lettered, got: %v", deadLetter.entries)
+	}
+}
+
+func Test_Queue_DeadLettersPermanentErrors(t *testing.T) {
+	var slept []time.Duration
+	deadLetter := &recordingDeadLetter{}
+	q := newTestQueue(5, deadLetter, &slept)
+
+	calls := 0
+	q.Retry(context.Background(), "update release notes", Retryable(errors.New("not listed yet"), 0), func(ctx context.Context) error {
+		calls++
+		return errors.New("404 Not Found")
+	})
+	q.Drain(context.Background())
+
+	if calls != 1 {
+		t.Errorf("want 1 retry, got: %d", calls)
+	}
+	if len(deadLetter.entries) != 1 {
+		t.Errorf("want one dead letter, got: %v", deadLetter.entries)
+	}
+}
+
+func Test_Queue_WaitsForRetryAfter(t *testing.T) {
+	var slept []time.Duration
+	q := newTestQueue(2, nil, &slept)
+
+	q.Retry(context.Background(), "create check run", Retryable(errors.New("secondary rate limit"), time.Minute), func(ctx context.Context) error {
+		return nil
+	})
+	q.Drain(context.Background())
+
+	if len(slept) != 1 || slept[0] != time.Minute {
+		t.Errorf("want a wait of 1m, got: %v", slept)
+	}
+}
+
+func Test_Queue_RunsDetachedFromCancelledContext(t *testing.T) {
+	var slept []time.Duration
+	q := newTestQueue(2, nil, &slept)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var runErr error
+	q.Retry(ctx, "add label", Retryable(errors.New("timeout"), 0), func(ctx context.Context) error {
+		runErr = ctx.Err()
+		return nil
+	})
+	q.Drain(context.Background())
+
+	if runErr != nil {
+		t.Errorf("want the retry to outlive the webhook's context, got: %s", runErr)
+	}
+}
+
+func Test_Queue_DrainDeadLettersWhenDone(t *testing.T) {
+	deadLetter := &recordingDeadLetter{}
+	q := New(Options{MaxAttempts: 5, DeadLetter: deadLetter})
+
+	release := make(chan struct{})
+	q.sleep = func(d time.Duration) { <-release }
+	defer close(release)
+
+	calls := 0
+	q.Retry(context.Background(), "add label", Retryable(errors.New("502 Bad Gateway"), 0), func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := q.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want the deadline exceeded, got: %v", err)
+	}
+
+	deadLetter.mu.Lock()
+	defer deadLetter.mu.Unlock()
+	if len(deadLetter.entries) != 1 || deadLetter.entries[0] != "add label" {
+		t.Errorf("want add label dead-lettered, got: %v", deadLetter.entries)
+	}
+	if calls != 0 {
+		t.Errorf("want no retries once drained, got: %d", calls)
+	}
+}
+
+func Test_IsRetryable_Wrapped(t *testing.T) {
+	err := fmt.Errorf("unable to add label: %w", Retryable(errors.New("502 Bad Gateway"), 0))
+	if !IsRetryable(err) {
+		t.Errorf("want a wrapped RetryableError to be retryable")
+	}
+	if IsRetryable(errors.New("404 Not Found")) {
+		t.Errorf("want other errors to be permanent")
+	}
+	if Retryable(nil, 0) != nil {
+		t.Errorf("want nil for a nil error")
+	}
+}
+
+func Test_DeadLetterFile_Add(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derek-dead-letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead-letter.jsonl")
+
+	d := NewDeadLetterFile(path)
+	d.Add(context.Background(), "add label", 5, errors.New("502 Bad Gateway"))
+	d.Add(context.Background(), "remove label", 1, errors.New("404 Not Found"))
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got: %q", data)
+	}
+
+	entry := DeadLetterEntry{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Job != "add label" || entry.Attempts != 5 || entry.Error != "502 Bad Gateway" {
+		t.Errorf("want add label after 5 attempts, got: %+v", entry)
+	}
+}
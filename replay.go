@@ -0,0 +1,231 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/factory"
+	"github.com/alexellis/derek/handler"
+	"github.com/alexellis/derek/types"
+)
+
+const replayUsage = `Usage: derek replay [flags] [event] <payload.json | directory>
+
+Runs saved webhook payloads through Derek's features. HMAC and customer
+checks are skipped and .DEREK.yml is read from disk instead of the repository.
+
+Without -api-url, reads go to GitHub and changes are printed as a dry-run.
+
+The event type may be left out for deliveries saved from the GitHub App's
+"Recent Deliveries" API, which record the event alongside the payload.
+
+Flags:
+`
+
+// recordedDelivery is the subset of a recorded webhook delivery from
+// GET /app/hook/deliveries/:id which replay needs
+type recordedDelivery struct {
+	Event   string `json:"event"`
+	Request struct {
+		Payload json.RawMessage `json:"payload"`
+	} `json:"request"`
+}
+
+// replayItem is a single payload to replay
+type replayItem struct {
+	name      string
+	eventType string
+	payload   []byte
+}
+
+// replay runs the payloads given in args and writes the actions which
+// were, or would be, taken to out.
+func replay(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, replayUsage)
+		flags.PrintDefaults()
+	}
+
+	configPath := flags.String("config", ".DEREK.yml", "path to the .DEREK.yml to use for the repository")
+	apiURL := flags.String("api-url", "", "base URL of a GitHub API to send calls to, i.e. a fake API server")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	var eventType, path string
+	switch flags.NArg() {
+	case 1:
+		path = flags.Arg(0)
+	case 2:
+		eventType, path = flags.Arg(0), flags.Arg(1)
+	default:
+		flags.Usage()
+		return fmt.Errorf("replay needs a payload file or directory")
+	}
+
+	items, err := readReplayItems(path, eventType)
+	if err != nil {
+		return err
+	}
+
+	// Secrets are optional when replaying, since tokens are not minted
+	cfg, _ := config.NewConfig()
+
+	derekConfig, err := handler.ReadRepoConfigFile(context.Background(), *configPath, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %s", *configPath, err)
+	}
+
+	h, err := newReplayHandler(cfg, derekConfig, *apiURL)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, item := range items {
+		fmt.Fprintf(out, "==> %s (%s)\n", item.name, item.eventType)
+
+		report, err := h.handle(context.Background(), item.eventType, item.payload)
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+			failed++
+			continue
+		}
+
+		printReport(out, report)
+		if report.Failed() {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d payload(s) failed", failed, len(items))
+	}
+	return nil
+}
+
+// newReplayHandler trusts every owner and uses derekConfig for every repository.
+// Calls go to apiURL when given, otherwise to GitHub with changes recorded.
+func newReplayHandler(cfg config.Config, derekConfig *types.DerekRepoConfig, apiURL string) (*eventHandler, error) {
+	var baseURL *url.URL
+	if len(apiURL) > 0 {
+		var err error
+		if baseURL, err = url.Parse(strings.TrimSuffix(apiURL, "/") + "/"); err != nil {
+			return nil, fmt.Errorf("invalid -api-url: %s", err)
+		}
+	} else {
+		cfg.DryRun = true
+	}
+
+	token := os.Getenv("personal_access_token")
+
+	return &eventHandler{
+		config: cfg,
+		isCustomer: func(ctx context.Context, owner string) (bool, error) {
+			return true, nil
+		},
+		repoConfig: func(ctx context.Context, req types.EventOuter, config config.Config) (*types.DerekRepoConfig, error) {
+			copied := *derekConfig
+			return &copied, nil
+		},
+		client: func(ctx context.Context) (*handler.GitHub, error) {
+			client := factory.MakeClient(ctx, token, cfg)
+			if baseURL != nil {
+				client.BaseURL = baseURL
+			}
+			return handler.NewGitHub(client), nil
+		},
+	}, nil
+}
+
+// readReplayItems reads a payload file, or every .json file in a directory
+// in name order. Recorded deliveries give their own event type.
+func readReplayItems(path, eventType string) ([]replayItem, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no .json files found in %s", path)
+		}
+	}
+
+	var items []replayItem
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		item := replayItem{name: file, eventType: eventType, payload: data}
+
+		var d recordedDelivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("%s is not valid JSON: %s", file, err)
+		}
+		if len(d.Event) > 0 && len(d.Request.Payload) > 0 {
+			item.eventType = d.Event
+			item.payload = d.Request.Payload
+		}
+
+		if len(item.eventType) == 0 {
+			return nil, fmt.Errorf("%s is not a recorded delivery, give the event type", file)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// printReport writes every action, skip and error recorded by each feature
+func printReport(out io.Writer, report *handler.Report) {
+	if len(report.Results) == 0 {
+		fmt.Fprintln(out, "no features ran")
+	}
+
+	for _, result := range report.Results {
+		fmt.Fprintf(out, "[%s]\n", result.Feature)
+		for _, action := range result.Actions {
+			fmt.Fprintf(out, "  action: %s\n", action)
+		}
+		for _, skipped := range result.Skipped {
+			fmt.Fprintf(out, "  skipped: %s\n", skipped)
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintf(out, "  error: %s\n", err)
+		}
+	}
+
+	if report.DryRun {
+		fmt.Fprintf(out, "dry-run, %d change(s) not sent to GitHub:\n", len(report.Plan))
+		for _, action := range report.Plan {
+			fmt.Fprintf(out, "  %s\n", action)
+		}
+	}
+}
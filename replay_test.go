@@ -0,0 +1,125 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexellis/derek/fakegithub"
+	"github.com/google/go-github/github"
+)
+
+const replayDerekConfig = `maintainers:
+- alexellis
+features:
+- comments
+`
+
+const replayCommentPayload = `{
+  "action": "created",
+  "repository": {"owner": {"login": "alexellis"}, "name": "derek"},
+  "issue": {"number": 1, "title": "Typo", "state": "open"},
+  "comment": {"body": "Derek add label: docs", "user": {"login": "alexellis"}},
+  "installation": {"id": 1}
+}`
+
+func writeReplayFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "derek-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func Test_replay_AgainstFakeAPI(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		".DEREK.yml":   replayDerekConfig,
+		"comment.json": replayCommentPayload,
+	})
+	defer os.RemoveAll(dir)
+
+	fake := fakegithub.New()
+	fake.AddIssue("alexellis", "derek", &github.Issue{Number: github.Int(1)})
+	server := fakegithub.NewServer(fake)
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := replay([]string{
+		"-config", filepath.Join(dir, ".DEREK.yml"),
+		"-api-url", server.URL,
+		"issue_comment", filepath.Join(dir, "comment.json"),
+	}, &out)
+	if err != nil {
+		t.Fatalf("want no error, got: %s\n%s", err, out.String())
+	}
+
+	if want, got := []string{"docs"}, fake.Labels("alexellis", "derek", 1); !reflect.DeepEqual(want, got) {
+		t.Errorf("want labels: %v, got: %v", want, got)
+	}
+	if !strings.Contains(out.String(), "[comments]") {
+		t.Errorf("want the comments feature in the output, got:\n%s", out.String())
+	}
+}
+
+func Test_replay_DryRunRecordedDeliveries(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		".DEREK.yml":               replayDerekConfig,
+		"deliveries/0001.json":     `{"event": "issue_comment", "request": {"payload": ` + replayCommentPayload + `}}`,
+		"deliveries/0002.json":     `{"event": "issue_comment", "request": {"payload": ` + strings.Replace(replayCommentPayload, "add label: docs", "close", 1) + `}}`,
+		"deliveries/notes.txt.bak": "ignored",
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	err := replay([]string{
+		"-config", filepath.Join(dir, ".DEREK.yml"),
+		filepath.Join(dir, "deliveries"),
+	}, &out)
+	if err != nil {
+		t.Fatalf("want no error, got: %s\n%s", err, out.String())
+	}
+
+	for _, want := range []string{
+		"0001.json (issue_comment)",
+		"POST /repos/alexellis/derek/issues/1/labels [\"docs\"]",
+		"0002.json (issue_comment)",
+		"PATCH /repos/alexellis/derek/issues/1 {\"state\":\"closed\"}",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func Test_readReplayItems_NeedsEventType(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		"comment.json": replayCommentPayload,
+	})
+	defer os.RemoveAll(dir)
+
+	if _, err := readReplayItems(filepath.Join(dir, "comment.json"), ""); err == nil {
+		t.Errorf("want an error when a raw payload has no event type")
+	}
+
+	items, err := readReplayItems(filepath.Join(dir, "comment.json"), "issue_comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].eventType != "issue_comment" {
+		t.Errorf("want one issue_comment item, got: %v", items)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/delivery"
+	"github.com/alexellis/derek/handler"
+	"github.com/alexellis/derek/logging"
+	"github.com/alexellis/derek/metrics"
+	"github.com/alexellis/derek/queue"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPort         = 8080
+	defaultReadTimeout  = time.Second * 15
+	defaultWriteTimeout = time.Second * 15
+
+	// GitHub caps webhook payloads at 25MB
+	maxPayloadBytes = 25 * 1024 * 1024
+)
+
+// webhookServer runs Derek as a long-running HTTP server rather
+// than as a process forked by the OpenFaaS classic watchdog
+type webhookServer struct {
+	config       config.Config
+	validateHmac bool
+
+	// configs replaces config when the secrets or operator config are
+	// reloaded, when nil config is used for the life of the server
+	configs *config.Reloader
+
+	writeTimeout time.Duration
+
+	// deliveries records X-GitHub-Delivery IDs, when nil duplicates are not checked
+	deliveries delivery.Store
+
+	// retries runs calls to GitHub which failed with a transient error
+	// after the webhook has been answered, when nil they are not retried
+	retries *queue.Queue
+
+	// handle runs the features for an event, when nil handleEvent is used
+	handle func(ctx context.Context, eventType string, body []byte, config config.Config) (*handler.Report, error)
+
+	// shuttingDown is set to 1 once a shutdown signal is received
+	// so that the readiness endpoint can take Derek out of rotation
+	shuttingDown int32
+}
+
+// serve starts the HTTP server and blocks until SIGINT or SIGTERM
+// is received, at which point in-flight requests are drained.
+func serve() error {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	readTimeout := getDurationEnv("read_timeout", defaultReadTimeout)
+	writeTimeout := getDurationEnv("write_timeout", defaultWriteTimeout)
+
+	port := defaultPort
+	if val, ok := os.LookupEnv("port"); ok && len(val) > 0 {
+		port, err = strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for port: %q", val)
+		}
+	}
+
+	deliveries, err := newDeliveryStore(cfg, delivery.NewMemoryStore(cfg.DeliveryTTL))
+	if err != nil {
+		return fmt.Errorf("unable to open delivery store: %s", err)
+	}
+
+	s := &webhookServer{
+		config:       cfg,
+		configs:      config.NewReloader(cfg, config.NewConfig),
+		validateHmac: hmacValidation(),
+		writeTimeout: writeTimeout,
+		deliveries:   deliveries,
+		retries:      newQueue(cfg),
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go s.watchConfig(watchCtx, getDurationEnv("config_reload_interval", 0))
+
+	srv := &http.Server{
+		Addr:           fmt.Sprintf(":%d", port),
+		Handler:        s.routes(),
+		ReadTimeout:    readTimeout,
+		WriteTimeout:   writeTimeout + time.Second,
+		MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		logging.Logger.Infof("Derek listening on port: %d", port)
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		return err
+	case received := <-sig:
+		logging.Logger.Infof("Received %s, draining connections for up to %s", received, writeTimeout)
+	}
+
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if err := s.retries.Drain(ctx); err != nil {
+		logging.Logger.Warnf("Retries still queued at shutdown were abandoned: %s", err)
+	}
+	return nil
+}
+
+// watchConfig reloads the config when its files change or SIGHUP is
+// received, until ctx is done
+func (s *webhookServer) watchConfig(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go s.configs.Watch(ctx, interval, func(err error) {
+		logReload(err, "files changed")
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case received := <-hup:
+			logReload(s.configs.Reload(), received.String())
+		}
+	}
+}
+
+func logReload(err error, reason string) {
+	if err != nil {
+		metrics.ConfigReloads.Inc("failed")
+		logging.Logger.Errorf("Unable to reload config after %s, keeping the current config: %s", reason, err)
+		return
+	}
+	metrics.ConfigReloads.Inc("reloaded")
+	logging.Logger.Infof("Reloaded config after %s", reason)
+}
+
+// currentConfig gives the config to handle a webhook with
+func (s *webhookServer) currentConfig() config.Config {
+	if s.configs != nil {
+		return s.configs.Config()
+	}
+	return s.config
+}
+
+func (s *webhookServer) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	timeoutMsg := "timed out processing webhook"
+	mux.Handle("/webhook", http.TimeoutHandler(http.HandlerFunc(s.handleWebhook), s.writeTimeout, timeoutMsg))
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.Handle("/metrics", metrics.DefaultRegistry.Handler())
+
+	return mux
+}
+
+func (s *webhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to read body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	eventType := r.Header.Get("X-GitHub-Event")
+
+	// The same config is used for the whole of the webhook, even if it is
+	// reloaded part way through
+	config := s.currentConfig()
+
+	ctx := logging.WithFields(r.Context(), logrus.Fields{
+		logging.DeliveryField: deliveryID,
+		logging.EventField:    eventType,
+	})
+	logger := logging.FromContext(ctx)
+
+	if s.validateHmac {
+		if err := validateSignature(ctx, body, r.Header.Get("X-Hub-Signature-256"), r.Header.Get("X-Hub-Signature"), config); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	metrics.WebhooksReceived.Inc(eventType)
+
+	if err := checkDelivery(ctx, s.deliveries, deliveryID, body, config); err == errDuplicateDelivery {
+		logger.Info("Skipping delivery, it has already been processed")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.retries != nil {
+		ctx = queue.WithQueue(ctx, s.retries)
+	}
+
+	handle := s.handle
+	if handle == nil {
+		handle = handleEvent
+	}
+
+	report, err := handle(ctx, eventType, body, config)
+	report.Log(ctx)
+
+	if err != nil {
+		forgetDelivery(ctx, s.deliveries, deliveryID)
+		logger.Errorf("Error handling event: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusAccepted
+	if report.TimedOut {
+		logger.Errorf("Deadline exceeded handling event: %s", report.Err())
+		status = http.StatusGatewayTimeout
+	} else if report.Failed() {
+		logger.Errorf("Error handling event: %s", report.Err())
+		status = http.StatusInternalServerError
+	}
+
+	// GitHub, or a maintainer, may redeliver an event which failed
+	if status != http.StatusAccepted {
+		forgetDelivery(ctx, s.deliveries, deliveryID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *webhookServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (s *webhookServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// getDurationEnv reads a duration such as "15s" from the environment,
+// a bare integer is treated as a number of seconds as per the watchdog.
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok || len(val) == 0 {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if duration, err := time.ParseDuration(val); err == nil {
+		return duration
+	}
+
+	return fallback
+}
@@ -0,0 +1,322 @@
+// Copyright (c) Derek Author(s) 2017. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexellis/derek/config"
+	"github.com/alexellis/derek/delivery"
+	"github.com/alexellis/derek/handler"
+	"github.com/alexellis/hmac/v2"
+)
+
+func Test_webhookServer_Health(t *testing.T) {
+	s := &webhookServer{writeTimeout: time.Second}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("want status: %d, got: %d", http.StatusOK, rr.Code)
+			}
+		})
+	}
+}
+
+func Test_webhookServer_NotReadyWhenShuttingDown(t *testing.T) {
+	s := &webhookServer{writeTimeout: time.Second, shuttingDown: 1}
+
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
+func Test_webhookServer_Webhook(t *testing.T) {
+	secret := "secret"
+	body := []byte(`{"action": "opened"}`)
+	validSignature := "sha256=" + hex.EncodeToString(hmac.Sign(body, []byte(secret), sha256.New))
+
+	tests := []struct {
+		title        string
+		method       string
+		signature    string
+		eventType    string
+		expectedCode int
+	}{
+		{
+			title:        "GET is not allowed",
+			method:       http.MethodGet,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			title:        "Missing signature is rejected",
+			method:       http.MethodPost,
+			eventType:    "pull_request",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			title:        "Invalid signature is rejected",
+			method:       http.MethodPost,
+			signature:    "sha256=" + hex.EncodeToString([]byte("invalid")),
+			eventType:    "pull_request",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			title:        "Valid signature with unsupported event gives an error",
+			method:       http.MethodPost,
+			signature:    validSignature,
+			eventType:    "fork",
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	s := &webhookServer{
+		config:       config.Config{SecretKey: secret},
+		validateHmac: true,
+		writeTimeout: time.Second,
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/webhook", bytes.NewReader(body))
+			req.Header.Set("X-GitHub-Event", test.eventType)
+			if len(test.signature) > 0 {
+				req.Header.Set("X-Hub-Signature-256", test.signature)
+			}
+
+			rr := httptest.NewRecorder()
+			s.routes().ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("want status: %d, got: %d, body: %q", test.expectedCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func Test_webhookServer_UsesReloadedSecret(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	initial := config.Config{SecretKey: "secret", PrivateKey: privateKey}
+	s := &webhookServer{
+		config: initial,
+		configs: config.NewReloader(initial, func() (config.Config, error) {
+			return config.Config{SecretKey: "rotated", PrivateKey: privateKey}, nil
+		}),
+		validateHmac: true,
+		writeTimeout: time.Second,
+	}
+
+	body := []byte(`{"action": "opened"}`)
+	send := func(secret string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "fork")
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(hmac.Sign(body, []byte(secret), sha256.New)))
+
+		rr := httptest.NewRecorder()
+		s.routes().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if err := s.configs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := send("secret"); code != http.StatusUnauthorized {
+		t.Errorf("want the old secret rejected after a reload, got status: %d", code)
+	}
+	if code := send("rotated"); code == http.StatusUnauthorized {
+		t.Errorf("want the reloaded secret accepted, got status: %d", code)
+	}
+}
+
+func Test_getDurationEnv(t *testing.T) {
+	tests := []struct {
+		title    string
+		value    string
+		expected time.Duration
+	}{
+		{
+			title:    "Unset uses fallback",
+			value:    "",
+			expected: time.Second * 3,
+		},
+		{
+			title:    "Bare integer is treated as seconds",
+			value:    "20",
+			expected: time.Second * 20,
+		},
+		{
+			title:    "Go duration is parsed",
+			value:    "1m30s",
+			expected: time.Second * 90,
+		},
+		{
+			title:    "Invalid value uses fallback",
+			value:    "fast",
+			expected: time.Second * 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			os.Setenv("derek_test_timeout", test.value)
+			defer os.Unsetenv("derek_test_timeout")
+
+			got := getDurationEnv("derek_test_timeout", time.Second*3)
+			if got != test.expected {
+				t.Errorf("want: %s, got: %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func Test_webhookServer_Deliveries(t *testing.T) {
+	secret := "secret"
+	fresh := []byte(`{"ref": "refs/heads/feature", "head_commit": {"timestamp": "` + time.Now().Format(time.RFC3339) + `"}}`)
+	stale := []byte(`{"ref": "refs/heads/feature", "head_commit": {"timestamp": "2019-10-01T10:00:00Z"}}`)
+
+	s := &webhookServer{
+		config:       config.Config{SecretKey: secret, MaxPayloadAge: time.Hour},
+		validateHmac: true,
+		writeTimeout: time.Second,
+		deliveries:   delivery.NewMemoryStore(time.Hour),
+	}
+
+	send := func(body []byte, deliveryID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-GitHub-Delivery", deliveryID)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(hmac.Sign(body, []byte(secret), sha256.New)))
+
+		rr := httptest.NewRecorder()
+		s.routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(stale, "stale"); rr.Code != http.StatusBadRequest {
+		t.Errorf("want stale payload rejected with: %d, got: %d, body: %q", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	// Pushes to other branches are handled without calling GitHub
+	first := send(fresh, "delivery-1")
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("want first delivery handled with: %d, got: %d, body: %q", http.StatusAccepted, first.Code, first.Body.String())
+	}
+
+	duplicate := send(fresh, "delivery-1")
+	if duplicate.Code != http.StatusOK || duplicate.Body.String() != errDuplicateDelivery.Error() {
+		t.Errorf("want duplicate skipped, got: %d, body: %q", duplicate.Code, duplicate.Body.String())
+	}
+}
+
+func Test_webhookServer_Metrics(t *testing.T) {
+	s := &webhookServer{writeTimeout: time.Second}
+
+	body := []byte(`{"ref": "refs/heads/feature"}`)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "push")
+	s.routes().ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if want := `derek_webhooks_received_total{event="push"}`; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("want %q in metrics, got:\n%s", want, rr.Body.String())
+	}
+}
+
+func Test_webhookServer_FailedDeliveriesCanBeRedelivered(t *testing.T) {
+	secret := "secret"
+	body := []byte(`{"action": "opened"}`)
+
+	tests := []struct {
+		title        string
+		report       func() *handler.Report
+		expectedCode int
+	}{
+		{
+			title: "Failed feature",
+			report: func() *handler.Report {
+				report := handler.NewReport("pull_request")
+				result := handler.NewResult("dco_check")
+				result.Fail(errors.New("unable to fetch PR"))
+				report.Add(result)
+				return report
+			},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			title: "Deadline exceeded",
+			report: func() *handler.Report {
+				report := handler.NewReport("pull_request")
+				report.TimedOut = true
+				report.NotRun = []string{"hacktoberfest"}
+				return report
+			},
+			expectedCode: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			handled := 0
+			s := &webhookServer{
+				config:       config.Config{SecretKey: secret},
+				validateHmac: true,
+				writeTimeout: time.Second,
+				deliveries:   delivery.NewMemoryStore(time.Hour),
+				handle: func(ctx context.Context, eventType string, body []byte, config config.Config) (*handler.Report, error) {
+					handled++
+					return test.report(), nil
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+				req.Header.Set("X-GitHub-Event", "pull_request")
+				req.Header.Set("X-GitHub-Delivery", "delivery-1")
+				req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(hmac.Sign(body, []byte(secret), sha256.New)))
+
+				rr := httptest.NewRecorder()
+				s.routes().ServeHTTP(rr, req)
+
+				if rr.Code != test.expectedCode {
+					t.Errorf("want status: %d, got: %d, body: %q", test.expectedCode, rr.Code, rr.Body.String())
+				}
+			}
+
+			if handled != 2 {
+				t.Errorf("want the redelivery handled again, got: %d", handled)
+			}
+		})
+	}
+}
@@ -1,15 +1,190 @@
 package types
 
 import (
+	"strings"
+
 	"github.com/imdario/mergo"
 )
 
+// Strategies for merging a list with the list it inherits, set per field
+// under merge, i.e. "maintainers: replace"
+const (
+	AppendStrategy  = "append"
+	ReplaceStrategy = "replace"
+)
+
+// RemovePrefix marks a list entry which removes an inherited entry, i.e.
+// "!hacktoberfest" in features or "!alexellis" in maintainers
+const RemovePrefix = "!"
+
+// MergeableFields are the lists which a strategy can be given for
+var MergeableFields = []string{"features", "maintainers", "curators", "custom_messages", "required_in_issues"}
+
+// MergeDerekRepoConfigs merges a local config with the remote config it
+// redirects to. Single values set in the remote config win, whilst the lists
+// of the local config are applied over the remote config's lists, so
+// they can add, remove or replace entries.
 func MergeDerekRepoConfigs(localConfig, remoteConfig DerekRepoConfig) (DerekRepoConfig, error) {
+	merged := withoutBools(remoteConfig)
+	if err := mergo.Merge(&merged, withoutBools(localConfig)); err != nil {
+		return remoteConfig, err
+	}
+
+	mergeBools(&merged, localConfig, remoteConfig)
+	mergeLists(&merged, remoteConfig, localConfig)
+	merged.Extends = appendSources(localConfig.Extends, remoteConfig.Extends)
+	merged.Sources = appendSources(localConfig.Sources, remoteConfig.Sources)
+	return merged, nil
+}
+
+// OverrideDerekRepoConfig applies override over the base config it
+// inherits from. Single values set in override win, and its lists are
+// applied over the base config's lists.
+func OverrideDerekRepoConfig(base, override DerekRepoConfig) (DerekRepoConfig, error) {
+	merged := withoutBools(override)
+	if err := mergo.Merge(&merged, withoutBools(base)); err != nil {
+		return override, err
+	}
+
+	mergeBools(&merged, base, override)
+	mergeLists(&merged, base, override)
+	merged.Extends = appendSources(base.Extends, override.Extends)
+	merged.Sources = appendSources(base.Sources, override.Sources)
+	return merged, nil
+}
 
-	mergeErr := mergo.Merge(&remoteConfig, &localConfig, mergo.WithAppendSlice)
-	if mergeErr != nil {
-		return remoteConfig, mergeErr
+// withoutBools clears the optional bools before merging with mergo, which
+// only fills values left unset and would write through the pointers
+func withoutBools(config DerekRepoConfig) DerekRepoConfig {
+	config.DryRun = nil
+	config.IgnoreOrgConfig = nil
+	return config
+}
+
+// mergeBools sets each optional bool of merged to the value of higher when
+// it is set, otherwise to that of lower, so false can be set over true
+func mergeBools(merged *DerekRepoConfig, lower, higher DerekRepoConfig) {
+	merged.DryRun = mergeBool(lower.DryRun, higher.DryRun)
+	merged.IgnoreOrgConfig = mergeBool(lower.IgnoreOrgConfig, higher.IgnoreOrgConfig)
+}
+
+func mergeBool(lower, higher *bool) *bool {
+	if higher != nil {
+		return higher
+	}
+	return lower
+}
+
+// appendSources lists the sources of two configs, lowest precedence first
+func appendSources(lower, higher []string) []string {
+	return append(append([]string(nil), lower...), higher...)
+}
+
+// mergeLists sets the lists of merged to those of base with the lists of
+// override applied, the strategies of override take precedence
+func mergeLists(merged *DerekRepoConfig, base, override DerekRepoConfig) {
+	merged.Features = MergeList(base.Features, override.Features, override.Strategy("features"))
+	merged.Maintainers = MergeList(base.Maintainers, override.Maintainers, override.Strategy("maintainers"))
+	merged.Curators = MergeList(base.Curators, override.Curators, override.Strategy("curators"))
+	merged.RequiredInIssues = MergeList(base.RequiredInIssues, override.RequiredInIssues, override.Strategy("required_in_issues"))
+	merged.Messages = mergeMessages(base.Messages, override.Messages, override.Strategy("custom_messages"))
+
+	merged.Merge = nil
+	for _, strategies := range []map[string]string{base.Merge, override.Merge} {
+		for field, strategy := range strategies {
+			if merged.Merge == nil {
+				merged.Merge = map[string]string{}
+			}
+			merged.Merge[field] = strategy
+		}
 	}
+}
 
-	return remoteConfig, nil
+// Strategy gives the strategy for merging the list given by field, the
+// default is to append
+func (c DerekRepoConfig) Strategy(field string) string {
+	if strategy, ok := c.Merge[field]; ok && len(strategy) > 0 {
+		return strings.ToLower(strategy)
+	}
+	return AppendStrategy
+}
+
+// MergeList applies the override list to the base list. With the append
+// strategy, entries of override which start with RemovePrefix remove the
+// same entries from base, ignoring case, and the rest are added after
+// base. With the replace strategy base is ignored. Removals are kept in
+// the result so that they also apply to lists merged beneath it later,
+// RemoveMarkers drops them once merging is done.
+func MergeList(base, override []string, strategy string) []string {
+	if strategy == ReplaceStrategy {
+		return append([]string(nil), override...)
+	}
+
+	var merged []string
+	for _, entry := range base {
+		if !removed(entry, override) {
+			merged = append(merged, entry)
+		}
+	}
+	return append(merged, override...)
+}
+
+func mergeMessages(base, override []Message, strategy string) []Message {
+	if strategy == ReplaceStrategy {
+		return append([]Message(nil), override...)
+	}
+
+	var names []string
+	for _, message := range override {
+		names = append(names, message.Name)
+	}
+
+	var merged []Message
+	for _, message := range base {
+		if !removed(message.Name, names) {
+			merged = append(merged, message)
+		}
+	}
+	return append(merged, override...)
+}
+
+// removed whether a list has a removal for the entry
+func removed(entry string, list []string) bool {
+	if strings.HasPrefix(entry, RemovePrefix) {
+		return false
+	}
+	for _, value := range list {
+		if strings.HasPrefix(value, RemovePrefix) && strings.EqualFold(strings.TrimPrefix(value, RemovePrefix), entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveMarkers drops the entries which remove others from every list,
+// once there are no more configs to merge
+func RemoveMarkers(config DerekRepoConfig) DerekRepoConfig {
+	config.Features = withoutMarkers(config.Features)
+	config.Maintainers = withoutMarkers(config.Maintainers)
+	config.Curators = withoutMarkers(config.Curators)
+	config.RequiredInIssues = withoutMarkers(config.RequiredInIssues)
+
+	var messages []Message
+	for _, message := range config.Messages {
+		if !strings.HasPrefix(message.Name, RemovePrefix) {
+			messages = append(messages, message)
+		}
+	}
+	config.Messages = messages
+	return config
+}
+
+func withoutMarkers(list []string) []string {
+	var kept []string
+	for _, entry := range list {
+		if !strings.HasPrefix(entry, RemovePrefix) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
 }
@@ -78,3 +78,213 @@ func Test_mergeDerekRepoConfigs_ConfigValuesAppendedToList(t *testing.T) {
 	}
 
 }
+
+func Test_mergeDerekRepoConfigs_RemovesInheritedEntries(t *testing.T) {
+
+	local := DerekRepoConfig{
+		Features:    []string{"!hacktoberfest", "comments"},
+		Maintainers: []string{"!AlexEllis"},
+	}
+
+	remote := DerekRepoConfig{
+		Features:    []string{"dco_check", "hacktoberfest"},
+		Maintainers: []string{"alexellis", "rgee0"},
+	}
+
+	configOut, err := MergeDerekRepoConfigs(local, remote)
+	if err != nil {
+		t.Fatalf("Got error for a single plan, expected no error: %s", err.Error())
+	}
+
+	want := []string{"dco_check", "!hacktoberfest", "comments"}
+	if !reflect.DeepEqual(want, configOut.Features) {
+		t.Errorf("Features want: %s, but got: %s", want, configOut.Features)
+	}
+
+	configOut = RemoveMarkers(configOut)
+
+	want = []string{"dco_check", "comments"}
+	if !reflect.DeepEqual(want, configOut.Features) {
+		t.Errorf("Features without markers want: %s, but got: %s", want, configOut.Features)
+	}
+
+	want = []string{"rgee0"}
+	if !reflect.DeepEqual(want, configOut.Maintainers) {
+		t.Errorf("Maintainers want: %s, but got: %s", want, configOut.Maintainers)
+	}
+}
+
+func Test_mergeDerekRepoConfigs_ReplaceStrategy(t *testing.T) {
+
+	local := DerekRepoConfig{
+		Features:    []string{"comments"},
+		Maintainers: []string{"Waterdrips"},
+		Merge:       map[string]string{"maintainers": "Replace"},
+	}
+
+	remote := DerekRepoConfig{
+		Features:    []string{"dco_check"},
+		Maintainers: []string{"alexellis", "rgee0"},
+	}
+
+	configOut, err := MergeDerekRepoConfigs(local, remote)
+	if err != nil {
+		t.Fatalf("Got error for a single plan, expected no error: %s", err.Error())
+	}
+
+	want := []string{"Waterdrips"}
+	if !reflect.DeepEqual(want, configOut.Maintainers) {
+		t.Errorf("Maintainers want: %s, but got: %s", want, configOut.Maintainers)
+	}
+
+	want = []string{"dco_check", "comments"}
+	if !reflect.DeepEqual(want, configOut.Features) {
+		t.Errorf("Features want: %s, but got: %s", want, configOut.Features)
+	}
+}
+
+func Test_mergeDerekRepoConfigs_RemovesCustomMessages(t *testing.T) {
+
+	local := DerekRepoConfig{
+		Messages: []Message{{Name: "!docs"}},
+	}
+
+	remote := DerekRepoConfig{
+		Messages: []Message{{Name: "docs", Value: "See the docs"}, {Name: "faq", Value: "See the FAQ"}},
+	}
+
+	configOut, err := MergeDerekRepoConfigs(local, remote)
+	if err != nil {
+		t.Fatalf("Got error for a single plan, expected no error: %s", err.Error())
+	}
+
+	want := []Message{{Name: "faq", Value: "See the FAQ"}}
+	if got := RemoveMarkers(configOut).Messages; !reflect.DeepEqual(want, got) {
+		t.Errorf("Messages want: %v, but got: %v", want, got)
+	}
+}
+
+func Test_overrideDerekRepoConfig_OverrideWins(t *testing.T) {
+
+	base := DerekRepoConfig{
+		ContributingURL: "http://example.com",
+		Maintainers:     []string{"alexellis"},
+	}
+
+	override := DerekRepoConfig{
+		ContributingURL: "http://two.example.com",
+		Maintainers:     []string{"rgee0"},
+	}
+
+	configOut, err := OverrideDerekRepoConfig(base, override)
+	if err != nil {
+		t.Fatalf("Got error for a single plan, expected no error: %s", err.Error())
+	}
+
+	if override.ContributingURL != configOut.ContributingURL {
+		t.Errorf("ContributingURL want: %s, but got: %s", override.ContributingURL, configOut.ContributingURL)
+	}
+
+	want := []string{"alexellis", "rgee0"}
+	if !reflect.DeepEqual(want, configOut.Maintainers) {
+		t.Errorf("Maintainers want: %s, but got: %s", want, configOut.Maintainers)
+	}
+}
+
+// A removal applies to every config beneath, not just the next one
+func Test_overrideDerekRepoConfig_RemovalsKeptForLaterMerges(t *testing.T) {
+
+	defaults := DerekRepoConfig{Features: []string{"hacktoberfest"}}
+	org := DerekRepoConfig{Features: []string{"dco_check"}}
+	repo := DerekRepoConfig{Features: []string{"!hacktoberfest", "!dco_check"}}
+
+	orgAndRepo, err := OverrideDerekRepoConfig(org, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configOut, err := OverrideDerekRepoConfig(defaults, orgAndRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := RemoveMarkers(configOut).Features; len(got) != 0 {
+		t.Errorf("Features want none, but got: %s", got)
+	}
+}
+
+func Test_overrideDerekRepoConfig_ReaddRemovedEntry(t *testing.T) {
+
+	base := DerekRepoConfig{Features: []string{"comments", "!hacktoberfest"}}
+	override := DerekRepoConfig{Features: []string{"hacktoberfest"}}
+
+	configOut, err := OverrideDerekRepoConfig(base, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"comments", "hacktoberfest"}
+	if got := RemoveMarkers(configOut).Features; !reflect.DeepEqual(want, got) {
+		t.Errorf("Features want: %s, but got: %s", want, got)
+	}
+}
+
+func Test_overrideDerekRepoConfig_FalseOverTrue(t *testing.T) {
+
+	base := DerekRepoConfig{DryRun: boolPtr(true), IgnoreOrgConfig: boolPtr(true)}
+	override := DerekRepoConfig{DryRun: boolPtr(false), IgnoreOrgConfig: boolPtr(false)}
+
+	configOut, err := OverrideDerekRepoConfig(base, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configOut.IsDryRun() {
+		t.Errorf("IsDryRun want: false, but got: true")
+	}
+	if configOut.IgnoresOrgConfig() {
+		t.Errorf("IgnoresOrgConfig want: false, but got: true")
+	}
+	if !*base.DryRun || !*base.IgnoreOrgConfig {
+		t.Errorf("base config was modified by the merge")
+	}
+}
+
+func Test_overrideDerekRepoConfig_UnsetBoolsInherited(t *testing.T) {
+
+	base := DerekRepoConfig{DryRun: boolPtr(true), IgnoreOrgConfig: boolPtr(true)}
+
+	configOut, err := OverrideDerekRepoConfig(base, DerekRepoConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !configOut.IsDryRun() {
+		t.Errorf("IsDryRun want: true, but got: false")
+	}
+	if !configOut.IgnoresOrgConfig() {
+		t.Errorf("IgnoresOrgConfig want: true, but got: false")
+	}
+}
+
+func Test_mergeDerekRepoConfigs_FalseOverTrue(t *testing.T) {
+
+	local := DerekRepoConfig{DryRun: boolPtr(true), IgnoreOrgConfig: boolPtr(true)}
+	remote := DerekRepoConfig{DryRun: boolPtr(false), IgnoreOrgConfig: boolPtr(false)}
+
+	configOut, err := MergeDerekRepoConfigs(local, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configOut.IsDryRun() {
+		t.Errorf("IsDryRun want: false, but got: true")
+	}
+	if configOut.IgnoresOrgConfig() {
+		t.Errorf("IgnoresOrgConfig want: false, but got: true")
+	}
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
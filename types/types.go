@@ -31,6 +31,13 @@ type ID struct {
 	ID int `json:"id"`
 }
 
+// EventOuter holds the fields common to every webhook payload
+type EventOuter struct {
+	Repository Repository `json:"repository"`
+	Action     string     `json:"action"`
+	InstallationRequest
+}
+
 type PullRequestOuter struct {
 	Repository  Repository  `json:"repository"`
 	PullRequest PullRequest `json:"pull_request"`
@@ -59,6 +66,34 @@ type IssueCommentOuter struct {
 	InstallationRequest
 }
 
+type PushOuter struct {
+	Repository Repository   `json:"repository"`
+	Ref        string       `json:"ref"`
+	Commits    []PushCommit `json:"commits"`
+	InstallationRequest
+}
+
+type PushCommit struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// Touches returns true if any commit in the push added,
+// removed or modified the given file.
+func (p *PushOuter) Touches(file string) bool {
+	for _, commit := range p.Commits {
+		for _, files := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, f := range files {
+				if f == file {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 type IssueLabel struct {
 	Name string `json:"name"`
 }
@@ -97,6 +132,19 @@ type DerekRepoConfig struct {
 	// A redirect URL to load the config from another location.
 	Redirect string
 
+	// Extends lists configs to inherit from, either GitHub URLs or
+	// owner/repo:path@ref, the later entries take precedence.
+	Extends []string
+
+	// IgnoreOrgConfig stops the .DEREK.yml of the organisation's .github
+	// repository being merged beneath this one. It is nil when not set, so
+	// that false can be set over an inherited true.
+	IgnoreOrgConfig *bool `yaml:"ignore_org_config"`
+
+	// Sources are the configs merged into this one, from the lowest to the
+	// highest precedence, they are set by Derek rather than read from a file.
+	Sources []string `yaml:"-"`
+
 	// Features can be turned on/off if needed.
 	Features []string
 
@@ -109,9 +157,28 @@ type DerekRepoConfig struct {
 	//ContributingURL url to contribution guide
 	ContributingURL string `yaml:"contributing_url"`
 
+	// DryRun logs the changes Derek would make instead of making them,
+	// it is nil when not set, like IgnoreOrgConfig
+	DryRun *bool `yaml:"dry_run"`
+
 	Messages []Message `yaml:"custom_messages"`
 
 	RequiredInIssues []string `yaml:"required_in_issues"`
+
+	// Merge gives the strategy for combining a list with the list inherited
+	// from other configs, i.e. "maintainers: replace", the default is append.
+	Merge map[string]string `yaml:"merge"`
+}
+
+// CheckRunAnnotation marks lines of a file in the output of a check run,
+// go-github only has the field names from the preview of the Checks API
+type CheckRunAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Message         string `json:"message"`
+	Title           string `json:"title,omitempty"`
 }
 
 type Message struct {
@@ -119,6 +186,16 @@ type Message struct {
 	Value string `yaml:"value"`
 }
 
+// IsDryRun whether Derek should only log the changes it would make
+func (c DerekRepoConfig) IsDryRun() bool {
+	return c.DryRun != nil && *c.DryRun
+}
+
+// IgnoresOrgConfig whether the organisation's config is left out
+func (c DerekRepoConfig) IgnoresOrgConfig() bool {
+	return c.IgnoreOrgConfig != nil && *c.IgnoreOrgConfig
+}
+
 // FirstTimeContributor whether the contributor is new to the repo
 func (p *PullRequest) FirstTimeContributor() bool {
 	return p.AuthorAssociation == "NONE"